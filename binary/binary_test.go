@@ -0,0 +1,235 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jig/lisp"
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/types"
+)
+
+var roundTripCode = []string{
+	`nil`,
+	`(true false)`,
+	`[0 1 -1 23 24 255 256 65536 -4294967297 9223372036854775807 -9223372036854775808]`,
+	`[1.5 -0.0 0.1 1e300]`,
+	`[1N -1N 0N 123456789012345678901234567890N -18446744073709551616N]`,
+	`[1.5M -0.001M 10M 0M 12345678901234567890.0987654321M]`,
+	`"a \"string\"\nwith ¬ unicode"`,
+	`"\ttab\u0000 \x80 \U0001F600"`,
+	`[\a \newline \é \u0000]`,
+	`¬{"json": true}¬`,
+	`(:kw sym ns/sym :ns/kw)`,
+	`{:c 1 :a [2 3] "b" #{1 :x "y"} [4] {nil 5}}`,
+	`#{}`,
+	`(def! f (fn* [a & b] (if (= a 1) '(a b) ~@b)))`,
+	`(let [x {:a (list 1 2)}] @x)`,
+}
+
+func read(t testing.TB, code string) types.MalType {
+	ast, err := lisp.READ(code, types.NewCursorFile(t.Name()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ast
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, code := range roundTripCode {
+		ast := read(t, code)
+		for name, encode := range map[string]func(types.MalType) ([]byte, error){
+			"Encode":        Encode,
+			"EncodeCompact": EncodeCompact,
+		} {
+			data, err := encode(ast)
+			if err != nil {
+				t.Fatalf("%s %s: %s", name, code, err)
+			}
+			back, err := Decode(data)
+			if err != nil {
+				t.Fatalf("%s %s: %s", name, code, err)
+			}
+			if lisp.PRINT(back) != lisp.PRINT(ast) || !types.Equal_Q(back, ast) {
+				t.Fatalf("%s %s: decoded as %s", name, code, lisp.PRINT(back))
+			}
+			if again, _ := encode(back); !bytes.Equal(again, data) {
+				t.Fatalf("%s %s: encoded as %x and %x", name, code, data, again)
+			}
+		}
+	}
+}
+
+func TestSymbolPosition(t *testing.T) {
+	ast := read(t, "(a\n  b)")
+	data, err := Encode(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := back.(types.List).Val[1].(types.Symbol)
+	expected := *ast.(types.List).Val[1].(types.Symbol).Cursor
+	if b.Cursor == nil || *b.Cursor.Module != t.Name() || b.Cursor.BeginRow != expected.BeginRow || b.Cursor.BeginCol != expected.BeginCol || b.Cursor.Row != expected.Row || b.Cursor.Col != expected.Col {
+		t.Fatalf("position of b not decoded: %+v", b.Cursor)
+	}
+
+	compact, err := EncodeCompact(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compact) >= len(data) {
+		t.Fatalf("compact encoding of %d bytes, %d with positions", len(compact), len(data))
+	}
+	back, err = Decode(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := back.(types.List).Val[1].(types.Symbol); b.Cursor != nil {
+		t.Fatalf("unexpected position of b %+v", b.Cursor)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	for expected, ast := range map[string]types.MalType{
+		"f6":                 nil,
+		"f5":                 true,
+		"00":                 0,
+		"17":                 23,
+		"1818":               24,
+		"190100":             256,
+		"20":                 -1,
+		"3903e7":             -1000,
+		"fa3fc00000":         1.5,
+		"fb3fb999999999999a": 0.1,
+		"c24101":             types.NewBigInt(1),
+		"c340":               types.NewBigInt(-1),
+		"c482213903e6":       read(t, "-9.99M"),
+		"6161":               "a",
+		"4201ff":             []byte{1, 0xff},
+		"d99c426161":         "ʞa",
+		"d99c416161":         types.Symbol{Val: "a"},
+		"d99c431861":         types.Char('a'),
+		"d99c40820102":       types.List{Val: []types.MalType{1, 2}},
+		"820102":             types.NewVector(1, 2),
+		"d9010281f6":         read(t, "#{nil}"),
+		"a2d99c426162f5f6f4": read(t, "{:b true nil false}"),
+	} {
+		data, err := EncodeCompact(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(data) != expected {
+			t.Fatalf("%s: expected %s got %x", lisp.PRINT(ast), expected, data)
+		}
+	}
+	if b, err := Decode([]byte{0x42, 1, 0xff}); err != nil || !bytes.Equal(b.([]byte), []byte{1, 0xff}) {
+		t.Fatalf("unexpected bytes %v (%v)", b, err)
+	}
+	// unsigned integers larger than int are decoded as big integers
+	if i, err := Decode([]byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}); err != nil || lisp.PRINT(i) != "18446744073709551615N" {
+		t.Fatalf("unexpected integer %s (%v)", lisp.PRINT(i), err)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for _, value := range []types.MalType{
+		types.NewVector(errors.New("go error")),
+		types.NewHashMapFromMap(map[string]types.MalType{"ʞf": func() {}}),
+		types.Func{},
+	} {
+		if _, err := Encode(value); err == nil {
+			t.Fatalf("expected an error encoding %T", value)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"empty":             "",
+		"truncated int":     "19ff",
+		"truncated string":  "6361",
+		"truncated array":   "830102",
+		"huge array":        "9bffffffffffffffff",
+		"trailing bytes":    "0102",
+		"indefinite length": "9f01ff",
+		"unknown tag":       "d8ff01",
+		"bad keyword":       "d99c4201",
+		"bad char":          "d99c4319d800",
+		"bad symbol":        "d99c418101",
+		"bad decimal":       "c48201",
+		"huge exponent":     "c4821a7fffffff01",
+		"half float":        "f93c00",
+		"deep nesting":      strings.Repeat("81", maxDepth+1) + "01",
+	} {
+		raw, err := hex.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ast, err := Decode(raw); err == nil {
+			t.Fatalf("%s: expected an error, got %s", name, lisp.PRINT(ast))
+		}
+	}
+	if _, err := Decode([]byte{0x62, 'a'}); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated got %v", err)
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, code := range roundTripCode {
+		f.Add(code)
+	}
+	f.Fuzz(func(t *testing.T, code string) {
+		ast, err := lisp.READ(code, types.NewCursorFile("fuzz"), env.NewEnv())
+		if err != nil {
+			return
+		}
+		data, err := Encode(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%x: %s", data, err)
+		}
+		if lisp.PRINT(back) != lisp.PRINT(ast) {
+			t.Fatalf("%q decoded as %s", code, lisp.PRINT(back))
+		}
+		if again, _ := Encode(back); !bytes.Equal(again, data) {
+			t.Fatalf("%q encoded as %x and %x", code, data, again)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, code := range roundTripCode {
+		data, err := Encode(read(f, code))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ast, err := Decode(data)
+		if err != nil {
+			return
+		}
+		// data may not be canonical (e.g. repeated keys), but its encoding is
+		encoded, err := Encode(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("%x: %s", encoded, err)
+		}
+		if again, _ := Encode(back); !bytes.Equal(again, encoded) {
+			t.Fatalf("%x encoded as %x and %x", data, encoded, again)
+		}
+	})
+}
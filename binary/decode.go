@@ -0,0 +1,348 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"unicode/utf8"
+
+	"github.com/jig/lisp/types"
+)
+
+// ErrTruncated is returned by [Decode] when data ends in the middle of an item
+var ErrTruncated = errors.New("binary: unexpected end of data")
+
+// maxDepth limits the nesting of the decoded collections
+const maxDepth = 1000
+
+// maxDecimalExponent limits the size of the decimals: 10^maxDecimalExponent is computed to
+// decode them
+const maxDecimalExponent = 4096
+
+// Decode converts data, encoded by [Encode] or [EncodeCompact], to the AST it was encoded
+// from. Data must hold exactly one item.
+func Decode(data []byte) (types.MalType, error) {
+	d := decoder{data: data}
+	ast, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("binary: %d unexpected bytes after the encoded value", len(d.data)-d.pos)
+	}
+	return ast, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads the initial bytes of an item, returning its major type, and its argument n (the
+// raw additional information for major type 7)
+func (d *decoder) head() (major byte, info byte, n uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, ErrTruncated
+	}
+	major, info = d.data[d.pos]&0xe0, d.data[d.pos]&0x1f
+	d.pos++
+	size := 0
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, 0, fmt.Errorf("binary: unsupported additional information %d", info)
+	}
+	if len(d.data)-d.pos < size {
+		return 0, 0, 0, ErrTruncated
+	}
+	for _, b := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(b)
+	}
+	d.pos += size
+	return major, info, n, nil
+}
+
+// length reads the head of an item of the major type expected, returning its length
+func (d *decoder) length(expected byte) (int, error) {
+	major, _, n, err := d.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != expected {
+		return 0, fmt.Errorf("binary: expected major type %d got %d", expected>>5, major>>5)
+	}
+	// every item takes a byte at least
+	if n > uint64(len(d.data)-d.pos) {
+		return 0, ErrTruncated
+	}
+	return int(n), nil
+}
+
+func (d *decoder) bytes(n int) []byte {
+	b := d.data[d.pos : d.pos+n : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) text() (string, error) {
+	n, err := d.length(majorText)
+	if err != nil {
+		return "", err
+	}
+	return string(d.bytes(n)), nil
+}
+
+func (d *decoder) int() (int, error) {
+	major, _, n, err := d.head()
+	if err != nil {
+		return 0, err
+	}
+	if (major != majorUnsigned && major != majorNegative) || n > math.MaxInt {
+		return 0, errors.New("binary: expected an int")
+	}
+	if major == majorNegative {
+		return -1 - int(n), nil
+	}
+	return int(n), nil
+}
+
+func (d *decoder) array(depth int) ([]types.MalType, error) {
+	n, err := d.length(majorArray)
+	if err != nil {
+		return nil, err
+	}
+	elems := make([]types.MalType, n)
+	for i := range elems {
+		if elems[i], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return elems, nil
+}
+
+func (d *decoder) decode(depth int) (types.MalType, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("binary: more than %d nested collections", maxDepth)
+	}
+	start := d.pos
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUnsigned:
+		if n > math.MaxInt {
+			return types.BigInt{Val: new(big.Int).SetUint64(n)}, nil
+		}
+		return int(n), nil
+	case majorNegative:
+		if n > math.MaxInt {
+			i := new(big.Int).SetUint64(n)
+			return types.BigInt{Val: i.Sub(big.NewInt(-1), i)}, nil
+		}
+		return -1 - int(n), nil
+	case majorBytes, majorText, majorArray:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrTruncated
+		}
+		switch major {
+		case majorBytes:
+			return append([]byte{}, d.bytes(int(n))...), nil
+		case majorText:
+			return string(d.bytes(int(n))), nil
+		default:
+			d.pos = start
+			elems, err := d.array(depth)
+			if err != nil {
+				return nil, err
+			}
+			return types.NewVector(elems...), nil
+		}
+	case majorMap:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrTruncated
+		}
+		hm := types.HashMap{}
+		for i := uint64(0); i < n; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			hm = hm.Assoc(k, v)
+		}
+		return hm, nil
+	case majorTag:
+		return d.tagged(n, depth)
+	default:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		case 26:
+			return float64(math.Float32frombits(uint32(n))), nil
+		case 27:
+			return math.Float64frombits(n), nil
+		default:
+			return nil, fmt.Errorf("binary: unsupported simple value %d", info)
+		}
+	}
+}
+
+func (d *decoder) tagged(tag uint64, depth int) (types.MalType, error) {
+	switch tag {
+	case TagList:
+		elems, err := d.array(depth)
+		if err != nil {
+			return nil, err
+		}
+		return types.List{Val: elems}, nil
+	case tagSet:
+		elems, err := d.array(depth)
+		if err != nil {
+			return nil, err
+		}
+		s := types.Set{}
+		for _, elem := range elems {
+			s = s.Conj(elem)
+		}
+		return s, nil
+	case TagKeyword:
+		name, err := d.text()
+		if err != nil {
+			return nil, err
+		}
+		return "ʞ" + name, nil
+	case TagChar:
+		code, err := d.int()
+		if err != nil {
+			return nil, err
+		}
+		if code != int(rune(code)) || !utf8.ValidRune(rune(code)) {
+			return nil, fmt.Errorf("binary: invalid code point %d", code)
+		}
+		return types.Char(code), nil
+	case TagSymbol:
+		if d.pos < len(d.data) && d.data[d.pos]&0xe0 == majorText {
+			name, err := d.text()
+			if err != nil {
+				return nil, err
+			}
+			return types.Symbol{Val: name}, nil
+		}
+		return d.symbolWithPosition()
+	case tagPositiveBignum, tagNegativeBignum:
+		i, err := d.bignum(tag)
+		if err != nil {
+			return nil, err
+		}
+		return types.BigInt{Val: i}, nil
+	case tagDecimalFraction:
+		return d.decimal(depth)
+	default:
+		return nil, fmt.Errorf("binary: unsupported tag %d", tag)
+	}
+}
+
+// bignum reads the byte string of a bignum, whose tag has already been read
+func (d *decoder) bignum(tag uint64) (*big.Int, error) {
+	n, err := d.length(majorBytes)
+	if err != nil {
+		return nil, err
+	}
+	i := new(big.Int).SetBytes(d.bytes(n))
+	if tag == tagNegativeBignum {
+		i.Sub(big.NewInt(-1), i)
+	}
+	return i, nil
+}
+
+func (d *decoder) symbolWithPosition() (types.MalType, error) {
+	n, err := d.length(majorArray)
+	if err != nil {
+		return nil, err
+	}
+	if n != 6 {
+		return nil, fmt.Errorf("binary: expected a symbol of 6 elements got %d", n)
+	}
+	name, err := d.text()
+	if err != nil {
+		return nil, err
+	}
+	pos := &types.Position{}
+	if d.pos < len(d.data) && d.data[d.pos] == simpleNull {
+		d.pos++
+	} else {
+		module, err := d.text()
+		if err != nil {
+			return nil, err
+		}
+		pos.Module = &module
+	}
+	for _, field := range []*int{&pos.BeginRow, &pos.BeginCol, &pos.Row, &pos.Col} {
+		if *field, err = d.int(); err != nil {
+			return nil, err
+		}
+	}
+	return types.Symbol{Val: name, Cursor: pos}, nil
+}
+
+func (d *decoder) decimal(depth int) (types.MalType, error) {
+	n, err := d.length(majorArray)
+	if err != nil {
+		return nil, err
+	}
+	if n != 2 {
+		return nil, fmt.Errorf("binary: expected a decimal of 2 elements got %d", n)
+	}
+	exponent, err := d.int()
+	if err != nil {
+		return nil, err
+	}
+	if exponent < -maxDecimalExponent || exponent > maxDecimalExponent {
+		return nil, fmt.Errorf("binary: decimal exponent %d out of range", exponent)
+	}
+	mantissa, err := d.decode(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	r := new(big.Rat)
+	switch mantissa := mantissa.(type) {
+	case int:
+		r.SetInt64(int64(mantissa))
+	case types.BigInt:
+		r.SetInt(mantissa.Val)
+	default:
+		return nil, errors.New("binary: expected an integer decimal mantissa")
+	}
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exponent))), nil))
+	if exponent < 0 {
+		r.Quo(r, scale)
+	} else {
+		r.Mul(r, scale)
+	}
+	return types.Decimal{Val: r}, nil
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,254 @@
+// Package binary implements a compact binary encoding of readable ASTs, to transmit code
+// without printing and reading it back.
+//
+// The encoding is CBOR (RFC 8949). Vectors are arrays, hash maps are maps, strings are text
+// strings and []byte are byte strings. The other types use tags: lists, symbols, keywords and
+// characters use the private tags [TagList], [TagSymbol], [TagKeyword] and [TagChar], big
+// integers and decimals use the standard bignum (2, 3) and decimal fraction (4) tags, and sets
+// use tag 258.
+package binary
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/jig/lisp/types"
+)
+
+// Tags of the lisp types with no CBOR equivalent
+const (
+	// TagList wraps the array of the elements of a list
+	TagList = 40000
+	// TagSymbol wraps the name of a symbol, or the array [name module begin-row begin-col
+	// row col] of a symbol with a source position (module is null if it is unknown)
+	TagSymbol = 40001
+	// TagKeyword wraps the name of a keyword, without its colon
+	TagKeyword = 40002
+	// TagChar wraps the code point of a character
+	TagChar = 40003
+)
+
+// standard CBOR tags
+const (
+	tagPositiveBignum  = 2
+	tagNegativeBignum  = 3
+	tagDecimalFraction = 4
+	tagSet             = 258
+)
+
+// major types
+const (
+	majorUnsigned = 0 << 5
+	majorNegative = 1 << 5
+	majorBytes    = 2 << 5
+	majorText     = 3 << 5
+	majorArray    = 4 << 5
+	majorMap      = 5 << 5
+	majorTag      = 6 << 5
+	majorSimple   = 7 << 5
+)
+
+// simple values and floats (major type 7)
+const (
+	simpleFalse = majorSimple | 20
+	simpleTrue  = majorSimple | 21
+	simpleNull  = majorSimple | 22
+	float32Head = majorSimple | 26
+	float64Head = majorSimple | 27
+)
+
+// Encode returns the binary encoding of ast, that [Decode] converts back to the same AST.
+// Source positions of symbols are kept, see [EncodeCompact] to drop them.
+// Hash map entries and set items keep their insertion order.
+// Values that can't be read (functions, atoms, Go values...) return an error.
+func Encode(ast types.MalType) ([]byte, error) {
+	e := encoder{positions: true}
+	if err := e.encode(ast); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// EncodeCompact is [Encode] without the source positions of symbols
+func EncodeCompact(ast types.MalType) ([]byte, error) {
+	e := encoder{}
+	if err := e.encode(ast); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf       []byte
+	positions bool
+}
+
+// head appends the initial bytes of an item: its major type and its argument n
+func (e *encoder) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = appendUint(append(e.buf, major|25), n, 2)
+	case n <= math.MaxUint32:
+		e.buf = appendUint(append(e.buf, major|26), n, 4)
+	default:
+		e.buf = appendUint(append(e.buf, major|27), n, 8)
+	}
+}
+
+// appendUint appends the size bytes of n in big-endian order
+func appendUint(buf []byte, n uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		buf = append(buf, byte(n>>(8*i)))
+	}
+	return buf
+}
+
+func (e *encoder) text(s string) {
+	e.head(majorText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) int(i int) {
+	if i < 0 {
+		e.head(majorNegative, uint64(-1-i))
+		return
+	}
+	e.head(majorUnsigned, uint64(i))
+}
+
+func (e *encoder) bigInt(i *big.Int) {
+	if i.Sign() < 0 {
+		// -1 - n
+		e.head(majorTag, tagNegativeBignum)
+		n := new(big.Int).Neg(i)
+		e.bytes(n.Sub(n, big.NewInt(1)).Bytes())
+		return
+	}
+	e.head(majorTag, tagPositiveBignum)
+	e.bytes(i.Bytes())
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.head(majorBytes, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) encode(ast types.MalType) error {
+	switch ast := ast.(type) {
+	case nil:
+		e.buf = append(e.buf, simpleNull)
+	case bool:
+		if ast {
+			e.buf = append(e.buf, simpleTrue)
+		} else {
+			e.buf = append(e.buf, simpleFalse)
+		}
+	case int:
+		e.int(ast)
+	case float64:
+		if f := float32(ast); math.Float64bits(float64(f)) == math.Float64bits(ast) {
+			e.buf = appendUint(append(e.buf, float32Head), uint64(math.Float32bits(f)), 4)
+		} else {
+			e.buf = appendUint(append(e.buf, float64Head), math.Float64bits(ast), 8)
+		}
+	case types.BigInt:
+		e.bigInt(ast.Val)
+	case types.Decimal:
+		mantissa, exponent := decimalFraction(ast.Val)
+		e.head(majorTag, tagDecimalFraction)
+		e.head(majorArray, 2)
+		e.int(exponent)
+		if m := mantissa; m.IsInt64() && m.Int64() >= math.MinInt && m.Int64() <= math.MaxInt {
+			e.int(int(m.Int64()))
+		} else {
+			e.bigInt(m)
+		}
+	case string:
+		if strings.HasPrefix(ast, "ʞ") {
+			e.head(majorTag, TagKeyword)
+			e.text(strings.TrimPrefix(ast, "ʞ"))
+			return nil
+		}
+		e.text(ast)
+	case []byte:
+		e.bytes(ast)
+	case types.Char:
+		e.head(majorTag, TagChar)
+		e.int(int(ast))
+	case types.Symbol:
+		e.head(majorTag, TagSymbol)
+		if !e.positions || ast.Cursor == nil {
+			e.text(ast.Val)
+			return nil
+		}
+		e.head(majorArray, 6)
+		e.text(ast.Val)
+		if ast.Cursor.Module == nil {
+			e.buf = append(e.buf, simpleNull)
+		} else {
+			e.text(*ast.Cursor.Module)
+		}
+		e.int(ast.Cursor.BeginRow)
+		e.int(ast.Cursor.BeginCol)
+		e.int(ast.Cursor.Row)
+		e.int(ast.Cursor.Col)
+	case types.List:
+		e.head(majorTag, TagList)
+		return e.array(ast.Val)
+	case types.Vector:
+		return e.array(ast.Slice())
+	case types.Set:
+		e.head(majorTag, tagSet)
+		return e.array(ast.OrderedItems(types.Insertion))
+	case types.HashMap:
+		keys := ast.OrderedKeys(types.Insertion)
+		e.head(majorMap, uint64(len(keys)))
+		for _, k := range keys {
+			if err := e.encode(k); err != nil {
+				return err
+			}
+			v, _ := ast.Get(k)
+			if err := e.encode(v); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("binary: values of type %s can't be encoded", types.TypeName(ast))
+	}
+	return nil
+}
+
+// decimalFraction returns r as mantissa × 10^exponent, with the exponent of the fewest
+// fractional digits. The denominator of r must be 2^a × 5^b (r is a decimal).
+func decimalFraction(r *big.Rat) (mantissa *big.Int, exponent int) {
+	den := new(big.Int).Set(r.Denom())
+	twos := int(den.TrailingZeroBits())
+	den.Rsh(den, uint(twos))
+	fives := 0
+	for five, mod := big.NewInt(5), new(big.Int); den.BitLen() > 1; fives++ {
+		den.QuoRem(den, five, mod)
+	}
+	scale := twos
+	if fives > twos {
+		scale = fives
+	}
+	mantissa = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	mantissa.Mul(mantissa, r.Num())
+	return mantissa.Quo(mantissa, r.Denom()), -scale
+}
+
+func (e *encoder) array(elems []types.MalType) error {
+	e.head(majorArray, uint64(len(elems)))
+	for _, elem := range elems {
+		if err := e.encode(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jig/lisp/lisperror"
+	. "github.com/jig/lisp/types"
+)
+
+// catchClause is a catch form of a try. (catch binding body...) catches every error, and
+// (catch selector binding body...) catches the errors selected by selector, that evaluates to:
+//   - a string: errors whose value has that type? name (e.g. "go-error", "ex-info" or a Typed.Type())
+//   - a keyword: ex-info errors whose ex-data :type is the keyword
+//   - a predicate function called with the error value
+//
+// A bare symbol followed by more forms after the binding is read as a selector, not as a catch all body.
+type catchClause struct {
+	form     List
+	selector MalType // form, nil if the clause catches every error
+	bind     Symbol
+	body     []MalType
+}
+
+// parseTry splits the forms of a try into its body, its catch clauses (in order) and its finally body
+func parseTry(ast List) (body []MalType, catches []catchClause, finally []MalType, err error) {
+	body = ast.Val[1:]
+	if len(body) > 0 && first(body[len(body)-1]) == "finally" {
+		finally = body[len(body)-1].(List).Val[1:]
+		body = body[:len(body)-1]
+	}
+	i := len(body)
+	for i > 0 && first(body[i-1]) == "catch" {
+		i--
+	}
+	for _, form := range body[i:] {
+		clause, err := parseCatch(form.(List))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		catches = append(catches, clause)
+	}
+	return body[:i], catches, finally, nil
+}
+
+func parseCatch(form List) (catchClause, error) {
+	if len(form.Val) < 3 {
+		return catchClause{}, lisperror.NewLispError(errors.New("catch must have 2 arguments at least"), form)
+	}
+	clause := catchClause{form: form}
+	args := form.Val[1:]
+	if _, ok := args[1].(Symbol); ok && len(args) > 2 {
+		clause.selector = args[0]
+		args = args[1:]
+	}
+	bind, ok := args[0].(Symbol)
+	if !ok {
+		return catchClause{}, lisperror.NewLispError(errors.New("non-symbol bind value"), form)
+	}
+	clause.bind = bind
+	clause.body = args[1:]
+	return clause, nil
+}
+
+// caughtValue returns the value bound by catch to the error e
+func caughtValue(e error) MalType {
+	if er, ok := e.(interface{ ErrorValue() MalType }); ok {
+		return er.ErrorValue()
+	}
+	return e.Error()
+}
+
+// selects returns true if the caught value is selected by the evaluated selector of a catch clause
+func selects(ctx context.Context, selector, caught MalType, form List) (bool, error) {
+	if name, ok := selector.(string); ok {
+		if !strings.HasPrefix(name, "ʞ") {
+			return TypeName(caught) == name, nil
+		}
+		var exInfo *lisperror.ExInfo
+		if err, ok := caught.(error); ok && errors.As(err, &exInfo) {
+			tag, _ := exInfo.Data.Get("ʞtype")
+			tag, ok := tag.(string)
+			return ok && tag == name, nil
+		}
+		return false, nil
+	}
+	switch selector.(type) {
+	case MalFunc, Func, Callable:
+		selected, err := Apply(ctx, selector, []MalType{caught})
+		if err != nil {
+			return false, err
+		}
+		return selected != nil && selected != false, nil
+	default:
+		return false, lisperror.NewLispError(fmt.Errorf("invalid catch selector (was of type %s)", TypeName(selector)), form)
+	}
+}
@@ -34,6 +34,11 @@ func main() {
 		}
 	}
 
+	// libraries that might be loaded into their own namespace too, e.g. (require [system :as sys])
+	env.RegisterLibrary(ns, "system", nssystem.Load)
+	env.RegisterLibrary(ns, "concurrent", nsconcurrent.Load)
+	env.RegisterLibrary(ns, "assert", nsassert.Load)
+
 	if err := command.Execute(os.Args, ns); err != nil {
 		log.Fatalf("Error: %v\n", err)
 	}
@@ -9,8 +9,12 @@ import (
 	"runtime/debug"
 	"strings"
 
+	"github.com/fatih/color"
 	"github.com/jig/lisp"
 	"github.com/jig/lisp/debugger"
+	"github.com/jig/lisp/debugger/dap"
+	"github.com/jig/lisp/lib/core/nscore"
+	"github.com/jig/lisp/lisperror"
 	"github.com/jig/lisp/repl"
 	"github.com/jig/lisp/types"
 )
@@ -20,7 +24,8 @@ func printHelp() {
 	--version, -v provides the version number
 	--help, -h provides this help message
 	--test, -t runs the test suite
-	--debug, -d runs the debugger`)
+	--debug, -d runs the debugger
+	--dap [address] runs a Debug Adapter Protocol server on stdio (or listening on address, e.g. localhost:4711)`)
 }
 
 // Execute is the main function of a command line MAL interpreter.
@@ -68,7 +73,7 @@ func Execute(args []string, repl_env types.EnvType) error {
 							return err
 						}
 						if _, err := lisp.REPL(ctx, repl_env, `(load-file "`+path+`")`, types.NewCursorHere(path, -3, 1)); err != nil {
-							return err
+							return withDetails(err)
 						}
 					}
 				}
@@ -89,6 +94,16 @@ func Execute(args []string, repl_env types.EnvType) error {
 			}
 			fmt.Println(result)
 			return nil
+		case "--dap":
+			switch len(os.Args) {
+			case 2:
+				return dap.ServeStdio(repl_env)
+			case 3:
+				return dap.ListenAndServe(os.Args[2], repl_env)
+			default:
+				printHelp()
+				return fmt.Errorf("too many args")
+			}
 		}
 
 		// called with mal script to load and eval
@@ -101,27 +116,35 @@ func Execute(args []string, repl_env types.EnvType) error {
 	}
 }
 
-// ExecuteFile executes a file on the given path
+// ExecuteFile executes a file on the given path form by form, and returns the printed result of
+// its last form
 func ExecuteFile(fileName string, ns types.EnvType) (types.MalType, error) {
-	ctx := context.Background()
-	result, err := lisp.REPL(ctx, ns, `(load-file "`+fileName+`")`, types.NewCursorHere(fileName, -3, 1))
+	result, err := nscore.EvalFile(context.Background(), ns, fileName)
 	if err != nil {
-		return nil, err
+		return nil, withDetails(err)
 	}
-	return result, nil
+	return lisp.PRINT(result), nil
 }
 
 // ExecuteFile executes a file on the given path
 func DebugFile(fileName string, ns types.EnvType) (types.MalType, error) {
 	deb := debugger.Engine(fileName, ns)
 	defer deb.Shutdown()
-	lisp.Stepper = deb.Stepper
-	// lisp.Trace = deb.Trace
+	interpreter := lisp.NewInterpreter(lisp.Options{Stepper: deb.Stepper})
 
-	ctx := context.Background()
+	ctx := interpreter.WithContext(context.Background())
 	result, err := lisp.REPL(ctx, ns, `(load-file "`+fileName+`")`, types.NewCursorHere(fileName, -3, 1))
 	if err != nil {
-		return nil, err
+		return nil, withDetails(err)
 	}
 	return result, nil
 }
+
+// withDetails adds the source excerpt and the Lisp stack trace to the message of err
+func withDetails(err error) error {
+	details := lisperror.Details(err, !color.NoColor)
+	if details == "" {
+		return err
+	}
+	return fmt.Errorf("%w\n%s", err, strings.TrimSuffix(details, "\n"))
+}
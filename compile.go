@@ -0,0 +1,1040 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/jig/lisp/env"
+	"github.com/jig/lisp/lisperror"
+	. "github.com/jig/lisp/types"
+)
+
+// Program is an AST compiled by [Compile]. A Program might be run many times,
+// even concurrently, with different bindings.
+type Program struct {
+	root node
+	env  EnvType
+}
+
+// node is a compiled expression. fr holds the values of the locals visible by the expression.
+type node func(ctx context.Context, fr *frame) (MalType, error)
+
+// frame holds the values of locals of a let, fn or catch scope.
+// Locals are addressed by position (depth of frame and index in frame) resolved at compile time.
+type frame struct {
+	vals []MalType
+	up   *frame
+	// env is the environment of the run, used to resolve globals
+	env EnvType
+}
+
+func (fr *frame) at(depth int) *frame {
+	for ; depth > 0; depth-- {
+		fr = fr.up
+	}
+	return fr
+}
+
+// scope is the compile time view of a frame
+type scope struct {
+	names []string
+	up    *scope
+}
+
+func (sc *scope) resolve(name string) (depth, index int, ok bool) {
+	for ; sc != nil; sc, depth = sc.up, depth+1 {
+		for i := len(sc.names) - 1; i >= 0; i-- {
+			if sc.names[i] == name {
+				return depth, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func (sc *scope) add(name string) int {
+	sc.names = append(sc.names, name)
+	return len(sc.names) - 1
+}
+
+// snapshot copies the names visible at this point of the compilation, as scopes grow
+// with following let bindings and local defs
+func (sc *scope) snapshot() *scope {
+	if sc == nil {
+		return nil
+	}
+	return &scope{
+		names: append([]string{}, sc.names...),
+		up:    sc.up.snapshot(),
+	}
+}
+
+// tailCall is returned by calls in tail position and resolved by the caller (see [compiledFn.Call])
+// to run tail calls in constant stack space
+type tailCall struct {
+	fn   *compiledFn
+	args []MalType
+	site *Position
+}
+
+// compiledFn is a function created by a fn form of a compiled Program
+type compiledFn struct {
+	params   MalType
+	exp      MalType
+	fixed    int
+	variadic bool
+	size     int
+	patterns []pattern
+	body     node
+	closure  *frame
+	cursor   *Position
+	// name is set by def (see [named]) or by a named fn
+	name string
+	// arities are the functions of a multi-arity fn
+	arities []*compiledFn
+}
+
+// arity returns the function of a multi-arity fn to call with n arguments
+func (f *compiledFn) arity(n int) (*compiledFn, error) {
+	var variadic *compiledFn
+	for _, arity := range f.arities {
+		if !arity.variadic && arity.fixed == n {
+			return arity, nil
+		}
+		if arity.variadic && n >= arity.fixed {
+			variadic = arity
+		}
+	}
+	if variadic == nil {
+		name := f.name
+		if name == "" {
+			name = "fn"
+		}
+		return nil, lisperror.NewLispError(fmt.Errorf("wrong number of arguments (%d) passed to %s", n, name), f.cursor)
+	}
+	return variadic, nil
+}
+
+func (f *compiledFn) bind(ctx context.Context, args []MalType) (*frame, error) {
+	binds := f.fixed
+	if f.variadic {
+		binds += 2
+	}
+	if len(args) < f.fixed {
+		return nil, lisperror.NewLispError(fmt.Errorf("too few arguments passed (%d binds, %d arguments passed)", binds, len(args)), f.cursor)
+	}
+	if !f.variadic && len(args) > f.fixed {
+		return nil, lisperror.NewLispError(fmt.Errorf("too many arguments passed (%d binds, %d arguments passed)", binds, len(args)), f.cursor)
+	}
+	fr := &frame{
+		vals: make([]MalType, f.size),
+		up:   f.closure,
+		env:  f.closure.env,
+	}
+	copy(fr.vals, args[:f.fixed])
+	if f.variadic {
+		fr.vals[f.fixed] = List{Val: args[f.fixed:]}
+	}
+	for _, p := range f.patterns {
+		if err := p.bind(ctx, fr, fr.vals[p.arg]); err != nil {
+			return nil, err
+		}
+	}
+	return fr, nil
+}
+
+// pattern is a destructuring pattern (see [Destructure]) bound to local slots
+type pattern struct {
+	pattern MalType
+	slots   map[string]int
+	// defaults are the compiled :or defaults of the symbols of the pattern
+	defaults map[string]node
+	// arg is the slot of the destructured parameter of a fn
+	arg int
+}
+
+func (c compiler) newPattern(p MalType, sc *scope) (pattern, error) {
+	symbols, err := PatternSymbols(p)
+	if err != nil {
+		return pattern{}, err
+	}
+	slots := make(map[string]int, len(symbols))
+	for _, sym := range symbols {
+		if _, ok := slots[sym.Val]; !ok {
+			slots[sym.Val] = sc.add(sym.Val)
+		}
+	}
+	// defaults see the symbols of the pattern
+	defaults := map[string]node{}
+	if err := PatternDefaults(p, func(sym Symbol, expr MalType) error {
+		n, err := c.compile(expr, sc, false)
+		defaults[sym.Val] = n
+		return err
+	}); err != nil {
+		return pattern{}, err
+	}
+	return pattern{pattern: p, slots: slots, defaults: defaults}, nil
+}
+
+func (p pattern) bind(ctx context.Context, fr *frame, value MalType) error {
+	return Destructure(p.pattern, value, func(sym Symbol, v MalType) {
+		fr.vals[p.slots[sym.Val]] = v
+	}, func(sym Symbol, _ MalType) (MalType, error) {
+		return p.defaults[sym.Val](ctx, fr)
+	})
+}
+
+// Call runs the function and the calls it makes in tail position
+func (f *compiledFn) Call(ctx context.Context, args []MalType) (MalType, error) {
+	return f.call(ctx, args, f.cursor)
+}
+
+// call runs the function called at site, recording the function running on error stacks
+func (f *compiledFn) call(ctx context.Context, args []MalType, site *Position) (MalType, error) {
+	ctx, err := enter(ctx, f.exp)
+	if err != nil {
+		return nil, lisperror.AddFrame(err, f.name, site)
+	}
+	for {
+		name := f.name
+		if f.arities != nil {
+			arity, err := f.arity(len(args))
+			if err != nil {
+				return nil, lisperror.AddFrame(err, name, site)
+			}
+			f = arity
+		}
+		fr, err := f.bind(ctx, args)
+		if err != nil {
+			return nil, lisperror.AddFrame(err, name, site)
+		}
+		res, err := f.body(ctx, fr)
+		if err != nil {
+			return nil, lisperror.AddFrame(err, name, site)
+		}
+		tc, ok := res.(tailCall)
+		if !ok {
+			return res, nil
+		}
+		f, args, site = tc.fn, tc.args, tc.site
+	}
+}
+
+func (f *compiledFn) LispPrint(Pr_str func(MalType, bool) string) string {
+	if f.arities != nil {
+		str := "(fn"
+		for _, arity := range f.arities {
+			str += " (" + Pr_str(arity.params, true) + " " + Pr_str(arity.exp, true) + ")"
+		}
+		return str + ")"
+	}
+	return "(fn " + Pr_str(f.params, true) + " " + Pr_str(f.exp, true) + ")"
+}
+
+func (f *compiledFn) Type() string {
+	return "function"
+}
+
+// Compile macroexpands and analyses ast once, returning a Program that
+// evaluates it as [EVAL] would do.
+//
+// Locals (let, fn and catch bindings) are resolved at compile time, and special forms
+// are dispatched once. Globals are resolved at run time on each run environment, that is
+// subordinate of env. Macros must be defined on env before compiling.
+func Compile(ast MalType, env EnvType) (Program, error) {
+	c := compiler{env: env, loop: -1}
+	root, err := c.compile(ast, nil, true)
+	if err != nil {
+		return Program{}, err
+	}
+	return Program{root: root, env: env}, nil
+}
+
+// Run evaluates the program on a new environment subordinate of the compile environment.
+// bindings are set on the new environment before running (and shadow the compile environment ones).
+// Symbols defined by the program are kept on the run environment only.
+//
+// Run is safe for concurrent use.
+func (p Program) Run(ctx context.Context, bindings map[string]MalType) (MalType, error) {
+	runEnv := NewSubordinateEnv(p.env)
+	for k, v := range bindings {
+		runEnv.Set(Symbol{Val: k}, v)
+	}
+	res, err := p.root(ctx, &frame{env: runEnv})
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := res.(tailCall); ok {
+		return tc.fn.call(ctx, tc.args, tc.site)
+	}
+	return res, nil
+}
+
+type compiler struct {
+	env EnvType
+	// loop is the number of bindings of the loop a recur in tail position jumps to, -1 if none
+	loop int
+}
+
+func (c compiler) compile(ast MalType, sc *scope, tail bool) (node, error) {
+	switch ast := ast.(type) {
+	case Symbol:
+		return c.compileSymbol(ast, sc), nil
+	case Vector:
+		elems, err := c.compileAll(ast.Slice(), sc)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, fr *frame) (MalType, error) {
+			lst, err := run(ctx, fr, elems)
+			if err != nil {
+				return nil, err
+			}
+			return NewVector(lst...), nil
+		}, nil
+	case HashMap:
+		// keys and values, in pairs
+		entries := make([]node, 0, 2*ast.Len())
+		for _, k := range ast.OrderedKeys(Insertion) {
+			v, _ := ast.Get(k)
+			key, err := c.compile(k, sc, false)
+			if err != nil {
+				return nil, err
+			}
+			value, err := c.compile(v, sc, false)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, key, value)
+		}
+		return func(ctx context.Context, fr *frame) (MalType, error) {
+			hm := HashMap{}
+			for i := 0; i < len(entries); i += 2 {
+				k, err := entries[i](ctx, fr)
+				if err != nil {
+					return nil, err
+				}
+				v, err := entries[i+1](ctx, fr)
+				if err != nil {
+					return nil, err
+				}
+				hm = hm.Assoc(k, v)
+			}
+			return hm, nil
+		}, nil
+	case List:
+		return c.compileList(ast, sc, tail)
+	default:
+		return constant(ast), nil
+	}
+}
+
+func constant(value MalType) node {
+	return func(context.Context, *frame) (MalType, error) {
+		return value, nil
+	}
+}
+
+func (c compiler) compileSymbol(sym Symbol, sc *scope) node {
+	depth, index, ok := sc.resolve(sym.Val)
+	switch {
+	case !ok:
+		return func(ctx context.Context, fr *frame) (MalType, error) {
+			value, err := Lookup(ctx, fr.env, sym)
+			if err != nil {
+				return nil, lisperror.NewLispError(err, sym)
+			}
+			return value, nil
+		}
+	case depth == 0:
+		return func(_ context.Context, fr *frame) (MalType, error) {
+			return fr.vals[index], nil
+		}
+	default:
+		return func(_ context.Context, fr *frame) (MalType, error) {
+			return fr.at(depth).vals[index], nil
+		}
+	}
+}
+
+func (c compiler) compileAll(asts []MalType, sc *scope) ([]node, error) {
+	nodes := make([]node, len(asts))
+	for i, ast := range asts {
+		var err error
+		if nodes[i], err = c.compile(ast, sc, false); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// compileBody compiles a sequence of forms returning the value of the last one (as do)
+func (c compiler) compileBody(asts []MalType, sc *scope, tail bool) (node, error) {
+	if len(asts) == 0 {
+		return constant(nil), nil
+	}
+	nodes, err := c.compileAll(asts[:len(asts)-1], sc)
+	if err != nil {
+		return nil, err
+	}
+	last, err := c.compile(asts[len(asts)-1], sc, tail)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return last, nil
+	}
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		for _, n := range nodes {
+			if _, err := n(ctx, fr); err != nil {
+				return nil, err
+			}
+		}
+		return last(ctx, fr)
+	}, nil
+}
+
+func run(ctx context.Context, fr *frame, nodes []node) ([]MalType, error) {
+	values := make([]MalType, len(nodes))
+	for i, n := range nodes {
+		var err error
+		if values[i], err = n(ctx, fr); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// macro returns the macro called by ast, if any. Locals shadow macros.
+func (c compiler) macro(ast List, sc *scope) (MalFunc, bool) {
+	sym, ok := ast.Val[0].(Symbol)
+	if !ok {
+		return MalFunc{}, false
+	}
+	if _, _, local := sc.resolve(sym.Val); local || c.env.Find(sym) == nil {
+		return MalFunc{}, false
+	}
+	value, err := c.env.Get(sym)
+	if err != nil {
+		return MalFunc{}, false
+	}
+	mac, ok := value.(MalFunc)
+	return mac, ok && mac.GetMacro()
+}
+
+func (c compiler) compileList(ast List, sc *scope, tail bool) (node, error) {
+	if len(ast.Val) == 0 {
+		return constant(ast), nil
+	}
+	if mac, ok := c.macro(ast, sc); ok {
+		expanded, err := Apply(context.Background(), mac, ast.Val[1:])
+		if err != nil {
+			return nil, err
+		}
+		return c.compile(expanded, sc, tail)
+	}
+
+	var a1, a2 MalType
+	if len(ast.Val) > 1 {
+		a1 = ast.Val[1]
+	}
+	if len(ast.Val) > 2 {
+		a2 = ast.Val[2]
+	}
+	switch first(ast) {
+	case "def":
+		return c.compileDef(ast, a1, a2, sc)
+	case "let":
+		return c.compileLet(ast, a1, sc, tail)
+	case "loop":
+		return c.compileLoop(ast, a1, sc, tail)
+	case "binding":
+		return c.compileBinding(ast, a1, sc)
+	case "recur":
+		return c.compileRecur(ast, sc, tail)
+	case "quote":
+		return constant(a1), nil
+	case "quasiquoteexpand":
+		expanded, err := quasiquote(a1)
+		if err != nil {
+			return nil, err
+		}
+		return constant(expanded), nil
+	case "quasiquote":
+		expanded, err := quasiquote(a1)
+		if err != nil {
+			return nil, err
+		}
+		return c.compile(expanded, sc, tail)
+	case "try":
+		return c.compileTry(ast, sc)
+	case "do":
+		return c.compileBody(ast.Val[1:], sc, tail)
+	case "if":
+		return c.compileIf(ast, sc, tail)
+	case "fn":
+		return c.compileFn(ast, sc)
+	case "defmacro", "macroexpand":
+		// evaluated on each run, macros must be defined before compiling to be expanded
+		return c.interpreted(ast, sc), nil
+	default:
+		return c.compileCall(ast, sc, tail)
+	}
+}
+
+// interpreted returns a node that evaluates ast with [EVAL] on an environment
+// with the locals visible by ast
+func (c compiler) interpreted(ast MalType, sc *scope) node {
+	if sc == nil {
+		return func(ctx context.Context, fr *frame) (MalType, error) {
+			return EVAL(ctx, ast, fr.env)
+		}
+	}
+	sc = sc.snapshot()
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		env := NewSubordinateEnv(fr.env)
+		var bind func(sc *scope, fr *frame)
+		bind = func(sc *scope, fr *frame) {
+			if sc == nil {
+				return
+			}
+			bind(sc.up, fr.up)
+			for i, name := range sc.names {
+				env.Set(Symbol{Val: name}, fr.vals[i])
+			}
+		}
+		bind(sc, fr)
+		return EVAL(ctx, ast, env)
+	}
+}
+
+func (c compiler) compileDef(ast List, a1, a2 MalType, sc *scope) (node, error) {
+	sym, meta, err := defSymbol(a1)
+	if err != nil {
+		return nil, lisperror.NewLispError(err, ast)
+	}
+	private, dynamic := flag(meta, "ʞprivate"), flag(meta, "ʞdynamic")
+	value, err := c.compile(a2, sc, false)
+	if err != nil {
+		return nil, err
+	}
+	if sc == nil {
+		return func(ctx context.Context, fr *frame) (MalType, error) {
+			v, err := value(ctx, fr)
+			if err != nil {
+				return nil, err
+			}
+			if private {
+				SetPrivate(fr.env, sym.Val)
+			}
+			if dynamic {
+				SetDynamic(fr.env, sym.Val)
+			}
+			return fr.env.Set(sym, named(v, sym.Val)), nil
+		}, nil
+	}
+	// def inside let, fn or catch defines a local, as EVAL defines it on the local environment
+	index := sc.add(sym.Val)
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		v, err := value(ctx, fr)
+		if err != nil {
+			return nil, err
+		}
+		v = named(v, sym.Val)
+		fr.vals[index] = v
+		return v, nil
+	}, nil
+}
+
+// binding is a compiled binding of a let or loop: value is bound to the slot index of the frame, or to pattern if index is -1
+type binding struct {
+	index   int
+	pattern pattern
+	value   node
+}
+
+func (b binding) bind(ctx context.Context, fr *frame, v MalType) error {
+	if b.index < 0 {
+		return b.pattern.bind(ctx, fr, v)
+	}
+	fr.vals[b.index] = v
+	return nil
+}
+
+// compileBindings compiles the binding vector a1 of a let or loop (form) adding its locals to sc
+func (c compiler) compileBindings(form string, a1 MalType, sc *scope) ([]binding, error) {
+	forms, err := GetSlice(a1)
+	if err != nil {
+		return nil, err
+	}
+	if len(forms)%2 != 0 {
+		return nil, lisperror.NewLispError(fmt.Errorf("%s: odd elements on binding vector", form), a1)
+	}
+	bindings := make([]binding, 0, len(forms)/2)
+	for i := 0; i < len(forms); i += 2 {
+		if _, ok := forms[i].(Symbol); !ok && !Q[Vector](forms[i]) && !Q[HashMap](forms[i]) {
+			return nil, lisperror.NewLispError(errors.New("non-symbol bind value"), a1)
+		}
+		value, err := c.compile(forms[i+1], sc, false)
+		if err != nil {
+			return nil, err
+		}
+		if sym, ok := forms[i].(Symbol); ok {
+			bindings = append(bindings, binding{index: sc.add(sym.Val), value: value})
+			continue
+		}
+		p, err := c.newPattern(forms[i], sc)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, binding{index: -1, pattern: p, value: value})
+	}
+	return bindings, nil
+}
+
+func (c compiler) compileLet(ast List, a1 MalType, sc *scope, tail bool) (node, error) {
+	letScope := &scope{up: sc}
+	bindings, err := c.compileBindings("let", a1, letScope)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.compileBody(ast.Val[2:], letScope, tail)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		letFrame := &frame{
+			vals: make([]MalType, len(letScope.names)),
+			up:   fr,
+			env:  fr.env,
+		}
+		for _, b := range bindings {
+			v, err := b.value(ctx, letFrame)
+			if err != nil {
+				return nil, err
+			}
+			if err := b.bind(ctx, letFrame, v); err != nil {
+				return nil, err
+			}
+		}
+		return body(ctx, letFrame)
+	}, nil
+}
+
+// recurValues is returned by a recur and resolved by its loop (see [compiler.compileLoop])
+type recurValues []MalType
+
+func (c compiler) compileLoop(ast List, a1 MalType, sc *scope, tail bool) (node, error) {
+	loopScope := &scope{up: sc}
+	bindings, err := c.compileBindings("loop", a1, loopScope)
+	if err != nil {
+		return nil, err
+	}
+	// the body is compiled in tail position to accept recur, and the tail calls
+	// of a loop that is not in tail position are resolved by the loop
+	c.loop = len(bindings)
+	body, err := c.compileBody(ast.Val[2:], loopScope, true)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		// each iteration gets a new frame, as closures might capture the bindings
+		loopFrame := &frame{
+			vals: make([]MalType, len(loopScope.names)),
+			up:   fr,
+			env:  fr.env,
+		}
+		for _, b := range bindings {
+			v, err := b.value(ctx, loopFrame)
+			if err != nil {
+				return nil, err
+			}
+			if err := b.bind(ctx, loopFrame, v); err != nil {
+				return nil, err
+			}
+		}
+		for {
+			res, err := body(ctx, loopFrame)
+			if err != nil {
+				return nil, err
+			}
+			switch res := res.(type) {
+			case recurValues:
+				if ctx != nil {
+					select {
+					case <-ctx.Done():
+						return nil, lisperror.NewLispError(errors.New("timeout while evaluating expression"), ast)
+					default:
+					}
+				}
+				if err := step(ctx, ast); err != nil {
+					return nil, err
+				}
+				loopFrame = &frame{
+					vals: make([]MalType, len(loopScope.names)),
+					up:   fr,
+					env:  fr.env,
+				}
+				for i, b := range bindings {
+					if err := b.bind(ctx, loopFrame, res[i]); err != nil {
+						return nil, err
+					}
+				}
+			case tailCall:
+				if tail {
+					return res, nil
+				}
+				return res.fn.call(ctx, res.args, res.site)
+			default:
+				return res, nil
+			}
+		}
+	}, nil
+}
+
+// compileRecur checks that recur is in tail position of a loop and passes it as many values as the loop bindings
+func (c compiler) compileRecur(ast List, sc *scope, tail bool) (node, error) {
+	if !tail || c.loop < 0 {
+		return nil, lisperror.NewLispError(errors.New("recur can only be used in tail position of a loop"), ast)
+	}
+	if len(ast.Val)-1 != c.loop {
+		return nil, lisperror.NewLispError(fmt.Errorf("wrong number of arguments (%d) passed to recur, expected %d", len(ast.Val)-1, c.loop), ast)
+	}
+	args, err := c.compileAll(ast.Val[1:], sc)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		values, err := run(ctx, fr, args)
+		if err != nil {
+			return nil, err
+		}
+		return recurValues(values), nil
+	}, nil
+}
+
+// compileBinding binds dynamic vars on the context of its body, that is not in tail position
+// as the bindings end when it returns
+func (c compiler) compileBinding(ast List, a1 MalType, sc *scope) (node, error) {
+	forms, err := GetSlice(a1)
+	if err != nil {
+		return nil, err
+	}
+	if len(forms)%2 != 0 {
+		return nil, lisperror.NewLispError(errors.New("binding: odd elements on binding vector"), a1)
+	}
+	syms := make([]Symbol, 0, len(forms)/2)
+	values := make([]node, 0, len(forms)/2)
+	for i := 0; i < len(forms); i += 2 {
+		sym, ok := forms[i].(Symbol)
+		if !ok {
+			return nil, lisperror.NewLispError(errors.New("non-symbol bind value"), a1)
+		}
+		if _, _, local := sc.resolve(sym.Val); local {
+			return nil, lisperror.NewLispError(fmt.Errorf("can't dynamically bind non-dynamic var %s", sym.Val), sym)
+		}
+		value, err := c.compile(forms[i+1], sc, false)
+		if err != nil {
+			return nil, err
+		}
+		syms = append(syms, sym)
+		values = append(values, value)
+	}
+	c.loop = -1
+	body, err := c.compileBody(ast.Val[2:], sc, false)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		bindings := make(map[Var]MalType, len(syms))
+		for i, sym := range syms {
+			v, err := LookupVar(fr.env, sym)
+			if err != nil {
+				return nil, lisperror.NewLispError(err, sym)
+			}
+			if bindings[v], err = values[i](ctx, fr); err != nil {
+				return nil, err
+			}
+		}
+		return body(WithBindings(ctx, bindings), fr)
+	}, nil
+}
+
+func (c compiler) compileIf(ast List, sc *scope, tail bool) (node, error) {
+	var forms [3]MalType
+	copy(forms[:], ast.Val[1:])
+	var nodes [3]node
+	for i, form := range forms {
+		var err error
+		if nodes[i], err = c.compile(form, sc, tail && i > 0); err != nil {
+			return nil, err
+		}
+	}
+	cond, then, otherwise := nodes[0], nodes[1], nodes[2]
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		v, err := cond(ctx, fr)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil || v == false {
+			return otherwise(ctx, fr)
+		}
+		return then(ctx, fr)
+	}, nil
+}
+
+func (c compiler) compileFn(ast List, sc *scope) (node, error) {
+	name, clauses, err := parseFn(ast)
+	if err != nil {
+		return nil, err
+	}
+	if name != nil {
+		// the fn name is bound to itself on its body
+		sc = &scope{names: []string{name.Val}, up: sc}
+	}
+	// recur can't jump out of a fn
+	c.loop = -1
+	arities := make([]*compiledFn, 0, len(clauses))
+	for _, clause := range clauses {
+		arity, err := c.compileArity(ast, clause, sc)
+		if err != nil {
+			return nil, err
+		}
+		arities = append(arities, arity)
+	}
+	return func(_ context.Context, fr *frame) (MalType, error) {
+		closure := fr
+		if name != nil {
+			closure = &frame{vals: make([]MalType, 1), up: fr, env: fr.env}
+		}
+		fns := make([]*compiledFn, len(arities))
+		for i, arity := range arities {
+			fn := *arity
+			fn.closure = closure
+			fns[i] = &fn
+		}
+		f := fns[0]
+		if len(fns) > 1 {
+			f = &compiledFn{arities: fns, cursor: ast.Cursor}
+		}
+		if name != nil {
+			f.name = name.Val
+			closure.vals[0] = f
+		}
+		return f, nil
+	}, nil
+}
+
+// compileArity returns the function (with no closure) of a fn clause
+func (c compiler) compileArity(ast List, clause fnClause, sc *scope) (*compiledFn, error) {
+	params, err := GetSlice(clause.params)
+	if err != nil {
+		return nil, lisperror.NewLispError(err, ast)
+	}
+	fnScope := &scope{up: sc}
+	fixed, variadic := 0, false
+	// destructured parameters are bound to hidden slots, and their patterns to the slots following the parameters
+	var destructured []MalType
+	for i := 0; i < len(params); i++ {
+		param := params[i]
+		if sym, ok := param.(Symbol); ok && sym.Val == "&" {
+			if i != len(params)-2 {
+				return nil, lisperror.NewLispError(errors.New("& must be followed by a single pattern"), ast)
+			}
+			param = params[i+1]
+			variadic = true
+		}
+		switch param := param.(type) {
+		case Symbol:
+			fnScope.add(param.Val)
+		case Vector, HashMap:
+			fnScope.add("")
+		default:
+			return nil, lisperror.NewLispError(errors.New("non-symbol bind value"), ast)
+		}
+		destructured = append(destructured, param)
+		if variadic {
+			break
+		}
+		fixed++
+	}
+	var patterns []pattern
+	for i, param := range destructured {
+		if Q[Symbol](param) {
+			continue
+		}
+		p, err := c.newPattern(param, fnScope)
+		if err != nil {
+			return nil, err
+		}
+		p.arg = i
+		patterns = append(patterns, p)
+	}
+	body, err := c.compileBody(clause.body, fnScope, true)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledFn{
+		params:   clause.params,
+		exp:      List{Val: append([]MalType{Symbol{Val: "do"}}, clause.body...)},
+		fixed:    fixed,
+		variadic: variadic,
+		// locals defined on the body are known once the body is compiled
+		size:     len(fnScope.names),
+		patterns: patterns,
+		body:     body,
+		cursor:   ast.Cursor,
+	}, nil
+}
+
+func (c compiler) compileTry(ast List, sc *scope) (node, error) {
+	body, catches, finally, err := parseTry(ast)
+	if err != nil {
+		return nil, err
+	}
+	tryDo, err := c.compileBody(body, sc, false)
+	if err != nil {
+		return nil, err
+	}
+	var finallyDo node
+	if finally != nil {
+		if finallyDo, err = c.compileBody(finally, sc, false); err != nil {
+			return nil, err
+		}
+	}
+	type compiledCatch struct {
+		clause   catchClause
+		selector node // nil catches every error
+		size     int
+		body     node
+	}
+	compiledCatches := make([]compiledCatch, 0, len(catches))
+	for _, clause := range catches {
+		cc := compiledCatch{clause: clause}
+		if clause.selector != nil {
+			if cc.selector, err = c.compile(clause.selector, sc, false); err != nil {
+				return nil, err
+			}
+		}
+		catchScope := &scope{up: sc}
+		catchScope.add(clause.bind.Val)
+		if cc.body, err = c.compileBody(clause.body, catchScope, false); err != nil {
+			return nil, err
+		}
+		cc.size = len(catchScope.names)
+		compiledCatches = append(compiledCatches, cc)
+	}
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		if finallyDo != nil {
+			defer func() { _, _ = finallyDo(ctx, fr) }()
+		}
+		exp, e := func() (res MalType, err error) {
+			defer malRecover(&err)
+			if dl, ok := ctx.Deadline(); ok {
+				// give 80% of the time to the try, and the remaining 20% to the catch + finally
+				timeout := (time.Until(dl) / 10) * 8
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				return tryDo(ctx, fr)
+			}
+			return tryDo(ctx, fr)
+		}()
+		if e == nil {
+			return exp, nil
+		}
+		if uncatchable(e) {
+			return nil, e
+		}
+		caught := caughtValue(e)
+		for _, cc := range compiledCatches {
+			if cc.selector != nil {
+				selector, err := cc.selector(ctx, fr)
+				if err != nil {
+					return nil, err
+				}
+				selected, err := selects(ctx, selector, caught, cc.clause.form)
+				if err != nil {
+					return nil, err
+				}
+				if !selected {
+					continue
+				}
+			}
+			catchFrame := &frame{
+				vals: make([]MalType, cc.size),
+				up:   fr,
+				env:  fr.env,
+			}
+			catchFrame.vals[0] = caught
+			return cc.body(ctx, catchFrame)
+		}
+		return nil, e
+	}, nil
+}
+
+func (c compiler) compileCall(ast List, sc *scope, tail bool) (node, error) {
+	head, err := c.compile(ast.Val[0], sc, false)
+	if err != nil {
+		return nil, err
+	}
+	args, err := c.compileAll(ast.Val[1:], sc)
+	if err != nil {
+		return nil, err
+	}
+	// used if the function happens to be a macro defined after compiling
+	interpreted := c.interpreted(ast, sc)
+	return func(ctx context.Context, fr *frame) (MalType, error) {
+		if ctx != nil {
+			select {
+			case <-ctx.Done():
+				return nil, lisperror.NewLispError(errors.New("timeout while evaluating expression"), ast)
+			default:
+			}
+		}
+		if err := step(ctx, ast); err != nil {
+			return nil, err
+		}
+		f, err := head(ctx, fr)
+		if err != nil {
+			return nil, err
+		}
+		values, err := run(ctx, fr, args)
+		if err != nil {
+			return nil, err
+		}
+		switch f := f.(type) {
+		case *compiledFn:
+			if tail {
+				return tailCall{fn: f, args: values, site: ast.Cursor}, nil
+			}
+			return f.call(ctx, values, ast.Cursor)
+		case Func:
+			result, err := f.Fn(ctx, values)
+			if err != nil {
+				return nil, lisperror.NewLispError(err, ast)
+			}
+			if err := checkSize(ctx, result, ast); err != nil {
+				return nil, err
+			}
+			return result, nil
+		case MalFunc:
+			if f.GetMacro() {
+				return interpreted(ctx, fr)
+			}
+			return Apply(ctx, f, values)
+		case Callable:
+			result, err := f.Call(ctx, values)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkSize(ctx, result, ast); err != nil {
+				return nil, err
+			}
+			return result, nil
+		default:
+			return nil, lisperror.NewLispError(fmt.Errorf("attempt to call non-function (was of type %T)", f), ast)
+		}
+	}, nil
+}
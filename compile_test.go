@@ -0,0 +1,283 @@
+package lisp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/jig/lisp/env"
+	"github.com/jig/lisp/types"
+)
+
+func compileString(t testing.TB, env types.EnvType, code string) Program {
+	t.Helper()
+	ast, err := READ(code, types.NewCursorFile(t.Name()), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prg, err := Compile(ast, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prg
+}
+
+func TestCompileSameAsEVAL(t *testing.T) {
+	for _, code := range []string{
+		`(+ 1 2)`,
+		`[1 (+ 1 1) {:a (* 2 3)}]`,
+		`(let [a 1 b (+ a 1) a (* b 10)] [a b])`,
+		`(let [f (fn [x & more] (list x more))] (f 1 2 3))`,
+		`((fn [a] ((fn [b] (+ a b)) 2)) 1)`,
+		`(let [a 1] (def b (+ a 1)) (+ a b))`,
+		`(do (def x 10) (def inc10 (fn [y] (+ x y))) (inc10 5))`,
+		`(if nil 1 2)`,
+		`(if false 1)`,
+		"(let [a 1] `(a ~a ~@(list 2 3)))",
+		`(try (throw "boom") (catch e (str "caught " e)))`,
+		`(try (+ 1 1) (catch e e) (finally 3))`,
+		`(let [a (atom 0)] (try (throw 1) (catch e (swap! a (fn [x] (+ x 1)))) (finally (swap! a (fn [x] (+ x 1))))) @a)`,
+		`(cond false 1 nil 2 :else 3)`,
+		`(map (fn [x] (* x x)) [1 2 3])`,
+		`(let [not 1] not)`,
+		`(do (defmacro unless (fn [c a b] (list 'if c b a))) (unless false 1 2))`,
+		`(let [count-down (fn [n] (if (= n 0) :done (count-down (- n 1))))] 1)`,
+		`(fn? (fn [] 1))`,
+		`(try (throw "boom") (catch "go-error" e :go-error) (catch "string" e [:string e]))`,
+		`(try (throw (ex-info "invalid" {:type :validation})) (catch :not-found e 1) (catch :validation e (ex-message e)))`,
+		`(let [limit 40] (try (throw 42) (catch (fn [x] (> x limit)) e :big) (catch e :small)))`,
+		`(try (try (throw "boom") (catch number? e :number)) (catch e [:rethrown e]))`,
+		`(let [[a [b c] & more :as all] [1 [2 3] 4 5]] [a b c more all])`,
+		`(let [{:keys [a b] :or {b 10} :as m} {:a 1}] [a b (get m :a)])`,
+		`(let [x 5 {:keys [a b] :or {b (+ x 1)}} {:a 1}] [a b])`,
+		`((fn [{a :a :keys [b] :or {b (* 2 a)}}] [a b]) {:a 3})`,
+		`(loop [{:keys [i] :or {i 0}} {}] (if (< i 3) (recur {:i (+ i 1)}) i))`,
+		`((fn [[a b] {:keys [c]} & [d]] [a b c d]) [1 2] {:c 3} 4)`,
+		`(let [f (fn [{:strs [x]}] x)] (map f [{"x" 1} {"x" 2}]))`,
+		`((fn fact [n] (if (< n 2) 1 (* n (fact (- n 1))))) 5)`,
+		`(let [f (fn ([] 0) ([x] x) ([x y & more] (list x y more)))] [(f) (f 1) (f 1 2) (f 1 2 3)])`,
+		`((fn fib ([n] (fib n 0 1)) ([n a b] (if (= n 0) a (fib (- n 1) b (+ a b))))) 10)`,
+		`(do (defn add ([x] x) ([x y] (+ x y))) (add 1 2))`,
+		`(loop [i 0 acc 0] (if (< i 1000) (recur (+ i 1) (+ acc i)) acc))`,
+		`(loop [[x & xs] [1 2 3] acc []] (if x (recur xs (conj acc (* x x))) acc))`,
+		`(let [fs (loop [i 0 acc []] (if (< i 3) (recur (+ i 1) (conj acc (fn [] i))) acc))] (map (fn [f] (f)) fs))`,
+		`(+ 1 (loop [i 0] (if (< i 3) (recur (+ i 1)) ((fn [x] x) i))))`,
+		`(loop [i 0] (cond (> i 5) i :else (recur (+ i 1))))`,
+		`(do (def ^:dynamic *x* 1) (defn x [] *x*) [(x) (binding [*x* 2] [(x) (binding [*x* (+ *x* 1)] (x))]) (x)])`,
+		`(do (def ^:dynamic *x* 1) (let [f (binding [*x* 2] (fn [] *x*))] [(f) (binding [*x* 3] (f))]))`,
+		`(let [code 404] (get {code "not found" [code :get] :tuple} [404 :get]))`,
+	} {
+		t.Run(code, func(t *testing.T) {
+			ctx := context.Background()
+			expected, err := REPL(ctx, newEnv(t.Name()), code, types.NewCursorFile(t.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := newEnv(t.Name())
+			res, err := compileString(t, env, code).Run(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if PRINT(res) != expected {
+				t.Fatalf("expected %s got %s", expected, PRINT(res))
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for code, expected := range map[string]string{
+		`(undefined-symbol 1)`:             "symbol 'undefined-symbol' not found",
+		`((fn [a b] a) 1)`:                 "too few arguments passed (2 binds, 1 arguments passed)",
+		`((fn [a] a) 1 2)`:                 "too many arguments passed (1 binds, 2 arguments passed)",
+		`(try (throw "boom"))`:             "boom",
+		`(1 2)`:                            "attempt to call non-function (was of type int)",
+		`(let [a] a)`:                      "let: odd elements on binding vector",
+		`(def 1 2)`:                        "cannot use 'int' as identifier",
+		`(let [f (fn [] (f))] (f))`:        "symbol 'f' not found",
+		`((fn ([a] a) ([a b] b)) 1 2 3)`:   "wrong number of arguments (3) passed to fn",
+		`(fn ([a & b] a) ([& c] c))`:       "fn can't have more than one variadic arity",
+		`(fn ([a] 1) ([b] 2))`:             "fn can't have 2 overloads with the same arity (1)",
+		`(do (def y 1) (binding [y 2] y))`: "can't dynamically bind non-dynamic var y",
+		`(let [z 1] (binding [z 2] z))`:    "can't dynamically bind non-dynamic var z",
+	} {
+		t.Run(code, func(t *testing.T) {
+			env := newEnv(t.Name())
+			ast, err := READ(code, types.NewCursorFile(t.Name()), env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prg, err := Compile(ast, env)
+			if err == nil {
+				_, err = prg.Run(context.Background(), nil)
+			}
+			if err == nil {
+				t.Fatal("error expected")
+			}
+			if !strings.Contains(err.Error(), expected) {
+				t.Fatalf("expected %q got %q", expected, err)
+			}
+		})
+	}
+}
+
+func TestCompileTailCalls(t *testing.T) {
+	env := newEnv(t.Name())
+	prg := compileString(t, env, `(do
+		(def even? (fn [n] (if (= n 0) true (odd? (- n 1)))))
+		(def odd? (fn [n] (if (= n 0) false (even? (- n 1)))))
+		(even? n))`)
+	res, err := prg.Run(context.Background(), map[string]types.MalType{"n": 1_000_000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != true {
+		t.Fatalf("expected true got %v", res)
+	}
+}
+
+func TestCompileRunIsolation(t *testing.T) {
+	env := newEnv(t.Name())
+	prg := compileString(t, env, `(do (def y (* x 2)) y)`)
+	if _, err := prg.Run(context.Background(), map[string]types.MalType{"x": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Get(types.Symbol{Val: "y"}); err == nil {
+		t.Fatal("definitions of a run must not leak to the compile environment")
+	}
+}
+
+func TestCompileConcurrentRuns(t *testing.T) {
+	env := newEnv(t.Name())
+	prg := compileString(t, env, `(let [sq (fn [v] (* v v))] (apply + (map sq (range 0 x))))`)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := prg.Run(context.Background(), map[string]types.MalType{"x": i})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			expected := 0
+			for v := 0; v < i; v++ {
+				expected += v * v
+			}
+			if res != expected {
+				t.Errorf("expected %d got %v", expected, res)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCompileTimeout(t *testing.T) {
+	env := newEnv(t.Name())
+	prg := compileString(t, env, `(do (def spin (fn [] (spin))) (spin))`)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := prg.Run(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), "timeout while evaluating expression") {
+		t.Fatalf("timeout expected, got %v", err)
+	}
+}
+
+const fibCode = `(do
+	(def fib (fn [n] (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))))
+	(fib n))`
+
+func BenchmarkEVALFib(b *testing.B) {
+	env := newEnv(b.Name())
+	ctx := context.Background()
+	ast, err := READ(fibCode, types.NewCursorFile(b.Name()), env)
+	if err != nil {
+		b.Fatal(err)
+	}
+	env.Set(types.Symbol{Val: "n"}, 15)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EVAL(ctx, ast, env); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledFib(b *testing.B) {
+	env := newEnv(b.Name())
+	ctx := context.Background()
+	prg := compileString(b, env, fibCode)
+	bindings := map[string]types.MalType{"n": 15}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := prg.Run(ctx, bindings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+const ruleCode = `(let [total (apply + (map (fn [item] (* (get item :price) (get item :qty))) (get order :items)))]
+	(cond
+		(> total 1000) :gold
+		(> total 100) :silver
+		:else :bronze))`
+
+var ruleOrder = types.NewHashMapFromMap(map[string]types.MalType{
+	types.NewKeyword("items"): types.NewVector([]types.MalType{
+		types.NewHashMapFromMap(map[string]types.MalType{types.NewKeyword("price"): 10, types.NewKeyword("qty"): 3}),
+		types.NewHashMapFromMap(map[string]types.MalType{types.NewKeyword("price"): 25, types.NewKeyword("qty"): 4}),
+	}...),
+})
+
+func BenchmarkEVALRule(b *testing.B) {
+	env := newEnv(b.Name())
+	ctx := context.Background()
+	ast, err := READ(ruleCode, types.NewCursorFile(b.Name()), env)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// same work as Program.Run: a fresh environment per evaluation
+		runEnv := newSubordinateEnvWith(env, "order", ruleOrder)
+		if _, err := EVAL(ctx, ast, runEnv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledRule(b *testing.B) {
+	env := newEnv(b.Name())
+	ctx := context.Background()
+	prg := compileString(b, env, ruleCode)
+	bindings := map[string]types.MalType{"order": ruleOrder}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := prg.Run(ctx, bindings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParallelCompiledRule(b *testing.B) {
+	env := newEnv(b.Name())
+	ctx := context.Background()
+	prg := compileString(b, env, ruleCode)
+	bindings := map[string]types.MalType{"order": ruleOrder}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := prg.Run(ctx, bindings); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func newSubordinateEnvWith(env types.EnvType, name string, value types.MalType) types.EnvType {
+	runEnv := NewSubordinateEnv(env)
+	runEnv.Set(types.Symbol{Val: name}, value)
+	return runEnv
+}
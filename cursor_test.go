@@ -58,7 +58,7 @@ func TestCursor(t *testing.T) {
 		{
 			Module: "codeUndefinedSymbol",
 			Code:   codeUndefinedSymbol,
-			Cursor: types.NewAnonymousCursorHere(3, 17),
+			Cursor: types.NewAnonymousCursorHere(3, 1),
 		},
 		{
 			Module: "codeLetIsBogus",
@@ -73,12 +73,12 @@ func TestCursor(t *testing.T) {
 		{
 			Module: "codeMissingRightBracket",
 			Code:   codeMissingRightBracket,
-			Cursor: types.NewAnonymousCursorHere(8, 2),
+			Cursor: types.NewAnonymousCursorHere(8, 1),
 		},
 		{
 			Module: "codeTooManyRightBrackets",
 			Code:   codeTooManyRightBrackets,
-			Cursor: types.NewAnonymousCursorHere(8, 28),
+			Cursor: types.NewAnonymousCursorHere(8, 27),
 		},
 	} {
 		subEnv := env.NewSubordinateEnv(bootEnv)
@@ -0,0 +1,97 @@
+package debugger
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jig/lisp/types"
+)
+
+// Breakpoint stops the debugger at the forms starting at Row of Module
+type Breakpoint struct {
+	Module string `json:"module"`
+	Row    int    `json:"row"`
+	// Condition is a Lisp expression evaluated on the environment of the form. The breakpoint
+	// is hit only if it is not nil nor false. Empty Condition is always true
+	Condition string `json:"condition,omitempty"`
+	// HitCount is the number of hits required to stop: the debugger stops
+	// on the HitCount-th hit and on the following ones. 0 stops on every hit
+	HitCount int `json:"hitCount,omitempty"`
+
+	hits int
+	// last is the last form that hit the breakpoint; forms inside it on the same line don't hit it again
+	last *types.Position
+}
+
+// Matches returns true if the form at pos starts at the breakpoint line
+func (bp *Breakpoint) Matches(pos *types.Position) bool {
+	if pos == nil || pos.Module == nil || !SameModule(*pos.Module, bp.Module) {
+		return false
+	}
+	line := types.Position{BeginRow: bp.Row, BeginCol: 1, Row: bp.Row, Col: math.MaxInt}
+	return line.Includes(types.Position{BeginRow: pos.BeginRow, BeginCol: pos.BeginCol, Row: pos.BeginRow, Col: pos.BeginCol})
+}
+
+// Hit returns true if the debugger must stop at the form at pos evaluated on ns.
+// Errors evaluating the condition are returned with true (the debugger should stop to show them).
+func (bp *Breakpoint) Hit(pos *types.Position, ns types.EnvType) (bool, error) {
+	if !bp.Matches(pos) {
+		return false, nil
+	}
+	if bp.last != nil && !samePlace(bp.last, pos) && bp.last.Includes(*pos) {
+		return false, nil
+	}
+	if bp.Condition != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		res, err := EvalWatch(ctx, bp.Condition, ns)
+		if err != nil {
+			return true, err
+		}
+		if res == nil || res == false {
+			return false, nil
+		}
+	}
+	bp.hits++
+	bp.last = pos
+	return bp.hits >= bp.HitCount, nil
+}
+
+// Hits returns the number of times the breakpoint has been hit (condition true)
+func (bp *Breakpoint) Hits() int {
+	return bp.hits
+}
+
+func samePlace(a, b *types.Position) bool {
+	return a.BeginRow == b.BeginRow && a.BeginCol == b.BeginCol && a.Row == b.Row && a.Col == b.Col
+}
+
+// SameModule returns true if both module names refer to the same source file
+func SameModule(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false
+	}
+	return absA == absB
+}
+
+func (bp *Breakpoint) String() string {
+	str := bp.Module + "§" + strconv.Itoa(bp.Row)
+	if bp.Condition != "" {
+		str += " if " + bp.Condition
+	}
+	if bp.HitCount > 0 {
+		str += " after " + strconv.Itoa(bp.HitCount) + " hits"
+	}
+	return str
+}
@@ -0,0 +1,117 @@
+package debugger
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/core/nscore"
+	"github.com/jig/lisp/types"
+)
+
+func nsWith(t *testing.T, n int) types.EnvType {
+	ns := env.NewEnv()
+	if err := nscore.Load(ns); err != nil {
+		t.Fatal(err)
+	}
+	ns.Set(types.Symbol{Val: "n"}, n)
+	return ns
+}
+
+func TestBreakpointMatches(t *testing.T) {
+	bp := &Breakpoint{Module: "./script.lisp", Row: 3}
+	module := "script.lisp"
+	for _, tc := range []struct {
+		pos     *types.Position
+		matches bool
+	}{
+		{types.NewCursorHere("script.lisp", 3, 5), true},
+		{&types.Position{Module: &module, BeginRow: 3, BeginCol: 1, Row: 5, Col: 10}, true},
+		{&types.Position{Module: &module, BeginRow: 2, BeginCol: 1, Row: 3, Col: 10}, false},
+		{types.NewCursorHere("other.lisp", 3, 5), false},
+		{types.NewAnonymousCursorHere(3, 5), false},
+		{nil, false},
+	} {
+		if bp.Matches(tc.pos) != tc.matches {
+			t.Fatalf("%s: expected %v", tc.pos, tc.matches)
+		}
+	}
+}
+
+func TestBreakpointCondition(t *testing.T) {
+	bp := &Breakpoint{Module: "script.lisp", Row: 1, Condition: "(> n 2)"}
+	pos := types.NewCursorHere("script.lisp", 1, 1)
+	for n, expected := range []bool{false, false, false, true, true} {
+		hit, err := bp.Hit(pos, nsWith(t, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hit != expected {
+			t.Fatalf("n=%d: expected %v", n, expected)
+		}
+	}
+	if bp.Hits() != 2 {
+		t.Fatalf("expected 2 hits got %d", bp.Hits())
+	}
+
+	bp = &Breakpoint{Module: "script.lisp", Row: 1, Condition: "(undefined-fn)"}
+	if hit, err := bp.Hit(pos, nsWith(t, 0)); !hit || err == nil {
+		t.Fatal("condition errors must stop the debugger")
+	}
+}
+
+func TestBreakpointHitCount(t *testing.T) {
+	bp := &Breakpoint{Module: "script.lisp", Row: 1, HitCount: 3}
+	pos := types.NewCursorHere("script.lisp", 1, 1)
+	for i, expected := range []bool{false, false, true, true} {
+		hit, err := bp.Hit(pos, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hit != expected {
+			t.Fatalf("hit %d: expected %v", i+1, expected)
+		}
+	}
+}
+
+func TestBreakpointNestedForms(t *testing.T) {
+	bp := &Breakpoint{Module: "script.lisp", Row: 1}
+	module := "script.lisp"
+	outer := &types.Position{Module: &module, BeginRow: 1, BeginCol: 1, Row: 1, Col: 20}
+	inner := &types.Position{Module: &module, BeginRow: 1, BeginCol: 5, Row: 1, Col: 15}
+	for _, tc := range []struct {
+		pos *types.Position
+		hit bool
+	}{
+		{outer, true},
+		{inner, false},
+		// the same form evaluated again (e.g. a loop) hits again
+		{outer, true},
+	} {
+		hit, err := bp.Hit(tc.pos, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hit != tc.hit {
+			t.Fatalf("%s: expected %v", tc.pos, tc.hit)
+		}
+	}
+}
+
+func TestConfigPersistsBreakpoints(t *testing.T) {
+	config := DebuggerConfig{
+		Exprs:       map[string]bool{"n": true},
+		Breakpoints: []*Breakpoint{{Module: "script.lisp", Row: 4, Condition: "(= n 1)", HitCount: 2}},
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded DebuggerConfig
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Breakpoints) != 1 || *decoded.Breakpoints[0] != *config.Breakpoints[0] {
+		t.Fatalf("unexpected breakpoints %s", raw)
+	}
+}
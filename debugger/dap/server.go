@@ -0,0 +1,613 @@
+// Package dap implements a Debug Adapter Protocol server for the Lisp debugger,
+// so Lisp scripts might be debugged from editors such as VS Code.
+//
+// The server supports launching a single script, file:line breakpoints, stepping
+// (in, next and out), stack frames, scopes (built from the environments of each frame)
+// and evaluation of watch expressions.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jig/lisp"
+	"github.com/jig/lisp/debugger"
+	"github.com/jig/lisp/debuggertypes"
+	"github.com/jig/lisp/types"
+)
+
+// threadID is the only thread reported: futures evaluated while debugging share it
+const threadID = 1
+
+// maxValueLength truncates printed values of variables
+const maxValueLength = 200
+
+type stepMode int
+
+const (
+	running stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+// frame is a form being evaluated
+type frame struct {
+	ast types.MalType
+	env types.EnvType
+	// pos is not nil if the form is on a source file (stop might happen on it)
+	pos *types.Position
+	// depth is the number of frames with pos on the stack up to this one
+	depth int
+}
+
+// Server is a Debug Adapter Protocol server debugging a single Lisp program
+type Server struct {
+	ns  types.EnvType
+	in  *bufio.Reader
+	out io.Writer
+
+	outMu sync.Mutex
+	seq   int
+
+	mu          sync.Mutex
+	program     string
+	breakpoints map[string][]*debugger.Breakpoint
+	stack       []frame
+	mode        stepMode
+	modeDepth   int
+	pause       bool
+	entry       bool
+	stopped     bool
+	resume      chan struct{}
+	handles     []interface{}
+	cancel      context.CancelFunc
+	// sources caches the absolute path of modules ("" if the module is not a file)
+	sources map[string]string
+}
+
+// NewServer returns a server reading requests from r and writing responses and events to w.
+// Programs are evaluated on ns.
+func NewServer(r io.Reader, w io.Writer, ns types.EnvType) *Server {
+	return &Server{
+		ns:          ns,
+		in:          bufio.NewReader(r),
+		out:         w,
+		breakpoints: map[string][]*debugger.Breakpoint{},
+		resume:      make(chan struct{}),
+		sources:     map[string]string{},
+	}
+}
+
+// ServeStdio serves a debugging session on the standard input and output.
+// Output of the program is sent to the client as output events.
+func ServeStdio(ns types.EnvType) error {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+		w.Close()
+	}()
+
+	s := NewServer(os.Stdin, stdout, ns)
+	go s.forwardOutput(r, "stdout")
+	return s.Serve()
+}
+
+// ListenAndServe serves a debugging session to the first client connecting to addr (e.g. "localhost:4711")
+func ListenAndServe(addr string, ns types.EnvType) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	fmt.Fprintf(os.Stderr, "DAP server listening on %s\n", l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return NewServer(conn, conn, ns).Serve()
+}
+
+// Serve processes requests till the client disconnects
+func (s *Server) Serve() error {
+	for {
+		content, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		body, err := s.handle(&req)
+		if err != nil {
+			s.send(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: err.Error()})
+			continue
+		}
+		s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+
+		switch req.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "configurationDone":
+			s.start()
+		case "continue", "next", "stepIn", "stepOut":
+			s.continueProgram()
+		case "disconnect":
+			s.disconnect()
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest":  true,
+			"supportsEvaluateForHovers":         true,
+			"supportsConditionalBreakpoints":    true,
+			"supportsHitConditionalBreakpoints": true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if args.Program == "" {
+			return nil, fmt.Errorf("program to debug not provided")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.program = args.Program
+		s.entry = args.StopOnEntry
+		return nil, nil
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "configurationDone", "disconnect":
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		frames := s.stackTrace()
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		var args scopesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"scopes": s.scopes(args.FrameID)}, nil
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"variables": s.variables(args.VariablesReference)}, nil
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+	case "continue":
+		s.setMode(running)
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	case "next":
+		s.setMode(stepOver)
+		return nil, nil
+	case "stepIn":
+		s.setMode(stepIn)
+		return nil, nil
+	case "stepOut":
+		s.setMode(stepOut)
+		return nil, nil
+	case "pause":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.pause = true
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("request %q not supported", req.Command)
+	}
+}
+
+func (s *Server) send(msg interface{}) {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+	content, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	_ = writeMessage(s.out, content)
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) forwardOutput(r io.Reader, category string) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.event("output", map[string]interface{}{"category": category, "output": string(buf[:n])})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) setBreakpoints(args setBreakpointsArguments) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, _ := filepath.Abs(args.Source.Path)
+	bps := make([]*debugger.Breakpoint, 0, len(args.Breakpoints))
+	result := make([]breakpoint, 0, len(args.Breakpoints))
+	for _, sbp := range args.Breakpoints {
+		bp := &debugger.Breakpoint{Module: path, Row: sbp.Line, Condition: sbp.Condition}
+		verified := true
+		if sbp.HitCondition != "" {
+			hitCount, err := strconv.Atoi(strings.TrimLeft(sbp.HitCondition, ">= "))
+			verified = err == nil
+			bp.HitCount = hitCount
+		}
+		bps = append(bps, bp)
+		result = append(result, breakpoint{Verified: verified, Line: sbp.Line, Source: &args.Source})
+	}
+	s.breakpoints[path] = bps
+	return map[string]interface{}{"breakpoints": result}
+}
+
+// start launches the program
+func (s *Server) start() {
+	s.mu.Lock()
+	program := s.program
+	if s.entry {
+		s.mode = stepIn
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		interpreter := lisp.NewInterpreter(lisp.Options{Stepper: s.enter, Trace: s.exit})
+		result, err := lisp.REPL(interpreter.WithContext(ctx), s.ns, fmt.Sprintf("(load-file %q)", program), types.NewCursorHere(program, -3, 1))
+		exitCode := 0
+		if err != nil {
+			exitCode = 1
+			s.event("output", map[string]interface{}{"category": "stderr", "output": fmt.Sprintf("Error: %s\n", err)})
+		} else {
+			s.event("output", map[string]interface{}{"category": "console", "output": fmt.Sprintf("%s\n", result)})
+		}
+		s.event("exited", map[string]interface{}{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// enter is the stepper of the interpreter: it might stop the program till the client resumes it
+func (s *Server) enter(ast types.MalType, env types.EnvType) debuggertypes.Command {
+	s.mu.Lock()
+	f := frame{ast: ast, env: env}
+	if len(s.stack) > 0 {
+		f.depth = s.stack[len(s.stack)-1].depth
+	}
+	if list, ok := ast.(types.List); ok {
+		if path := s.sourcePath(list.Cursor); path != "" {
+			pos := *list.Cursor
+			pos.Module = &path
+			f.pos = &pos
+			f.depth++
+		}
+	}
+	s.stack = append(s.stack, f)
+	reason := s.stopReason()
+	if reason == "" {
+		s.mu.Unlock()
+		return debuggertypes.In
+	}
+	s.stopped = true
+	s.pause = false
+	s.handles = nil
+	s.mu.Unlock()
+
+	s.event("stopped", map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true})
+	<-s.resume
+	// stepping is managed by the server: the interpreter must call the stepper on every step
+	return debuggertypes.In
+}
+
+// exit is the trace of the interpreter, called once a form is evaluated
+func (s *Server) exit(ast types.MalType, env types.EnvType, result types.MalType, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.stack) > 0 {
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+}
+
+// sourcePath returns the absolute path of the file of pos, or "" if pos is not
+// on a source file (forms of Go embedded libraries are not)
+func (s *Server) sourcePath(pos *types.Position) string {
+	if pos == nil || pos.Module == nil {
+		return ""
+	}
+	path, ok := s.sources[*pos.Module]
+	if !ok {
+		if info, err := os.Stat(*pos.Module); err == nil && !info.IsDir() {
+			path, _ = filepath.Abs(*pos.Module)
+		}
+		s.sources[*pos.Module] = path
+	}
+	return path
+}
+
+// stopReason returns the reason to stop at the top of the stack, or "" if the program must go on
+func (s *Server) stopReason() string {
+	top := s.stack[len(s.stack)-1]
+	if top.pos == nil {
+		return ""
+	}
+	switch {
+	case s.entry:
+		s.entry = false
+		return "entry"
+	case s.pause:
+		return "pause"
+	case s.mode == stepIn,
+		s.mode == stepOver && top.depth <= s.modeDepth,
+		s.mode == stepOut && top.depth < s.modeDepth:
+		return "step"
+	}
+	for _, bp := range s.breakpoints[*top.pos.Module] {
+		hit, err := bp.Hit(top.pos, top.env)
+		if err != nil {
+			s.event("output", map[string]interface{}{"category": "stderr", "output": fmt.Sprintf("breakpoint condition %q: %s\n", bp.Condition, err)})
+		}
+		if hit {
+			return "breakpoint"
+		}
+	}
+	return ""
+}
+
+func (s *Server) setMode(mode stepMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = mode
+	s.modeDepth = 0
+	if len(s.stack) > 0 {
+		s.modeDepth = s.stack[len(s.stack)-1].depth
+	}
+}
+
+func (s *Server) continueProgram() {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.stopped = false
+	s.mu.Unlock()
+	if stopped {
+		s.resume <- struct{}{}
+	}
+}
+
+func (s *Server) disconnect() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mode = running
+	s.breakpoints = map[string][]*debugger.Breakpoint{}
+	s.mu.Unlock()
+	s.continueProgram()
+}
+
+func (s *Server) stackTrace() []stackFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frames := []stackFrame{}
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		f := s.stack[i]
+		if f.pos == nil {
+			continue
+		}
+		path := *f.pos.Module
+		column := f.pos.BeginCol - 1
+		if column < 1 {
+			column = 1
+		}
+		frames = append(frames, stackFrame{
+			ID:     i + 1,
+			Name:   frameName(f.ast),
+			Source: &source{Name: filepath.Base(path), Path: path},
+			Line:   f.pos.BeginRow,
+			Column: column,
+		})
+	}
+	return frames
+}
+
+func frameName(ast types.MalType) string {
+	if list, ok := ast.(types.List); ok && len(list.Val) > 0 {
+		if sym, ok := list.Val[0].(types.Symbol); ok {
+			return "(" + sym.Val + " …)"
+		}
+	}
+	return truncate(lisp.PRINT(ast), 40)
+}
+
+func truncate(str string, length int) string {
+	if r := []rune(str); len(r) > length {
+		return string(r[:length]) + "…"
+	}
+	return str
+}
+
+// frameEnv returns the environment of the frame, or the root environment if not found
+func (s *Server) frameEnv(frameID int) types.EnvType {
+	if frameID < 1 || frameID > len(s.stack) {
+		return s.ns
+	}
+	return s.stack[frameID-1].env
+}
+
+// reference returns a new variables reference to value
+func (s *Server) reference(value interface{}) int {
+	s.handles = append(s.handles, value)
+	return len(s.handles)
+}
+
+type environment interface {
+	Outer() types.EnvType
+	Bindings() map[string]types.MalType
+}
+
+func (s *Server) scopes(frameID int) []scope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scopes := []scope{}
+	for env, level := s.frameEnv(frameID), 0; env != nil; level++ {
+		e, ok := env.(environment)
+		if !ok {
+			break
+		}
+		outer := e.Outer()
+		switch {
+		case outer == nil:
+			scopes = append(scopes, scope{Name: "Globals", VariablesReference: s.reference(env), Expensive: true})
+		case level == 0:
+			scopes = append(scopes, scope{Name: "Locals", VariablesReference: s.reference(env)})
+		default:
+			scopes = append(scopes, scope{Name: fmt.Sprintf("Outer %d", level), VariablesReference: s.reference(env)})
+		}
+		env = outer
+	}
+	return scopes
+}
+
+func (s *Server) variables(reference int) []variable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reference < 1 || reference > len(s.handles) {
+		return []variable{}
+	}
+	variables := []variable{}
+	switch value := s.handles[reference-1].(type) {
+	case environment:
+		bindings := value.Bindings()
+		names := make([]string, 0, len(bindings))
+		for name := range bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			variables = append(variables, s.variable(name, bindings[name]))
+		}
+	case types.List:
+		for i, v := range value.Val {
+			variables = append(variables, s.variable(fmt.Sprintf("[%d]", i), v))
+		}
+	case types.Vector:
+		for i, v := range value.Slice() {
+			variables = append(variables, s.variable(fmt.Sprintf("[%d]", i), v))
+		}
+	case types.HashMap:
+		keys := value.OrderedKeys(types.Sorted)
+		for _, k := range keys {
+			v, _ := value.Get(k)
+			variables = append(variables, s.variable(lisp.PRINT(k), v))
+		}
+	case types.Set:
+		keys := value.OrderedItems(types.Sorted)
+		for i, k := range keys {
+			variables = append(variables, s.variable(fmt.Sprintf("[%d]", i), k))
+		}
+	}
+	return variables
+}
+
+func (s *Server) variable(name string, value types.MalType) variable {
+	return variable{
+		Name:               name,
+		Value:              truncate(lisp.PRINT(value), maxValueLength),
+		VariablesReference: s.children(value),
+	}
+}
+
+// children returns the variables reference of value if it is a non empty collection
+func (s *Server) children(value types.MalType) int {
+	switch value := value.(type) {
+	case types.List:
+		if len(value.Val) > 0 {
+			return s.reference(value)
+		}
+	case types.Vector:
+		if value.Len() > 0 {
+			return s.reference(value)
+		}
+	case types.HashMap:
+		if value.Len() > 0 {
+			return s.reference(value)
+		}
+	case types.Set:
+		if value.Len() > 0 {
+			return s.reference(value)
+		}
+	}
+	return 0
+}
+
+func (s *Server) evaluate(args evaluateArguments) (interface{}, error) {
+	s.mu.Lock()
+	env := s.frameEnv(args.FrameID)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := debugger.EvalWatch(ctx, args.Expression, env)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]interface{}{
+		"result":             truncate(lisp.PRINT(result), maxValueLength),
+		"variablesReference": s.children(result),
+	}, nil
+}
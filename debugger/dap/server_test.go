@@ -0,0 +1,205 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/core/nscore"
+)
+
+const script = `(def a 1)
+(def b [1 2 3])
+(+ a
+   (count b))
+`
+
+type client struct {
+	t        *testing.T
+	w        io.Writer
+	messages chan map[string]interface{}
+	seq      int
+}
+
+func newClient(t *testing.T) *client {
+	ns := env.NewEnv()
+	if err := nscore.Load(ns); err != nil {
+		t.Fatal(err)
+	}
+	if err := nscore.LoadInput(ns); err != nil {
+		t.Fatal(err)
+	}
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go func() { _ = NewServer(serverR, serverW, ns).Serve() }()
+
+	c := &client{t: t, w: clientW, messages: make(chan map[string]interface{}, 100)}
+	go func() {
+		r := bufio.NewReader(clientR)
+		for {
+			content, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg map[string]interface{}
+			if err := json.Unmarshal(content, &msg); err != nil {
+				panic(err)
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) next() map[string]interface{} {
+	c.t.Helper()
+	select {
+	case msg := <-c.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout waiting for message")
+		return nil
+	}
+}
+
+// request sends a request and returns the body of its response (events received meanwhile are ignored)
+func (c *client) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.seq++
+	content, err := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := writeMessage(c.w, content); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.next()
+		if msg["type"] != "response" || int(msg["request_seq"].(float64)) != c.seq {
+			continue
+		}
+		if msg["success"] != true {
+			c.t.Fatalf("%s failed: %v", command, msg["message"])
+		}
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+}
+
+func (c *client) waitEvent(name string) map[string]interface{} {
+	c.t.Helper()
+	for {
+		msg := c.next()
+		if msg["type"] == "event" && msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+func TestDAPSession(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "script.lisp")
+	if err := os.WriteFile(program, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.request("initialize", map[string]interface{}{"adapterID": "lisp"})
+	c.waitEvent("initialized")
+	c.request("launch", map[string]interface{}{"program": program})
+	bps := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": program},
+		"breakpoints": []map[string]interface{}{{"line": 3}},
+	})
+	if len(bps["breakpoints"].([]interface{})) != 1 {
+		t.Fatalf("unexpected breakpoints %v", bps)
+	}
+	c.request("configurationDone", nil)
+
+	if stopped := c.waitEvent("stopped"); stopped["reason"] != "breakpoint" {
+		t.Fatalf("expected breakpoint stop got %v", stopped)
+	}
+	frames := c.request("stackTrace", map[string]interface{}{"threadId": threadID})["stackFrames"].([]interface{})
+	top := frames[0].(map[string]interface{})
+	if top["line"].(float64) != 3 || top["name"] != "(+ …)" {
+		t.Fatalf("unexpected top frame %v", top)
+	}
+	frameID := top["id"]
+
+	scopes := c.request("scopes", map[string]interface{}{"frameId": frameID})["scopes"].([]interface{})
+	globals := scopes[len(scopes)-1].(map[string]interface{})
+	if globals["name"] != "Globals" {
+		t.Fatalf("unexpected scopes %v", scopes)
+	}
+	variables := c.request("variables", map[string]interface{}{"variablesReference": globals["variablesReference"]})["variables"].([]interface{})
+	found := false
+	for _, v := range variables {
+		v := v.(map[string]interface{})
+		if v["name"] == "b" {
+			found = true
+			if v["value"] != "[1 2 3]" || v["variablesReference"].(float64) == 0 {
+				t.Fatalf("unexpected variable %v", v)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("variable b not found")
+	}
+
+	if result := c.request("evaluate", map[string]interface{}{"expression": "(+ a 10)", "frameId": frameID}); result["result"] != "11" {
+		t.Fatalf("unexpected evaluation %v", result)
+	}
+
+	c.request("stepIn", map[string]interface{}{"threadId": threadID})
+	if stopped := c.waitEvent("stopped"); stopped["reason"] != "step" {
+		t.Fatalf("expected step stop got %v", stopped)
+	}
+	frames = c.request("stackTrace", map[string]interface{}{"threadId": threadID})["stackFrames"].([]interface{})
+	if line := frames[0].(map[string]interface{})["line"].(float64); line != 4 {
+		t.Fatalf("expected line 4 got %v", line)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": threadID})
+	if exited := c.waitEvent("exited"); exited["exitCode"].(float64) != 0 {
+		t.Fatalf("unexpected exit %v", exited)
+	}
+	c.waitEvent("terminated")
+	c.request("disconnect", nil)
+}
+
+func TestDAPConditionalBreakpoint(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "countdown.lisp")
+	if err := os.WriteFile(program, []byte(`(def countdown (fn [n]
+  (if (> n 0)
+    (countdown (- n 1))
+    :done)))
+(countdown 5)
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	c.request("initialize", map[string]interface{}{"adapterID": "lisp"})
+	c.request("launch", map[string]interface{}{"program": program})
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": program},
+		"breakpoints": []map[string]interface{}{{"line": 3, "condition": "(< n 4)", "hitCondition": "2"}},
+	})
+	c.request("configurationDone", nil)
+
+	if stopped := c.waitEvent("stopped"); stopped["reason"] != "breakpoint" {
+		t.Fatalf("expected breakpoint stop got %v", stopped)
+	}
+	frameID := c.request("stackTrace", map[string]interface{}{"threadId": threadID})["stackFrames"].([]interface{})[0].(map[string]interface{})["id"]
+	// first hit with n=3, second one with n=2
+	if result := c.request("evaluate", map[string]interface{}{"expression": "n", "frameId": frameID}); result["result"] != "2" {
+		t.Fatalf("unexpected evaluation %v", result)
+	}
+	c.request("disconnect", nil)
+}
@@ -9,6 +9,7 @@ import (
 	"os/user"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,12 +30,15 @@ type Debugger struct {
 	stop      bool
 	trace     bool
 	replOnEnd bool
+	// toBreakpoint runs the program till a breakpoint is hit
+	toBreakpoint bool
 }
 
 const dumpFilePath = ".lispdebug/dump-vars.json"
 
 type DebuggerConfig struct {
-	Exprs map[string]bool `json:"exprs"`
+	Exprs       map[string]bool `json:"exprs"`
+	Breakpoints []*Breakpoint   `json:"breakpoints"`
 }
 
 func Engine(moduleName string, ns types.EnvType) *Debugger {
@@ -82,7 +86,19 @@ func (deb *Debugger) Stepper(ast types.MalType, ns types.EnvType) Command {
 		return NoOp
 	}
 	pos := lisperror.GetPosition(expr)
-	if pos != nil && pos.Module != nil && strings.Contains(*pos.Module, deb.name) {
+	hit := false
+	if deb.toBreakpoint {
+		bp := deb.hitBreakpoint(pos, ns)
+		if bp == nil {
+			return In
+		}
+		colorAlert.Printf("breakpoint %s hit\n", bp)
+		deb.toBreakpoint = false
+		deb.stop = true
+		deb.trace = true
+		hit = true
+	}
+	if pos != nil && pos.Module != nil && (hit || strings.Contains(*pos.Module, deb.name)) {
 		deb.printTrace(expr, ns, pos)
 		if deb.stop {
 			for {
@@ -125,6 +141,20 @@ func (deb *Debugger) Stepper(ast types.MalType, ns types.EnvType) Command {
 						} else {
 							colorAlert.Println("no watches to remove (0)")
 						}
+					case 'b':
+						deb.toggleBreakpoint(pos)
+					case 'B':
+						colorAlert.Println("add a new breakpoint (B)")
+						deb.addBreakpoint(pos)
+					case 'l':
+						deb.printBreakpoints()
+					case 'X':
+						if len(deb.config.Breakpoints) > 0 {
+							colorAlert.Println("removing all breakpoints (X)")
+							deb.config.Breakpoints = nil
+						} else {
+							colorAlert.Println("no breakpoints to remove (X)")
+						}
 					default:
 						colorAlert.Printf("key '%c' not bound\n", rune)
 					}
@@ -148,6 +178,11 @@ func (deb *Debugger) Stepper(ast types.MalType, ns types.EnvType) Command {
 						keyboard.Open()
 						deb.printTrace(expr, ns, pos)
 						continue
+					case keyboard.KeyF8:
+						colorAlert.Println("running to next breakpoint (F8)")
+						deb.stop = false
+						deb.toBreakpoint = true
+						return In
 					case keyboard.KeyF5:
 						colorAlert.Println("running to the end (F5)")
 						keyboard.Close()
@@ -191,6 +226,99 @@ func (deb *Debugger) Stepper(ast types.MalType, ns types.EnvType) Command {
 	return NoOp
 }
 
+// hitBreakpoint returns the breakpoint hit by the form at pos, if any
+func (deb *Debugger) hitBreakpoint(pos *types.Position, ns types.EnvType) *Breakpoint {
+	for _, bp := range deb.config.Breakpoints {
+		hit, err := bp.Hit(pos, ns)
+		if err != nil {
+			colorAlert.Printf("breakpoint %s condition error: %s\n", bp, err)
+		}
+		if hit {
+			return bp
+		}
+	}
+	return nil
+}
+
+func (deb *Debugger) toggleBreakpoint(pos *types.Position) {
+	if pos == nil || pos.Module == nil {
+		colorAlert.Println("no source position to set a breakpoint")
+		return
+	}
+	for i, bp := range deb.config.Breakpoints {
+		if bp.Row == pos.BeginRow && SameModule(bp.Module, *pos.Module) {
+			colorAlert.Printf("removing breakpoint %s (b)\n", bp)
+			deb.config.Breakpoints = append(deb.config.Breakpoints[:i], deb.config.Breakpoints[i+1:]...)
+			return
+		}
+	}
+	bp := &Breakpoint{Module: *pos.Module, Row: pos.BeginRow}
+	colorAlert.Printf("adding breakpoint %s (b)\n", bp)
+	deb.config.Breakpoints = append(deb.config.Breakpoints, bp)
+}
+
+func (deb *Debugger) addBreakpoint(pos *types.Position) {
+	bp := &Breakpoint{Module: deb.name}
+	if pos != nil && pos.Module != nil {
+		bp.Module = *pos.Module
+		bp.Row = pos.BeginRow
+	}
+	rl := varREPL()
+	defer rl.Close()
+
+	colorExpr.Printf("row (empty for %d)\n", bp.Row)
+	line, err := rl.Readline()
+	if err != nil {
+		return
+	}
+	if line = strings.Trim(line, " \t\n\r"); len(line) > 0 {
+		if bp.Row, err = strconv.Atoi(line); err != nil {
+			colorAlert.Printf("invalid row %q\n", line)
+			return
+		}
+	}
+	colorExpr.Println("condition (empty for none)")
+	if bp.Condition, err = rl.Readline(); err != nil {
+		return
+	}
+	bp.Condition = strings.Trim(bp.Condition, " \t\n\r")
+	colorExpr.Println("hit count (empty to stop on every hit)")
+	if line, err = rl.Readline(); err != nil {
+		return
+	}
+	if line = strings.Trim(line, " \t\n\r"); len(line) > 0 {
+		if bp.HitCount, err = strconv.Atoi(line); err != nil {
+			colorAlert.Printf("invalid hit count %q\n", line)
+			return
+		}
+	}
+	colorAlert.Printf("adding breakpoint %s\n", bp)
+	deb.config.Breakpoints = append(deb.config.Breakpoints, bp)
+}
+
+func (deb *Debugger) printBreakpoints() {
+	if len(deb.config.Breakpoints) == 0 {
+		colorAlert.Println("no breakpoints (l)")
+		return
+	}
+	colorAlert.Println("breakpoints (l)")
+	for _, bp := range deb.config.Breakpoints {
+		colorFileName.Print(bp.Module)
+		colorSeparator.Print("§")
+		colorPosition.Print(bp.Row)
+		if bp.Condition != "" {
+			colorSeparator.Print(" if ")
+			colorCode.Print(bp.Condition)
+		}
+		colorSeparator.Print(" hits: ")
+		if bp.HitCount > 0 {
+			colorDump.Printf("%d/%d\n", bp.Hits(), bp.HitCount)
+		} else {
+			colorDump.Printf("%d\n", bp.Hits())
+		}
+	}
+}
+
 func readConfig(deb *Debugger) {
 	currentUser, err := user.Current()
 	if err != nil {
@@ -242,12 +370,7 @@ func (deb *Debugger) printTrace(expr types.MalType, ns types.EnvType, pos *types
 		}
 		sort.Strings(exprsSorted)
 		for _, exprString := range exprsSorted {
-			ast, err := lisp.READ(exprString, types.NewCursorFile("REPL"), ns)
-			if err != nil {
-				colorAlert.Println(err)
-				continue
-			}
-			res, err := lisp.EVAL(ctx, ast, ns)
+			res, err := EvalWatch(ctx, exprString, ns)
 			if err != nil {
 				colorAlert.Println(err)
 				continue
@@ -268,6 +391,15 @@ func (deb *Debugger) printTrace(expr types.MalType, ns types.EnvType, pos *types
 	}
 }
 
+// EvalWatch evaluates the watch expression exprString on ns
+func EvalWatch(ctx context.Context, exprString string, ns types.EnvType) (types.MalType, error) {
+	ast, err := lisp.READ(exprString, types.NewCursorFile("REPL"), ns)
+	if err != nil {
+		return nil, err
+	}
+	return lisp.EVAL(ctx, ast, ns)
+}
+
 func printHelp() {
 	help := `Debugging session started
   F10:    to execute till next expr (not entering expression)
@@ -277,9 +409,14 @@ func printHelp() {
   F5:     to execute till the end
   F6:     to execute till the end and spawn a REPL
   F7:     to execute till the end, trace expressions and spawn a REPL
+  F8:     to execute till next breakpoint
   +:      to add a new expression to watch view
   -:      to remove a expression from watch view
   0:      to remove all expressions from watch view
+  b:      to toggle a breakpoint on current line
+  B:      to add a breakpoint with condition and hit count
+  l:      to list breakpoints
+  X:      to remove all breakpoints
   Ctrl+C: to kill this debugging session
 `
 	for _, line := range strings.Split(help, "\n") {
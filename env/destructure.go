@@ -0,0 +1,217 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/types"
+)
+
+// Destructure binds the symbols of pattern to the corresponding parts of value, calling bind for each of them.
+// pattern might be:
+//   - a symbol, bound to value
+//   - a vector [a b & rest :as all], bound to the elements of a list or vector (nil if missing)
+//   - a hash map {a :a :keys [b c] :strs [d] :or {c 1} :as m}, bound to the values of a hash map
+//     (or of a sequence of key value pairs): pattern keys to the value of their key, and the
+//     symbols of :keys and :strs to the value of their keyword or string.
+//     The :or default of a symbol is used if its key is missing: orDefault returns its value,
+//     or the default expression itself is bound if orDefault is nil
+//
+// Patterns might be nested.
+func Destructure(pattern, value types.MalType, bind func(types.Symbol, types.MalType), orDefault func(types.Symbol, types.MalType) (types.MalType, error)) error {
+	switch pattern := pattern.(type) {
+	case types.Symbol:
+		bind(pattern, value)
+		return nil
+	case types.Vector:
+		return destructureSequential(pattern, value, bind, orDefault)
+	case types.HashMap:
+		return destructureAssociative(pattern, value, bind, orDefault)
+	default:
+		// pattern might be any value (with no position)
+		return lisperror.NewLispError(errors.New("non-symbol bind value"), nil)
+	}
+}
+
+// PatternSymbols returns the symbols bound by pattern, in binding order
+func PatternSymbols(pattern types.MalType) ([]types.Symbol, error) {
+	var symbols []types.Symbol
+	if err := Destructure(pattern, nil, func(sym types.Symbol, _ types.MalType) {
+		symbols = append(symbols, sym)
+	}, nil); err != nil {
+		return nil, err
+	}
+	return symbols, nil
+}
+
+// PatternDefaults calls f with each symbol of pattern with an :or default and its default expression
+func PatternDefaults(pattern types.MalType, f func(types.Symbol, types.MalType) error) error {
+	// every key of nil is missing
+	return Destructure(pattern, nil, func(types.Symbol, types.MalType) {}, func(sym types.Symbol, expr types.MalType) (types.MalType, error) {
+		return nil, f(sym, expr)
+	})
+}
+
+func destructureSequential(pattern types.Vector, value types.MalType, bind func(types.Symbol, types.MalType), orDefault func(types.Symbol, types.MalType) (types.MalType, error)) error {
+	var values []types.MalType
+	switch value := value.(type) {
+	case nil:
+	case types.List:
+		values = value.Val
+	case types.Vector:
+		values = value.Slice()
+	default:
+		return lisperror.NewLispError(fmt.Errorf("cannot destructure %s as a sequence", types.TypeName(value)), pattern)
+	}
+	elems := pattern.Slice()
+	i := 0
+	for p := 0; p < len(elems); p++ {
+		switch elem := elems[p].(type) {
+		case types.Symbol:
+			if elem.Val == "&" {
+				if p+1 == len(elems) {
+					return lisperror.NewLispError(errors.New("& must be followed by a pattern"), pattern)
+				}
+				p++
+				var rest types.MalType = types.List{}
+				if i < len(values) {
+					rest = types.List{Val: values[i:]}
+				}
+				if err := Destructure(elems[p], rest, bind, orDefault); err != nil {
+					return err
+				}
+				i = len(values)
+				continue
+			}
+		case string:
+			if elem == "ʞas" {
+				if p+1 == len(elems) {
+					return lisperror.NewLispError(errors.New(":as must be followed by a symbol"), pattern)
+				}
+				p++
+				sym, ok := elems[p].(types.Symbol)
+				if !ok {
+					return lisperror.NewLispError(errors.New(":as must be followed by a symbol"), pattern)
+				}
+				bind(sym, value)
+				continue
+			}
+		}
+		var v types.MalType
+		if i < len(values) {
+			v = values[i]
+		}
+		i++
+		if err := Destructure(elems[p], v, bind, orDefault); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func destructureAssociative(pattern types.HashMap, value types.MalType, bind func(types.Symbol, types.MalType), orDefault func(types.Symbol, types.MalType) (types.MalType, error)) error {
+	var m types.HashMap
+	switch value := value.(type) {
+	case nil:
+	case types.HashMap:
+		m = value
+	case types.List, types.Vector:
+		// e.g. keyword arguments of a rest parameter
+		hm, err := types.NewHashMap(value)
+		if err != nil {
+			return lisperror.NewLispError(err, pattern)
+		}
+		m = hm.(types.HashMap)
+	default:
+		return lisperror.NewLispError(fmt.Errorf("cannot destructure %s as a hash-map", types.TypeName(value)), pattern)
+	}
+
+	var defaults types.HashMap
+	if or, ok := pattern.Get("ʞor"); ok {
+		orMap, ok := or.(types.HashMap)
+		if !ok {
+			return lisperror.NewLispError(errors.New(":or must be a hash-map"), pattern)
+		}
+		defaults = orMap
+	}
+	// get returns the value of key, or the default of sym if key is missing
+	get := func(sym types.Symbol, key types.MalType) (types.MalType, error) {
+		if v, found := m.Get(key); found {
+			return v, nil
+		}
+		expr, found := defaults.Get(types.Symbol{Val: sym.Val})
+		if !found || orDefault == nil {
+			return expr, nil
+		}
+		return orDefault(sym, expr)
+	}
+	var err error
+	pattern.Range(func(key, arg types.MalType) bool {
+		switch key := key.(type) {
+		case types.Symbol:
+			// {a :a}
+			var v types.MalType
+			if v, err = get(key, arg); err != nil {
+				return false
+			}
+			bind(key, v)
+		case types.Vector, types.HashMap:
+			// {[a b] :point}
+			v, _ := m.Get(arg)
+			err = Destructure(key, v, bind, orDefault)
+		case string:
+			err = destructureKeys(pattern, key, arg, value, bind, get)
+		default:
+			err = lisperror.NewLispError(fmt.Errorf("unsupported destructuring key %s", types.TypeName(key)), pattern)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// destructureKeys binds the :keys, :strs or :as entry of an associative pattern
+func destructureKeys(pattern types.HashMap, key string, arg, value types.MalType, bind func(types.Symbol, types.MalType), get func(types.Symbol, types.MalType) (types.MalType, error)) error {
+	var prefix string
+	switch key {
+	case "ʞkeys":
+		prefix = "ʞ"
+	case "ʞstrs":
+		prefix = ""
+	case "ʞas":
+		sym, ok := arg.(types.Symbol)
+		if !ok {
+			return lisperror.NewLispError(errors.New(":as must be followed by a symbol"), pattern)
+		}
+		bind(sym, value)
+		return nil
+	case "ʞor":
+		return nil
+	default:
+		return lisperror.NewLispError(fmt.Errorf("unsupported destructuring key %s", keyName(key)), pattern)
+	}
+	symbols, ok := arg.(types.Vector)
+	if !ok {
+		return lisperror.NewLispError(fmt.Errorf("%s must be a vector of symbols", keyName(key)), pattern)
+	}
+	for _, s := range symbols.Slice() {
+		sym, ok := s.(types.Symbol)
+		if !ok {
+			return lisperror.NewLispError(fmt.Errorf("%s must be a vector of symbols", keyName(key)), pattern)
+		}
+		v, err := get(sym, prefix+sym.Val)
+		if err != nil {
+			return err
+		}
+		bind(sym, v)
+	}
+	return nil
+}
+
+func keyName(key string) string {
+	if strings.HasPrefix(key, "ʞ") {
+		return ":" + key[len("ʞ"):]
+	}
+	return fmt.Sprintf("%q", key)
+}
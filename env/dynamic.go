@@ -0,0 +1,96 @@
+package env
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jig/lisp/types"
+)
+
+// Var is a dynamic var: a definition with ^:dynamic metadata, that binding
+// might rebind for the extent of an evaluation
+type Var struct {
+	env  *Env
+	name string
+}
+
+func (v Var) String() string {
+	if v.env.ns != nil {
+		return v.env.ns.name + "/" + v.name
+	}
+	return v.name
+}
+
+type bindingsKey struct{}
+
+// SetDynamic makes the definition name of e a dynamic var
+func SetDynamic(e types.EnvType, name string) {
+	env := e.(*Env)
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	if env.dynamic == nil {
+		env.dynamic = map[string]struct{}{}
+	}
+	env.dynamic[name] = struct{}{}
+}
+
+// LookupVar returns the dynamic var that sym refers to from e
+func LookupVar(e types.EnvType, sym types.Symbol) (Var, error) {
+	for env := e.(*Env); env != nil; env = env.outer {
+		env.mu.RLock()
+		_, found := env.data[sym.Val]
+		env.mu.RUnlock()
+		v := Var{env: env, name: sym.Val}
+		if !found {
+			if env.ns == nil {
+				continue
+			}
+			target, name, ok := env.ns.target(sym)
+			if !ok {
+				continue
+			}
+			v = Var{env: target.env, name: name}
+		}
+		v.env.mu.RLock()
+		_, dynamic := v.env.dynamic[v.name]
+		v.env.mu.RUnlock()
+		if !dynamic {
+			return Var{}, fmt.Errorf("can't dynamically bind non-dynamic var %s", sym.Val)
+		}
+		return v, nil
+	}
+	return Var{}, fmt.Errorf("symbol '%s' not found", sym.Val)
+}
+
+// WithBindings returns a context where vars are bound to values, shadowing the bindings of ctx.
+// Evaluations (and futures) on the returned context see the bound values instead of the var definitions.
+func WithBindings(ctx context.Context, bindings map[Var]types.MalType) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	merged := make(map[Var]types.MalType, len(bindings))
+	if outer, ok := ctx.Value(bindingsKey{}).(map[Var]types.MalType); ok {
+		for v, value := range outer {
+			merged[v] = value
+		}
+	}
+	for v, value := range bindings {
+		merged[v] = value
+	}
+	return context.WithValue(ctx, bindingsKey{}, merged)
+}
+
+// Lookup returns the value of sym on e, or its value bound on ctx if sym is a dynamic var
+func Lookup(ctx context.Context, e types.EnvType, sym types.Symbol) (types.MalType, error) {
+	if ctx != nil {
+		if bindings, ok := ctx.Value(bindingsKey{}).(map[Var]types.MalType); ok {
+			if v, err := LookupVar(e, sym); err == nil {
+				if value, bound := bindings[v]; bound {
+					return value, nil
+				}
+			}
+		}
+	}
+	return e.Get(sym)
+}
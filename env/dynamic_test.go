@@ -0,0 +1,50 @@
+package env
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jig/lisp/types"
+)
+
+func TestDynamicVars(t *testing.T) {
+	root := NewEnv()
+	depth := types.Symbol{Val: "*depth*"}
+	root.Set(depth, 0)
+	SetDynamic(root, depth.Val)
+	root.Set(types.Symbol{Val: "static"}, 0)
+
+	v, err := LookupVar(root, depth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "user/*depth*" {
+		t.Fatalf("expected user/*depth* got %s", v)
+	}
+	if _, err := LookupVar(root, types.Symbol{Val: "static"}); err == nil {
+		t.Fatal("non-dynamic var bound")
+	}
+
+	local := NewSubordinateEnv(root)
+	outer := WithBindings(context.Background(), map[Var]types.MalType{v: 1})
+	inner := WithBindings(outer, map[Var]types.MalType{v: 2})
+	for ctx, expected := range map[context.Context]types.MalType{
+		context.Background(): 0,
+		outer:                1,
+		inner:                2,
+	} {
+		value, err := Lookup(ctx, local, depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Fatalf("expected %v got %v", expected, value)
+		}
+	}
+
+	// locals shadow dynamic vars
+	local.Set(depth, "local")
+	if value, _ := Lookup(inner, local, depth); value != "local" {
+		t.Fatalf("expected local got %v", value)
+	}
+}
@@ -15,18 +15,30 @@ type Env struct {
 	mu    *sync.RWMutex
 	data  map[string]interface{}
 	outer *Env
+	// dynamic is the set of dynamic vars defined on the environment (see dynamic.go)
+	dynamic map[string]struct{}
+	// ns is the namespace of namespace environments (see namespace.go)
+	ns *namespace
+	// nss is the namespace registry of root environments
+	nss *namespaces
 }
 
+// NewEnv returns a root environment, that is the user namespace
 func NewEnv() types.EnvType {
-	return _newEnv()
+	env := _newEnv()
+	env.nss = newNamespaces(env)
+	return env
 }
 
 func NewSubordinateEnv(outer types.EnvType) types.EnvType {
 	return _newSubordinateEnv(outer.(*Env))
 }
 
-func NewSubordinateEnvWithBinds(outer types.EnvType, binds_mt types.MalType, exprs_mt types.MalType) (types.EnvType, error) {
-	return _newSubordinateEnvWithBinds(outer.(*Env), binds_mt, exprs_mt)
+// NewSubordinateEnvWithBinds returns an environment with the parameters binds_mt bound to the
+// arguments exprs_mt. eval evaluates the :or defaults of destructured parameters on the new
+// environment (see Destructure).
+func NewSubordinateEnvWithBinds(outer types.EnvType, binds_mt types.MalType, exprs_mt types.MalType, eval func(types.MalType, types.EnvType) (types.MalType, error)) (types.EnvType, error) {
+	return _newSubordinateEnvWithBinds(outer.(*Env), binds_mt, exprs_mt, eval)
 }
 
 func _newEnv() *Env {
@@ -42,7 +54,7 @@ func _newSubordinateEnv(outer *Env) *Env {
 	return env
 }
 
-func _newSubordinateEnvWithBinds(outer *Env, binds_mt types.MalType, exprs_mt types.MalType) (types.EnvType, error) {
+func _newSubordinateEnvWithBinds(outer *Env, binds_mt types.MalType, exprs_mt types.MalType, eval func(types.MalType, types.EnvType) (types.MalType, error)) (types.EnvType, error) {
 	env := _newSubordinateEnv(outer)
 
 	if binds_mt != nil && exprs_mt != nil {
@@ -59,15 +71,24 @@ func _newSubordinateEnvWithBinds(outer *Env, binds_mt types.MalType, exprs_mt ty
 		var varargs bool
 		i := 0
 		for ; i < len(binds); i++ {
-			if types.Q[types.Symbol](binds[i]) && binds[i].(types.Symbol).Val == "&" {
-				env.data[binds[i+1].(types.Symbol).Val] = types.List{Val: exprs[i:]}
+			sym, isSymbol := binds[i].(types.Symbol)
+			if isSymbol && sym.Val == "&" {
+				if i+1 == len(binds) {
+					return nil, lisperror.NewLispError(errors.New("& must be followed by a pattern"), nil)
+				}
+				if err := env.bind(binds[i+1], types.List{Val: exprs[i:]}, eval); err != nil {
+					return nil, err
+				}
 				varargs = true
 				break
-			} else {
-				if i == len(exprs) {
-					return nil, lisperror.NewLispError(fmt.Errorf("too few arguments passed (%d binds, %d arguments passed)", len(binds), len(exprs)), nil)
-				}
-				env.data[binds[i].(types.Symbol).Val] = exprs[i]
+			}
+			if i == len(exprs) {
+				return nil, lisperror.NewLispError(fmt.Errorf("too few arguments passed (%d binds, %d arguments passed)", len(binds), len(exprs)), nil)
+			}
+			if isSymbol {
+				env.data[sym.Val] = exprs[i]
+			} else if err := env.bind(binds[i], exprs[i], eval); err != nil {
+				return nil, err
 			}
 		}
 		if !varargs && len(exprs) != i {
@@ -79,6 +100,20 @@ func _newSubordinateEnvWithBinds(outer *Env, binds_mt types.MalType, exprs_mt ty
 	return env, nil
 }
 
+// bind destructures value on pattern (see Destructure) defining its symbols on e, where eval
+// evaluates the :or defaults
+func (e *Env) bind(pattern, value types.MalType, eval func(types.MalType, types.EnvType) (types.MalType, error)) error {
+	var orDefault func(types.Symbol, types.MalType) (types.MalType, error)
+	if eval != nil {
+		orDefault = func(_ types.Symbol, expr types.MalType) (types.MalType, error) {
+			return eval(expr, e)
+		}
+	}
+	return Destructure(pattern, value, func(sym types.Symbol, v types.MalType) {
+		e.data[sym.Val] = v
+	}, orDefault)
+}
+
 func (e *Env) Find(key types.Symbol) types.EnvType {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -143,9 +178,31 @@ func (e *Env) Symbols(newLine [][]rune, lastPartial string) [][]rune {
 	return newLine
 }
 
+// Outer returns the outer environment, or nil if e is a root environment
+func (e *Env) Outer() types.EnvType {
+	if e.outer == nil {
+		return nil
+	}
+	return e.outer
+}
+
+// Bindings returns a copy of the symbols defined on e (symbols of outer environments excluded)
+func (e *Env) Bindings() map[string]types.MalType {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	bindings := make(map[string]types.MalType, len(e.data))
+	for k, v := range e.data {
+		bindings[k] = v
+	}
+	return bindings
+}
+
 func (e *Env) FindNT(key types.Symbol) types.EnvType {
 	if _, ok := e.data[key.Val]; ok {
 		return e
+	} else if _, ok, err := e.resolve(key); ok && err == nil {
+		return e
 	} else if e.outer != nil {
 		// do-not-use-FindNT-here
 		return e.outer.Find(key)
@@ -162,6 +219,8 @@ func (e *Env) SetNT(key types.Symbol, value types.MalType) types.MalType {
 func (e *Env) GetNT(key types.Symbol) (types.MalType, error) {
 	if v, ok := e.data[key.Val]; ok {
 		return v, nil
+	} else if v, ok, err := e.resolve(key); ok {
+		return v, err
 	} else if e.outer != nil {
 		// do-not-use-GetNT-here
 		return e.outer.Get(key)
@@ -1,6 +1,7 @@
 package env
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/jig/lisp/types"
@@ -49,3 +50,47 @@ func TestSubordEnv(t *testing.T) {
 		t.Fatal("should not find symbol")
 	}
 }
+
+func TestBindings(t *testing.T) {
+	ns := NewEnv()
+	ns.Set(types.Symbol{Val: "year"}, 1984)
+	sub := NewSubordinateEnv(ns)
+	sub.Set(types.Symbol{Val: "month"}, 4)
+
+	bindings := sub.(*Env).Bindings()
+	if len(bindings) != 1 || bindings["month"] != 4 {
+		t.Fatalf("unexpected bindings %v", bindings)
+	}
+	if sub.(*Env).Outer() != ns {
+		t.Fatal("outer must be the root environment")
+	}
+	if ns.(*Env).Outer() != nil {
+		t.Fatal("root environment has no outer")
+	}
+}
+
+func TestPatternSymbols(t *testing.T) {
+	pattern := types.NewVector([]types.MalType{
+		types.Symbol{Val: "a"},
+		types.NewVector([]types.MalType{types.Symbol{Val: "b"}}...),
+		types.Symbol{Val: "&"},
+		types.NewHashMapFromMap(map[string]types.MalType{"ʞkeys": types.NewVector([]types.MalType{types.Symbol{Val: "c"}}...)}),
+		"ʞas",
+		types.Symbol{Val: "all"},
+	}...)
+	symbols, err := PatternSymbols(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, sym := range symbols {
+		names = append(names, sym.Val)
+	}
+	if strings.Join(names, " ") != "a b c all" {
+		t.Fatalf("unexpected symbols %v", names)
+	}
+
+	if _, err := PatternSymbols(types.NewVector([]types.MalType{1}...)); err == nil {
+		t.Fatal("numbers are not patterns")
+	}
+}
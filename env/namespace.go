@@ -0,0 +1,295 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/types"
+)
+
+// UserNamespace is the name of the namespace of a root environment (see [NewEnv])
+const UserNamespace = "user"
+
+// namespace is a named environment. The root environment is the user namespace, and
+// the other namespaces are environments subordinate of it: they see the root definitions
+// (e.g. core functions) but their own definitions don't collide.
+type namespace struct {
+	name string
+	env  *Env
+
+	mu      sync.RWMutex
+	aliases map[string]string
+	private map[string]struct{}
+}
+
+// namespaces is the namespace registry of a root environment
+type namespaces struct {
+	mu        sync.RWMutex
+	byName    map[string]*namespace
+	libraries map[string]func(types.EnvType) error
+}
+
+func newNamespace(name string, env *Env) *namespace {
+	ns := &namespace{
+		name:    name,
+		env:     env,
+		aliases: map[string]string{},
+		private: map[string]struct{}{},
+	}
+	env.ns = ns
+	return ns
+}
+
+func newNamespaces(root *Env) *namespaces {
+	user := newNamespace(UserNamespace, root)
+	return &namespaces{
+		byName:    map[string]*namespace{UserNamespace: user},
+		libraries: map[string]func(types.EnvType) error{},
+	}
+}
+
+type currentNamespaceKey struct{}
+
+// currentNamespace holds the *namespace where the top level forms of an evaluation are
+// evaluated (see [WithNamespace])
+type currentNamespace struct {
+	ns atomic.Value
+}
+
+// WithNamespace returns a context whose evaluations have their own current namespace,
+// initially the current one of ctx (the user namespace if none). in-ns on the returned
+// context doesn't change the current namespace of ctx, nor of other evaluations of the
+// same environment: EVAL and load-file evaluate on a new one if needed, and a REPL session
+// keeps one for all its lines.
+func WithNamespace(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	current := &currentNamespace{}
+	if outer := currentNamespaceOf(ctx); outer != nil {
+		if ns := outer.ns.Load(); ns != nil {
+			current.ns.Store(ns)
+		}
+	}
+	return context.WithValue(ctx, currentNamespaceKey{}, current)
+}
+
+// HasNamespace returns true if ctx has a current namespace (see [WithNamespace])
+func HasNamespace(ctx context.Context) bool {
+	return currentNamespaceOf(ctx) != nil
+}
+
+func currentNamespaceOf(ctx context.Context) *currentNamespace {
+	if ctx == nil {
+		return nil
+	}
+	current, _ := ctx.Value(currentNamespaceKey{}).(*currentNamespace)
+	return current
+}
+
+// current returns the current namespace of ctx for the root environment root
+func (root *Env) current(ctx context.Context) *namespace {
+	if current := currentNamespaceOf(ctx); current != nil {
+		// ctx might have been used on another root environment
+		if ns, ok := current.ns.Load().(*namespace); ok && ns.env.root() == root {
+			return ns
+		}
+	}
+	return root.ns
+}
+
+// root returns the root environment of e
+func (e *Env) root() *Env {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// RegisterLibrary registers a Go library that Lisp code might load into its own namespace with
+// (require [name :as alias]). Lisp code can only require registered libraries.
+func RegisterLibrary(e types.EnvType, name string, load func(types.EnvType) error) {
+	nss := e.(*Env).root().nss
+	nss.mu.Lock()
+	defer nss.mu.Unlock()
+
+	nss.libraries[name] = load
+}
+
+// InNamespace sets the namespace name as the current one of the evaluation of ctx (see
+// [WithNamespace]), creating it if needed
+func InNamespace(ctx context.Context, e types.EnvType, name string) error {
+	current := currentNamespaceOf(ctx)
+	if current == nil {
+		return errors.New("in-ns called out of an evaluation")
+	}
+	root := e.(*Env).root()
+	nss := root.nss
+	nss.mu.Lock()
+	defer nss.mu.Unlock()
+
+	ns, ok := nss.byName[name]
+	if !ok {
+		ns = newNamespace(name, _newSubordinateEnv(root))
+		nss.byName[name] = ns
+	}
+	current.ns.Store(ns)
+	return nil
+}
+
+// CurrentNamespace returns the name of the current namespace of the evaluation of ctx
+func CurrentNamespace(ctx context.Context, e types.EnvType) string {
+	return e.(*Env).root().current(ctx).name
+}
+
+// NamespaceEnv returns the environment of the current namespace of the evaluation of ctx if e
+// is a root environment, or e otherwise. Top level forms are evaluated on it.
+func NamespaceEnv(ctx context.Context, e types.EnvType) types.EnvType {
+	if env, ok := e.(*Env); ok && env.nss != nil {
+		return env.current(ctx).env
+	}
+	return e
+}
+
+// Require loads the registered library name into its own namespace (once), and aliases it
+// on the current namespace of ctx if alias is not empty. Namespaces created by in-ns might be
+// aliased too.
+func Require(ctx context.Context, e types.EnvType, name, alias string) error {
+	root := e.(*Env).root()
+	nss := root.nss
+	nss.mu.Lock()
+	ns, ok := nss.byName[name]
+	if !ok {
+		load, ok := nss.libraries[name]
+		if !ok {
+			nss.mu.Unlock()
+			return fmt.Errorf("library %s not found", name)
+		}
+		ns = newNamespace(name, _newSubordinateEnv(root))
+		// registered before loading as the library might require itself
+		nss.byName[name] = ns
+		nss.mu.Unlock()
+		if err := load(ns.env); err != nil {
+			nss.mu.Lock()
+			delete(nss.byName, name)
+			nss.mu.Unlock()
+			return err
+		}
+	} else {
+		nss.mu.Unlock()
+	}
+
+	if alias != "" {
+		current := root.current(ctx)
+		current.mu.Lock()
+		defer current.mu.Unlock()
+		current.aliases[alias] = name
+	}
+	return nil
+}
+
+// SetPrivate makes the definition name of namespace e private: it can't be resolved by a
+// qualified symbol from other namespaces. It does nothing if e is not a namespace environment.
+func SetPrivate(e types.EnvType, name string) {
+	ns := e.(*Env).ns
+	if ns == nil {
+		return
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	ns.private[name] = struct{}{}
+}
+
+// Publics returns the public definitions of the namespace name, by symbol
+func Publics(e types.EnvType, name string) (types.HashMap, error) {
+	nss := e.(*Env).root().nss
+	nss.mu.RLock()
+	ns, ok := nss.byName[name]
+	nss.mu.RUnlock()
+	if !ok {
+		return types.HashMap{}, fmt.Errorf("namespace %s not found", name)
+	}
+
+	bindings := ns.env.Bindings()
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	publics := types.HashMap{}
+	for name, value := range bindings {
+		if _, private := ns.private[name]; !private {
+			publics = publics.Assoc(types.Symbol{Val: name}, value)
+		}
+	}
+	return publics, nil
+}
+
+// splitQualified returns the namespace (or alias) and name of a qualified symbol (ns/name)
+func splitQualified(sym string) (string, string, bool) {
+	i := strings.Index(sym, "/")
+	if i <= 0 || i == len(sym)-1 {
+		return "", "", false
+	}
+	return sym[:i], sym[i+1:], true
+}
+
+// resolve resolves the qualified symbol key if e is a namespace environment
+func (e *Env) resolve(key types.Symbol) (types.MalType, bool, error) {
+	if e.ns == nil {
+		return nil, false, nil
+	}
+	return e.ns.resolve(key)
+}
+
+// target returns the namespace and the name the qualified symbol key refers to from namespace ns.
+// ok is false if key is not qualified, or if its namespace is unknown.
+func (ns *namespace) target(key types.Symbol) (target *namespace, name string, ok bool) {
+	prefix, name, qualified := splitQualified(key.Val)
+	if !qualified {
+		return nil, "", false
+	}
+	ns.mu.RLock()
+	if aliased, found := ns.aliases[prefix]; found {
+		prefix = aliased
+	}
+	ns.mu.RUnlock()
+
+	if prefix == ns.name {
+		return ns, name, true
+	}
+	nss := ns.env.root().nss
+	nss.mu.RLock()
+	defer nss.mu.RUnlock()
+	target = nss.byName[prefix]
+	return target, name, target != nil
+}
+
+// resolve resolves the qualified symbol key from namespace ns. ok is false if key is not
+// qualified, or if its namespace is unknown.
+func (ns *namespace) resolve(key types.Symbol) (value types.MalType, ok bool, err error) {
+	target, name, ok := ns.target(key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	if target != ns {
+		target.mu.RLock()
+		_, private := target.private[name]
+		target.mu.RUnlock()
+		if private {
+			return nil, true, lisperror.NewLispError(fmt.Errorf("symbol '%s' is private", key.Val), key)
+		}
+		target.env.mu.RLock()
+		defer target.env.mu.RUnlock()
+	}
+	// the caller holds the lock of ns.env
+	value, found := target.env.data[name]
+	if !found {
+		return nil, true, lisperror.NewLispError(fmt.Errorf("symbol '%s' not found", key.Val), key)
+	}
+	return value, true, nil
+}
@@ -0,0 +1,105 @@
+package env
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jig/lisp/types"
+)
+
+func TestNamespaces(t *testing.T) {
+	root := NewEnv()
+	root.Set(types.Symbol{Val: "x"}, "user x")
+	loads := 0
+	RegisterLibrary(root, "lib.x", func(ns types.EnvType) error {
+		loads++
+		ns.Set(types.Symbol{Val: "x"}, "lib.x x")
+		ns.Set(types.Symbol{Val: "secret"}, 42)
+		SetPrivate(ns, "secret")
+		return nil
+	})
+
+	ctx := WithNamespace(context.Background())
+	if err := InNamespace(ctx, root, "my.app"); err != nil {
+		t.Fatal(err)
+	}
+	if CurrentNamespace(ctx, root) != "my.app" {
+		t.Fatalf("expected my.app got %s", CurrentNamespace(ctx, root))
+	}
+	app := NamespaceEnv(ctx, root)
+	if app == root {
+		t.Fatal("expected the my.app environment")
+	}
+	// other evaluations are not affected
+	if other := WithNamespace(context.Background()); CurrentNamespace(other, root) != UserNamespace || NamespaceEnv(other, root) != root {
+		t.Fatalf("unexpected namespace %s", CurrentNamespace(other, root))
+	}
+	// nested evaluations start on the current namespace, and don't change it
+	nested := WithNamespace(ctx)
+	if CurrentNamespace(nested, root) != "my.app" {
+		t.Fatalf("expected my.app got %s", CurrentNamespace(nested, root))
+	}
+	if err := InNamespace(nested, root, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if CurrentNamespace(ctx, root) != "my.app" {
+		t.Fatalf("expected my.app got %s", CurrentNamespace(ctx, root))
+	}
+	if err := InNamespace(context.Background(), root, "other"); err == nil {
+		t.Fatal("expected an error setting the namespace out of an evaluation")
+	}
+	for i := 0; i < 2; i++ {
+		if err := Require(ctx, root, "lib.x", "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("library loaded %d times", loads)
+	}
+
+	for sym, expected := range map[string]types.MalType{
+		"x":       "user x",
+		"x/x":     "lib.x x",
+		"lib.x/x": "lib.x x",
+		"user/x":  "user x",
+	} {
+		v, err := app.Get(types.Symbol{Val: sym})
+		if err != nil {
+			t.Fatalf("%s: %s", sym, err)
+		}
+		if v != expected {
+			t.Fatalf("%s: expected %v got %v", sym, expected, v)
+		}
+	}
+	// aliases belong to the namespace requiring the library
+	if _, err := root.Get(types.Symbol{Val: "x/x"}); err == nil {
+		t.Fatal("alias resolved out of its namespace")
+	}
+	if _, err := app.Get(types.Symbol{Val: "x/secret"}); err == nil || !strings.Contains(err.Error(), "private") {
+		t.Fatalf("expected a private error got %v", err)
+	}
+
+	publics, err := Publics(root, "lib.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := publics.Get(types.Symbol{Val: "x"}); publics.Len() != 1 || x != "lib.x x" {
+		t.Fatalf("unexpected publics %v", publics.Map())
+	}
+	if err := Require(ctx, root, "lib.unknown", ""); err == nil {
+		t.Fatal("expected an error requiring an unregistered library")
+	}
+
+	if err := InNamespace(ctx, root, UserNamespace); err != nil {
+		t.Fatal(err)
+	}
+	if NamespaceEnv(ctx, root) != root {
+		t.Fatal("expected the user namespace to be the root environment")
+	}
+	// subordinate environments are not affected by the current namespace
+	sub := NewSubordinateEnv(root)
+	if NamespaceEnv(ctx, sub) != sub {
+		t.Fatal("unexpected namespace environment")
+	}
+}
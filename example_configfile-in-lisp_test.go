@@ -20,7 +20,8 @@ func Example_configInLisp() {
 		ns,
 	)
 
-	fmt.Println("sessions:", config.(types.HashMap).Val[types.NewKeyword("sessions")])
+	sessions, _ := config.(types.HashMap).Get(types.NewKeyword("sessions"))
+	fmt.Println("sessions:", sessions)
 
 	// Output:
 	// sessions: 10
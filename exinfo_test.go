@@ -0,0 +1,37 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/types"
+)
+
+func TestExInfoErrorsAs(t *testing.T) {
+	ns := newEnv(t.Name())
+	_, err := REPL(context.Background(), ns, `(throw (ex-info "invalid age" {:type :validation :field "age"} (go-error "negative")))`, types.NewCursorFile(t.Name()))
+	var exInfo *lisperror.ExInfo
+	if !errors.As(err, &exInfo) {
+		t.Fatalf("expected an ex-info error got %T: %s", err, err)
+	}
+	typ, _ := exInfo.Data.Get("ʞtype")
+	field, _ := exInfo.Data.Get("ʞfield")
+	if exInfo.Message != "invalid age" || typ != "ʞvalidation" || field != "age" {
+		t.Fatalf("unexpected ex-info %s", PRINT(exInfo))
+	}
+	if cause := errors.Unwrap(exInfo); cause == nil || cause.Error() != "negative" {
+		t.Fatalf("unexpected cause %v", cause)
+	}
+
+	hm, err := exInfo.MarshalHashMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, _ := hm.(types.HashMap).Get("ʞmessage")
+	cause, _ := hm.(types.HashMap).Get("ʞcause")
+	if message != "invalid age" || cause != `«go-error "negative"»` {
+		t.Fatalf("unexpected marshaled ex-info %s", PRINT(hm))
+	}
+}
@@ -0,0 +1,129 @@
+package lisp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jig/lisp/debuggertypes"
+	. "github.com/jig/lisp/types"
+)
+
+// Options are the hooks of an [Interpreter]
+type Options struct {
+	// Stepper is called (if not nil) to stop at each step of the Lisp interpreter.
+	//
+	// It might be used as a debugger. Look at [lisp/debugger] package for a simple implementation.
+	Stepper func(ast MalType, ns EnvType) debuggertypes.Command
+	// Trace is called (if not nil) after each step of the Lisp interpreter with its result.
+	Trace func(ast MalType, ns EnvType, result MalType, err error)
+}
+
+// Interpreter carries the hooks and the debugger state of an evaluation. Interpreters
+// are independent of each other: each one might be debugged or traced separately.
+//
+// An Interpreter is passed to [EVAL] in the context (see [Interpreter.WithContext]).
+// [EVAL] calls made with a context without Interpreter run without hooks.
+type Interpreter struct {
+	opts Options
+
+	mu               sync.Mutex
+	skip             bool
+	outing1, outing2 bool
+}
+
+type interpreterKey struct{}
+
+// NewInterpreter returns an interpreter with the given hooks
+func NewInterpreter(opts Options) *Interpreter {
+	return &Interpreter{opts: opts}
+}
+
+// WithContext returns a copy of ctx that carries the interpreter
+func (in *Interpreter) WithContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, interpreterKey{}, in)
+}
+
+// InterpreterFromContext returns the interpreter carried by ctx, or nil
+func InterpreterFromContext(ctx context.Context) *Interpreter {
+	if ctx == nil {
+		return nil
+	}
+	in, _ := ctx.Value(interpreterKey{}).(*Interpreter)
+	return in
+}
+
+// debugging is true if each step must be evaluated on its own EVAL call (no TCO)
+func (in *Interpreter) debugging() bool {
+	return in != nil && (in.opts.Stepper != nil || in.opts.Trace != nil)
+}
+
+// step calls the stepper before evaluating ast and returns the function to be called
+// once ast has been evaluated
+func (in *Interpreter) step(ast MalType, env EnvType) func(res MalType, e error) {
+	in.mu.Lock()
+	skip := in.skip
+	in.mu.Unlock()
+
+	var next bool
+	if !skip {
+		cmd := in.opts.Stepper(ast, env)
+
+		in.mu.Lock()
+		switch cmd {
+		case debuggertypes.Next:
+			in.skip = true
+			next = true
+		case debuggertypes.In:
+			in.skip = false
+			in.outing1 = false
+		case debuggertypes.Out:
+			in.skip = true
+			in.outing1 = true
+		case debuggertypes.NoOp:
+		default:
+			in.mu.Unlock()
+			panic(fmt.Errorf("debugger command not handled %d", cmd))
+		}
+		in.mu.Unlock()
+	}
+
+	in.mu.Lock()
+	outing2 := in.outing2
+	in.mu.Unlock()
+
+	return func(res MalType, e error) {
+		in.mu.Lock()
+		if outing2 {
+			in.skip = false
+			in.outing2 = false
+		}
+		if next {
+			in.skip = false
+		}
+		in.mu.Unlock()
+		if next {
+			if e != nil {
+				fmt.Println("ERROR: ", PRINT(e))
+			} else {
+				fmt.Println("ANSWER: ", PRINT(res))
+			}
+		}
+	}
+}
+
+// stepOut returns true if the debugger is stepping out of the current expression
+func (in *Interpreter) stepOut() bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.outing1
+}
+
+// steppedOut is called once the expression the debugger was stepping out of is evaluated
+func (in *Interpreter) steppedOut() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.skip = true
+	in.outing1 = false
+	in.outing2 = true
+}
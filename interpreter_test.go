@@ -0,0 +1,94 @@
+package lisp
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jig/lisp/debuggertypes"
+	"github.com/jig/lisp/types"
+)
+
+const interpreterCode = `(do
+	(def sq (fn [x] (* x x)))
+	(def f (future (sq 3)))
+	(+ (sq 2) @f))`
+
+type tracer struct {
+	mu      sync.Mutex
+	modules map[string]int
+}
+
+func (tr *tracer) trace(ast types.MalType, _ types.EnvType, _ types.MalType, _ error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if list, ok := ast.(types.List); ok && list.Cursor != nil && list.Cursor.Module != nil {
+		tr.modules[*list.Cursor.Module]++
+	}
+}
+
+func TestIndependentInterpreters(t *testing.T) {
+	tracers := []*tracer{{modules: map[string]int{}}, {modules: map[string]int{}}}
+	var wg sync.WaitGroup
+	for i, tr := range tracers {
+		wg.Add(1)
+		go func(module string, tr *tracer) {
+			defer wg.Done()
+			env := newEnv(module)
+			ctx := NewInterpreter(Options{Trace: tr.trace}).WithContext(context.Background())
+			res, err := REPL(ctx, env, interpreterCode, types.NewCursorFile(module))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res != "13" {
+				t.Errorf("expected 13 got %s", res)
+			}
+		}([]string{"first", "second"}[i], tr)
+	}
+	// an evaluation without interpreter is not traced
+	if _, err := REPL(context.Background(), newEnv("untraced"), interpreterCode, types.NewCursorFile("untraced")); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	modules := []string{"first", "second"}
+	for i, module := range modules {
+		if tracers[i].modules[module] == 0 {
+			t.Fatalf("%s not traced", module)
+		}
+		for _, other := range []string{modules[1-i], "untraced"} {
+			if tracers[i].modules[other] != 0 {
+				t.Fatalf("%s traced on the interpreter of %s", other, module)
+			}
+		}
+	}
+}
+
+func TestInterpreterStepper(t *testing.T) {
+	var wg sync.WaitGroup
+	steps := make([]int, 2)
+	for i, cmd := range []debuggertypes.Command{debuggertypes.Next, debuggertypes.NoOp} {
+		wg.Add(1)
+		go func(i int, cmd debuggertypes.Command) {
+			defer wg.Done()
+			env := newEnv(t.Name())
+			in := NewInterpreter(Options{Stepper: func(ast types.MalType, ns types.EnvType) debuggertypes.Command {
+				steps[i]++
+				return cmd
+			}})
+			if _, err := REPL(in.WithContext(context.Background()), env, `(+ 1 (* 2 3))`, types.NewCursorFile(t.Name())); err != nil {
+				t.Error(err)
+			}
+		}(i, cmd)
+	}
+	wg.Wait()
+
+	// Next on the first expression skips its inner expressions
+	if steps[0] != 1 {
+		t.Fatalf("expected 1 step got %d", steps[0])
+	}
+	if steps[1] <= 1 {
+		t.Fatalf("expected several steps got %d", steps[1])
+	}
+}
@@ -0,0 +1,190 @@
+package lisp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jig/lisp"
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/core"
+	"github.com/jig/lisp/lib/core/nscore"
+	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/types"
+)
+
+func newIOEnv(t *testing.T) types.EnvType {
+	t.Helper()
+	ns := env.NewEnv()
+	if err := nscore.Load(ns); err != nil {
+		t.Fatal(err)
+	}
+	if err := nscore.LoadInput(ns); err != nil {
+		t.Fatal(err)
+	}
+	return ns
+}
+
+func TestWithIOCapturesEachRequest(t *testing.T) {
+	ns := newIOEnv(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var out, errOut bytes.Buffer
+			ctx, err := core.WithIO(context.Background(), ns, core.IO{Out: &out, Err: &errOut})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			code := fmt.Sprintf(`(do (prn %d) (println "request" %d) (binding [*out* *err*] (prn :err)))`, i, i)
+			if _, err := lisp.REPL(ctx, ns, code, types.NewCursorFile(t.Name())); err != nil {
+				t.Error(err)
+				return
+			}
+			if expected := fmt.Sprintf("%d\nrequest %d\n", i, i); out.String() != expected {
+				t.Errorf("expected %q got %q", expected, out.String())
+			}
+			if errOut.String() != ":err\n" {
+				t.Errorf("expected %q got %q", ":err\n", errOut.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWithIOInput(t *testing.T) {
+	ns := newIOEnv(t)
+	var out bytes.Buffer
+	ctx, err := core.WithIO(context.Background(), ns, core.IO{
+		Out: &out,
+		In:  strings.NewReader("first\r\nsecond"),
+		FS:  fstest.MapFS{"conf/app.lisp": {Data: []byte("(+ 1 2)")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for code, expected := range map[string]string{
+		`[(read-line "> ") (read-line "> ") (read-line "> ")]`: `["first" "second" ""]`,
+		`(slurp "conf/app.lisp")`:                              `"(+ 1 2)"`,
+		`(load-file "conf/app.lisp")`:                          `nil`,
+	} {
+		res, err := lisp.REPL(ctx, ns, code, types.NewCursorFile(t.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != expected {
+			t.Fatalf("%s: expected %s got %s", code, expected, res)
+		}
+	}
+	if out.String() != "> > > " {
+		t.Fatalf("expected the prompts got %q", out.String())
+	}
+	if _, err := lisp.REPL(ctx, ns, `(slurp "/etc/passwd")`, types.NewCursorFile(t.Name())); err == nil {
+		t.Fatal("slurp must only read from the configured file system")
+	}
+}
+
+func TestWithOutStr(t *testing.T) {
+	ns := newIOEnv(t)
+	var out bytes.Buffer
+	ctx, err := core.WithIO(context.Background(), ns, core.IO{Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := lisp.REPL(ctx, ns, `(do (prn :before) [(with-out-str (prn 1) (println "two" [3]) (with-out-str (prn :nested)))])`, types.NewCursorFile(t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `["1\ntwo [3]\n"]`; res != expected {
+		t.Fatalf("expected %s got %s", expected, res)
+	}
+	if out.String() != ":before\n" {
+		t.Fatalf("expected :before got %q", out.String())
+	}
+}
+
+func TestLoadFileFormByForm(t *testing.T) {
+	ns := newIOEnv(t)
+	ctx, err := core.WithIO(context.Background(), ns, core.IO{
+		FS: fstest.MapFS{"lib.lisp": {Data: []byte("(def a 1) (def b 2)\n\n(undefined-fn a)\n(def c 3)")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lisp.REPL(ctx, ns, `(load-file "lib.lisp")`, types.NewCursorFile(t.Name()))
+	var lerr lisperror.LispError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expected a lisp error got %v", err)
+	}
+	if pos := lerr.Position(); pos == nil || *pos.Module != "lib.lisp" || pos.BeginRow != 3 {
+		t.Fatalf("expected the error on lib.lisp row 3 got %s", pos)
+	}
+	if _, ok := lisperror.Source("lib.lisp"); !ok {
+		t.Fatal("source of lib.lisp not registered")
+	}
+	// the forms before the failing one were evaluated
+	if res, err := lisp.REPL(ctx, ns, `[a b]`, types.NewCursorFile(t.Name())); err != nil || res != "[1 2]" {
+		t.Fatalf("unexpected %v (%v)", res, err)
+	}
+	if _, err := lisp.REPL(ctx, ns, `c`, types.NewCursorFile(t.Name())); err == nil {
+		t.Fatal("c must not be defined")
+	}
+}
+
+func TestNamespacePerEvaluation(t *testing.T) {
+	ns := newIOEnv(t)
+	if _, err := lisp.ReadEvalAll(context.Background(), ns, strings.NewReader("(in-ns 'evil)\n(def x :evil)"), nil); err != nil {
+		t.Fatal(err)
+	}
+	// the next script is evaluated on the user namespace
+	res, err := lisp.ReadEvalAll(context.Background(), ns, strings.NewReader("(def x :host)\n(ns-name)"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "user" {
+		t.Fatalf("expected user got %v", res)
+	}
+	if x, err := ns.Get(types.Symbol{Val: "x"}); err != nil || x != "ʞhost" {
+		t.Fatalf("unexpected x %v (%v)", x, err)
+	}
+	if x, err := lisp.EVAL(context.Background(), types.Symbol{Val: "evil/x"}, ns); err != nil || x != "ʞevil" {
+		t.Fatalf("unexpected evil/x %v (%v)", x, err)
+	}
+
+	// a loaded file doesn't change the namespace of a REPL session
+	ctx, err := core.WithIO(env.WithNamespace(context.Background()), ns, core.IO{
+		FS: fstest.MapFS{"evil.lisp": {Data: []byte("(in-ns 'evil)")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{`(in-ns 'app)`, `(load-file "evil.lisp")`} {
+		if _, err := lisp.REPL(ctx, ns, code, types.NewCursorFile(t.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if res, err := lisp.REPL(ctx, ns, `(ns-name)`, types.NewCursorFile(t.Name())); err != nil || res != `"app"` {
+		t.Fatalf("expected app got %v (%v)", res, err)
+	}
+}
+
+func TestReadEvalAll(t *testing.T) {
+	ns := newIOEnv(t)
+	res, err := lisp.ReadEvalAll(context.Background(), ns, strings.NewReader("(def x 20)\n(+ x 1)\n(* x 2)"), types.NewCursorFile(t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != 40 {
+		t.Fatalf("expected 40 got %v", res)
+	}
+	if res, err := lisp.ReadEvalAll(context.Background(), ns, strings.NewReader(" ; nothing\n"), nil); err != nil || res != nil {
+		t.Fatalf("expected nil got %v (%v)", res, err)
+	}
+}
@@ -117,16 +117,12 @@ func call(overrideFN *string, namespace types.EnvType, fIn types.MalType, args .
 
 	_, err := namespace.Update(types.Symbol{Val: "_PACKAGES_"}, func(_hm types.MalType) (types.MalType, error) {
 		if _hm == nil {
-			_hm = types.HashMap{Val: make(map[string]types.MalType)}
+			_hm = types.HashMap{}
 		}
 		hm := _hm.(types.HashMap)
-		set, ok := hm.Val[packageName].(types.Set)
-		if !ok {
-			set = types.Set{Val: make(map[string]struct{})}
-		}
-		set.Val[functionName] = struct{}{}
-		hm.Val[packageName] = set
-		return hm, nil
+		set, _ := hm.Get(packageName)
+		packageSet, _ := set.(types.Set)
+		return hm.Assoc(packageName, packageSet.Conj(functionName)), nil
 	})
 	if err != nil {
 		panic(fmt.Errorf("%s: error loading implementation", packageName))
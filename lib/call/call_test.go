@@ -95,20 +95,21 @@ func TestPackageRegister(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	set := hm.(types.HashMap).Val["github.com/jig/lisp/lib/call"].(types.Set).Val
-	if len(set) != 4 {
+	pkg, _ := hm.(types.HashMap).Get("github.com/jig/lisp/lib/call")
+	set := pkg.(types.Set)
+	if set.Len() != 4 {
 		t.Fatal("test failed")
 	}
-	if _, ok := set["divexample"]; !ok {
+	if !set.Contains("divexample") {
 		t.Fatal("test failed")
 	}
-	if _, ok := set["sleepexample"]; !ok {
+	if !set.Contains("sleepexample") {
 		t.Fatal("test failed")
 	}
-	if _, ok := set["name-with-hyphens"]; !ok {
+	if !set.Contains("name-with-hyphens") {
 		t.Fatal("test failed")
 	}
-	if _, ok := set["name-with-caps"]; !ok {
+	if !set.Contains("name-with-caps") {
 		t.Fatal("test failed")
 	}
 }
@@ -252,11 +253,11 @@ func count(seq types.MalType) (types.MalType, error) {
 	case types.List:
 		return len(seq.Val), nil
 	case types.Vector:
-		return len(seq.Val), nil
+		return seq.Len(), nil
 	case types.HashMap:
-		return len(seq.Val), nil
+		return seq.Len(), nil
 	case types.Set:
-		return len(seq.Val), nil
+		return seq.Len(), nil
 	case nil:
 		return 0, nil
 	default:
@@ -269,11 +270,11 @@ func empty_Q(seq types.MalType) (types.MalType, error) {
 	case types.List:
 		return len(seq.Val) == 0, nil
 	case types.Vector:
-		return len(seq.Val) == 0, nil
+		return seq.Len() == 0, nil
 	case types.HashMap:
-		return len(seq.Val) == 0, nil
+		return seq.Len() == 0, nil
 	case types.Set:
-		return len(seq.Val) == 0, nil
+		return seq.Len() == 0, nil
 	case nil:
 		return true, nil
 	default:
@@ -4,9 +4,11 @@ import (
 	"context"
 	_ "embed"
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/jig/lisp/lib/call"
+	"github.com/jig/lisp/lisperror"
 	"github.com/jig/lisp/types"
 	. "github.com/jig/lisp/types"
 )
@@ -122,6 +124,12 @@ func NewFuture(ctx context.Context, fn MalFunc) *Future {
 	}
 	go func() {
 		defer func() { f.Done = true }()
+		defer func() {
+			// a panic of the goroutine would crash the host, whatever the caller recovers
+			if r := recover(); r != nil {
+				f.ErrChan <- lisperror.NewLispError(fmt.Errorf("panic: %v", r), nil)
+			}
+		}()
 		res, err := Apply(ctx, fn, nil)
 		if err != nil {
 			f.ErrChan <- err
@@ -1,7 +1,6 @@
 package core
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	_ "embed"
@@ -9,12 +8,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"math"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	spew "github.com/davecgh/go-spew/spew"
 	"github.com/google/uuid"
 	"github.com/jig/lisp/lib/call"
 	"github.com/jig/lisp/lisperror"
@@ -28,24 +28,22 @@ import (
 //go:embed header-basic.lisp
 var headerBasic string
 
-//go:embed header-load-file.lisp
-var headerLoadFile string
-
-func HeaderBasic() string    { return headerBasic }
-func HeaderLoadFile() string { return headerLoadFile }
+func HeaderBasic() string { return headerBasic }
 
 func Load(env EnvType) {
+	loadNamespaces(env)
+	loadIO(env)
 	call.Call(env, assoc_in)
 	call.Call(env, update)
 	call.Call(env, update_in)
-	call.CallOverrideFN(env, "<", func(a, b int) (bool, error) { return a < b, nil })
-	call.CallOverrideFN(env, "<=", func(a, b int) (bool, error) { return a <= b, nil })
-	call.CallOverrideFN(env, ">", func(a, b int) (bool, error) { return a > b, nil })
-	call.CallOverrideFN(env, ">=", func(a, b int) (bool, error) { return a >= b, nil })
-	call.CallOverrideFN(env, "+", func(a, b int) (int, error) { return a + b, nil })
-	call.CallOverrideFN(env, "-", func(a, b int) (int, error) { return a - b, nil })
-	call.CallOverrideFN(env, "*", func(a, b int) (int, error) { return a * b, nil })
-	call.CallOverrideFN(env, "/", func(a, b int) (int, error) { return a / b, nil })
+	call.CallOverrideFN(env, "<", func(a ...MalType) (bool, error) { return ltOp.chain(a) }, 1)
+	call.CallOverrideFN(env, "<=", func(a ...MalType) (bool, error) { return leOp.chain(a) }, 1)
+	call.CallOverrideFN(env, ">", func(a ...MalType) (bool, error) { return gtOp.chain(a) }, 1)
+	call.CallOverrideFN(env, ">=", func(a ...MalType) (bool, error) { return geOp.chain(a) }, 1)
+	call.CallOverrideFN(env, "+", func(a ...MalType) (MalType, error) { return add(a...) })
+	call.CallOverrideFN(env, "-", func(a ...MalType) (MalType, error) { return subtract(a...) }, 1)
+	call.CallOverrideFN(env, "*", func(a ...MalType) (MalType, error) { return multiply(a...) })
+	call.CallOverrideFN(env, "/", func(a ...MalType) (MalType, error) { return divide(a...) }, 1)
 	call.Call(env, get)
 	call.Call(env, get_in)
 	call.CallOverrideFN(env, "contains?", contains_Q)
@@ -60,6 +58,8 @@ func Load(env EnvType) {
 	call.Call(env, split)
 	call.Call(env, mAp)
 	call.Call(env, throw)
+	call.Call(env, iNt)
+	call.Call(env, char)
 	call.CallOverrideFN(env, "symbol", func(a string) (Symbol, error) { return Symbol{Val: a}, nil })
 	call.CallOverrideFN(env, "keyword", func(a string) (string, error) {
 		if Keyword_Q(a) {
@@ -68,7 +68,6 @@ func Load(env EnvType) {
 			return NewKeyword(a), nil
 		}
 	})
-	call.Call(env, sPew)
 	call.CallOverrideFN(env, "read-string", func(a MalType) (MalType, error) { return reader.Read_str(a.(string), nil, nil) })
 	call.CallOverrideFN(env, "set", func(a MalType) (Set, error) { return NewSet(a) })
 	call.Call(env, keys)
@@ -91,10 +90,8 @@ func Load(env EnvType) {
 	call.Call(env, uUid)
 	call.Call(env, pr_str)
 	call.Call(env, str)
-	call.Call(env, prn)
-	call.Call(env, println)
 	call.CallOverrideFN(env, "list", func(a ...MalType) (List, error) { return List{Val: a}, nil })
-	call.CallOverrideFN(env, "vector", func(a ...MalType) (Vector, error) { return Vector{Val: a}, nil })
+	call.CallOverrideFN(env, "vector", func(a ...MalType) (Vector, error) { return NewVector(a...), nil })
 	call.Call(env, hash_map)
 	call.CallOverrideFN(env, "hash-set", func(a ...MalType) (Set, error) { return NewSet(List{Val: a}) })
 	call.Call(env, assoc)
@@ -110,7 +107,10 @@ func Load(env EnvType) {
 	call.CallOverrideFN(env, "symbol?", func(a MalType) (bool, error) { return Q[Symbol](a), nil })
 	call.CallOverrideFN(env, "keyword?", func(a MalType) (bool, error) { return Keyword_Q(a), nil })
 	call.CallOverrideFN(env, "string?", func(a MalType) (bool, error) { return String_Q(a), nil })
-	call.CallOverrideFN(env, "number?", func(a MalType) (bool, error) { return Q[int](a), nil })
+	call.CallOverrideFN(env, "char?", func(a MalType) (bool, error) { return Q[Char](a), nil })
+	call.CallOverrideFN(env, "number?", func(a MalType) (bool, error) { return number_Q(a) })
+	call.CallOverrideFN(env, "integer?", func(a MalType) (bool, error) { return integer_Q(a) })
+	call.CallOverrideFN(env, "decimal?", func(a MalType) (bool, error) { return Q[Decimal](a), nil })
 	call.CallOverrideFN(env, "fn?", fn_q)
 	call.CallOverrideFN(env, "macro?", func(a MalType) (bool, error) { return Q[MalFunc](a) && a.(MalFunc).GetMacro(), nil })
 	call.CallOverrideFN(env, "list?", func(a MalType) (bool, error) { return Q[List](a), nil })
@@ -128,6 +128,11 @@ func Load(env EnvType) {
 	call.Call(env, unwrap_error)
 	call.Call(env, error_string)
 
+	call.Call(env, ex_info, 2, 3) // message, data and optional cause
+	call.Call(env, ex_data)
+	call.Call(env, ex_message)
+	call.Call(env, ex_cause)
+
 	call.CallOverrideFN(env, "type?", istype)
 	call.Call(env, new_error, 1, 2)
 	call.Call(env, new_go_error)
@@ -138,6 +143,9 @@ func Load(env EnvType) {
 	call.Call(env, drop)
 	call.Call(env, drop_last)
 	call.Call(env, subvec, 2, 3)
+
+	call.Call(env, bigint)
+	call.Call(env, bigdec)
 }
 
 func subvec(args ...MalType) (MalType, error) {
@@ -152,14 +160,12 @@ func subvec(args ...MalType) (MalType, error) {
 	var from, to int
 	if l == 2 {
 		from = args[1].(int)
-		to = len(v.Val)
+		to = v.Len()
 	} else {
 		from = args[1].(int)
 		to = args[2].(int)
 	}
-	return Vector{
-		Val: v.Val[from:to],
-	}, nil
+	return NewVector(v.Slice()[from:to]...), nil
 }
 
 func take(elems int, arg MalType) (MalType, error) {
@@ -172,8 +178,8 @@ func take(elems int, arg MalType) (MalType, error) {
 			new_list.Val = append(new_list.Val, arg.Val[i])
 		}
 	case Vector:
-		for i := 0; i < elems && i < len(arg.Val); i++ {
-			new_list.Val = append(new_list.Val, arg.Val[i])
+		for i := 0; i < elems && i < arg.Len(); i++ {
+			new_list.Val = append(new_list.Val, arg.Nth(i))
 		}
 	case nil:
 		// if nil return an empty list
@@ -201,12 +207,12 @@ func take_last(elems int, arg MalType) (MalType, error) {
 			new_list.Val = append(new_list.Val, arg.Val[i])
 		}
 	case Vector:
-		start := len(arg.Val) - elems
+		start := arg.Len() - elems
 		if start < 0 {
 			start = 0
 		}
-		for i := start; i < len(arg.Val); i++ {
-			new_list.Val = append(new_list.Val, arg.Val[i])
+		for i := start; i < arg.Len(); i++ {
+			new_list.Val = append(new_list.Val, arg.Nth(i))
 		}
 	case nil:
 		// if nil return an empty list
@@ -233,8 +239,8 @@ func drop(n int, arg MalType) (MalType, error) {
 			new_list.Val = append(new_list.Val, arg.Val[i])
 		}
 	case Vector:
-		for i := n; i < len(arg.Val); i++ {
-			new_list.Val = append(new_list.Val, arg.Val[i])
+		for i := n; i < arg.Len(); i++ {
+			new_list.Val = append(new_list.Val, arg.Nth(i))
 		}
 	case nil:
 		// if nil return an empty list
@@ -257,8 +263,8 @@ func drop_last(n int, arg MalType) (MalType, error) {
 			new_list.Val = append(new_list.Val, arg.Val[i])
 		}
 	case Vector:
-		for i := 0; i < len(arg.Val)-n; i++ {
-			new_list.Val = append(new_list.Val, arg.Val[i])
+		for i := 0; i < arg.Len()-n; i++ {
+			new_list.Val = append(new_list.Val, arg.Nth(i))
 		}
 	case nil:
 		// if nil return an empty list
@@ -269,8 +275,7 @@ func drop_last(n int, arg MalType) (MalType, error) {
 }
 
 func LoadInput(env EnvType) {
-	call.Call(env, slurp)
-	call.Call(env, readLine)
+	loadInput(env)
 }
 
 func version() (HashMap, error) {
@@ -285,23 +290,23 @@ func version() (HashMap, error) {
 	deps := map[string]MalType{}
 	for _, d := range bi.Deps {
 		if d.Replace == nil {
-			deps[d.Path] = HashMap{Val: map[string]MalType{
+			deps[d.Path] = NewHashMapFromMap(map[string]MalType{
 				"ʞversion": d.Version,
 				"ʞsum":     d.Sum,
-			}}
+			})
 		} else {
-			deps[d.Path] = HashMap{Val: map[string]MalType{
+			deps[d.Path] = NewHashMapFromMap(map[string]MalType{
 				"ʞversion": d.Version,
 				"ʞsum":     d.Sum,
 				"ʞreplace": d.Replace,
-			}}
+			})
 		}
 	}
-	return HashMap{Val: map[string]MalType{
+	return NewHashMapFromMap(map[string]MalType{
 		"ʞgo-version":   bi.GoVersion,
-		"ʞbuild":        HashMap{Val: build},
-		"ʞdependencies": HashMap{Val: deps},
-	}}, nil
+		"ʞbuild":        NewHashMapFromMap(build),
+		"ʞdependencies": NewHashMapFromMap(deps),
+	}), nil
 }
 
 func new_go_error(str string) (error, error) {
@@ -337,6 +342,53 @@ func error_string(err error) (string, error) {
 	return err.Error(), nil
 }
 
+// ex_info returns an error with a message, a data map and an optional cause
+func ex_info(message string, data HashMap, cause ...MalType) (*lisperror.ExInfo, error) {
+	if len(cause) == 0 || cause[0] == nil {
+		return lisperror.NewExInfo(message, data, nil), nil
+	}
+	switch c := cause[0].(type) {
+	case error:
+		return lisperror.NewExInfo(message, data, c), nil
+	default:
+		return lisperror.NewExInfo(message, data, lisperror.NewLispError(c, nil)), nil
+	}
+}
+
+func ex_data(err MalType) (MalType, error) {
+	if exInfo, ok := asExInfo(err); ok {
+		return exInfo.Data, nil
+	}
+	return nil, nil
+}
+
+func ex_message(err MalType) (MalType, error) {
+	if exInfo, ok := asExInfo(err); ok {
+		return exInfo.Message, nil
+	}
+	if err, ok := err.(error); ok {
+		return err.Error(), nil
+	}
+	return nil, nil
+}
+
+func ex_cause(err MalType) (MalType, error) {
+	if err, ok := err.(error); ok {
+		if cause := errors.Unwrap(err); cause != nil {
+			return cause, nil
+		}
+	}
+	return nil, nil
+}
+
+func asExInfo(err MalType) (*lisperror.ExInfo, bool) {
+	var exInfo *lisperror.ExInfo
+	if err, ok := err.(error); ok && errors.As(err, &exInfo) {
+		return exInfo, true
+	}
+	return nil, false
+}
+
 func go_error(format string, args ...MalType) (MalType, error) {
 	if len(args) == 0 {
 		return errors.New(format), nil
@@ -349,41 +401,7 @@ func go_error(format string, args ...MalType) (MalType, error) {
 }
 
 func istype(arg MalType) (string, error) {
-	switch arg := arg.(type) {
-	case nil:
-		return "nil", nil
-	case List:
-		return "list", nil
-	case HashMap:
-		return "hash-map", nil
-	case Vector:
-		return "vector", nil
-	case Set:
-		return "set", nil
-	case int:
-		return "integer", nil
-	case bool:
-		return "boolean", nil
-	case Symbol:
-		return "symbol", nil
-	case string:
-		if len(arg) != 0 && strings.HasPrefix(arg, "ʞ") {
-			return "keyword", nil
-		}
-		return "string", nil
-	case MalFunc:
-		return "function", nil
-	case interface{ ErrorValue() MalType }:
-		return "error", nil
-	case Typed:
-		return arg.Type(), nil
-	case error:
-		return "go-error", nil
-	case Func:
-		return "go-function", nil
-	default:
-		return fmt.Sprintf("unsupported(%T)", arg), nil
-	}
+	return TypeName(arg), nil
 }
 
 func fn_q(a MalType) (MalType, error) {
@@ -392,6 +410,8 @@ func fn_q(a MalType) (MalType, error) {
 		return !f.GetMacro(), nil
 	case Func:
 		return true, nil
+	case Callable:
+		return true, nil
 	case func([]MalType) (MalType, error):
 		return true, nil
 	default:
@@ -401,35 +421,51 @@ func fn_q(a MalType) (MalType, error) {
 
 // String functions
 
-func pr_str(a ...MalType) (MalType, error) {
-	return printer.Pr_list(a, true, "", "", " "), nil
-}
-
-func str(a ...MalType) (string, error) {
-	return printer.Pr_list(a, false, "", "", ""), nil
+func pr_str(ctx context.Context, a ...MalType) (MalType, error) {
+	return printer.PrintList(a, true, KeyOrderFromContext(ctx), " "), nil
 }
 
-func sPew(a MalType) (MalType, error) {
-	spew.Dump(a)
-	return nil, nil
+func str(ctx context.Context, a ...MalType) (string, error) {
+	return printer.PrintList(a, false, KeyOrderFromContext(ctx), ""), nil
 }
 
-func prn(a ...MalType) (MalType, error) {
-	fmt.Println(printer.Pr_list(a, true, "", "", " "))
-	return nil, nil
-}
+// Character functions
 
-func println(a ...MalType) (MalType, error) {
-	fmt.Println(printer.Pr_list(a, false, "", "", " "))
-	return nil, nil
+// iNt implements int: the code point of a character, or a number truncated to an integer
+func iNt(a MalType) (int, error) {
+	switch a := a.(type) {
+	case Char:
+		return int(a), nil
+	case int:
+		return a, nil
+	case float64:
+		if math.IsNaN(a) || a < math.MinInt64 || a >= math.MaxInt64 {
+			return 0, fmt.Errorf("%s out of the integer range", printer.Pr_str(a, true))
+		}
+		return int(a), nil
+	case BigInt:
+		if !a.Val.IsInt64() {
+			return 0, fmt.Errorf("%sN out of the integer range", a.Val)
+		}
+		return int(a.Val.Int64()), nil
+	default:
+		return 0, fmt.Errorf("int called on %s", TypeName(a))
+	}
 }
 
-func slurp(fileName string) (MalType, error) {
-	b, e := os.ReadFile(fileName)
-	if e != nil {
-		return nil, e
+// char returns the character of a code point
+func char(a MalType) (Char, error) {
+	switch a := a.(type) {
+	case Char:
+		return a, nil
+	case int:
+		if !utf8.ValidRune(rune(a)) || a != int(rune(a)) {
+			return 0, fmt.Errorf("invalid code point %d", a)
+		}
+		return Char(a), nil
+	default:
+		return 0, fmt.Errorf("char called on %s", TypeName(a))
 	}
-	return string(b), nil
 }
 
 // Number functions
@@ -442,28 +478,6 @@ func time_ns() (int, error) {
 }
 
 // Hash Map, Set, Vector functions
-func copy_hash_map(hm HashMap) HashMap {
-	new_hm := HashMap{Val: map[string]MalType{}}
-	for k, v := range hm.Val {
-		new_hm.Val[k] = v
-	}
-	return new_hm
-}
-
-func copy_set(s Set) Set {
-	new_s := Set{Val: map[string]struct{}{}}
-	for k, v := range s.Val {
-		new_s.Val[k] = v
-	}
-	return new_s
-}
-
-func copy_vector(v Vector) Vector {
-	return Vector{
-		Val: append([]MalType{}, v.Val...),
-	}
-}
-
 func assoc(a ...MalType) (MalType, error) {
 	ms := a[0]
 	switch ms := ms.(type) {
@@ -474,39 +488,32 @@ func assoc(a ...MalType) (MalType, error) {
 		if len(a)%2 != 1 {
 			return nil, errors.New("assoc requires odd number of arguments")
 		}
-		new_hm := copy_hash_map(ms)
+		new_hm := ms
 		for i := 1; i < len(a); i += 2 {
-			key := a[i]
-			if !Q[string](key) {
-				return nil, errors.New("assoc called with non-string key")
-			}
-			new_hm.Val[key.(string)] = a[i+1]
+			new_hm = new_hm.Assoc(a[i], a[i+1])
 		}
 		return new_hm, nil
 	case Vector:
 		if len(a) < 3 {
 			return nil, errors.New("assoc requires at least 3 arguments")
 		}
-		new_v := copy_vector(ms)
+		new_v := ms
 		for i := 1; i < len(a); i += 2 {
 			key := a[i]
 			keyInt, ok := key.(int)
 			if !ok {
 				return nil, errors.New("assoc called with non-int key")
 			}
-			new_v.Val[keyInt] = a[i+1]
+			new_v = new_v.Assoc(keyInt, a[i+1])
 		}
 		return new_v, nil
 	case Set:
 		if len(a) < 2 {
 			return nil, errors.New("assoc requires at least 2 arguments")
 		}
-		new_s := copy_set(ms)
+		new_s := ms
 		for _, value := range a[1:] {
-			if !Q[string](value) {
-				return nil, errors.New("assoc called with non-string key")
-			}
-			new_s.Val[value.(string)] = struct{}{}
+			new_s = new_s.Conj(value)
 		}
 		return new_s, nil
 	default:
@@ -521,22 +528,15 @@ func dissoc(a ...MalType) (MalType, error) {
 	ms := a[0]
 	switch ms := ms.(type) {
 	case HashMap:
-		new_hm := copy_hash_map(ms)
-		for i := 1; i < len(a); i += 1 {
-			key := a[i]
-			if !Q[string](key) {
-				return nil, errors.New("dissoc called with non-string key")
-			}
-			delete(new_hm.Val, key.(string))
+		new_hm := ms
+		for _, key := range a[1:] {
+			new_hm = new_hm.Dissoc(key)
 		}
 		return new_hm, nil
 	case Set:
-		new_s := copy_set(ms)
+		new_s := ms
 		for _, value := range a[1:] {
-			if !Q[string](value) {
-				return nil, errors.New("dissoc called with non-string key")
-			}
-			delete(new_s.Val, value.(string))
+			new_s = new_s.Disj(value)
 		}
 		return new_s, nil
 	default:
@@ -548,23 +548,26 @@ func get(hm, key MalType) (MalType, error) {
 	if Nil_Q(hm) {
 		return nil, nil
 	}
-	switch key.(type) {
-	case string:
-	case int:
-	default:
-		return nil, errors.New("get called with non-string key nor a non-int key")
-	}
 	ms := hm
 	switch ms := ms.(type) {
 	case HashMap:
-		return ms.Val[key.(string)], nil
+		value, _ := ms.Get(key)
+		return value, nil
 	case Vector:
-		return ms.Val[key.(int)], nil
+		i, ok := key.(int)
+		if !ok {
+			return nil, errors.New("get called on a vector with a non-int key")
+		}
+		return ms.Nth(i), nil
 	case List:
-		return ms.Val[key.(int)], nil
+		i, ok := key.(int)
+		if !ok {
+			return nil, errors.New("get called on a list with a non-int key")
+		}
+		return ms.Val[i], nil
 	case Set:
-		if _, ok := ms.Val[key.(string)]; ok {
-			return key.(string), nil
+		if ms.Contains(key) {
+			return key, nil
 		}
 		return nil, nil
 	default:
@@ -584,19 +587,19 @@ func get_in(hm, _pathVector MalType) (MalType, error) {
 }
 
 func _getIn(argMapOrVector MalType, posVector Vector) (MalType, error) {
-	switch len(posVector.Val) {
+	switch posVector.Len() {
 	case 0:
 		return argMapOrVector, nil
 	case 1:
-		index := posVector.Val[0]
+		index := posVector.Nth(0)
 		return get(argMapOrVector, index)
 	default:
-		index := posVector.Val[0]
-		rest := Vector{Val: posVector.Val[1:]}
+		index := posVector.Nth(0)
+		rest := NewVector(posVector.Slice()[1:]...)
 		var branch MalType
 		switch argMapOrVector := argMapOrVector.(type) {
 		case HashMap:
-			branch = argMapOrVector.Val[index.(string)]
+			branch, _ = argMapOrVector.Get(index)
 			if branch == nil {
 				branch = HashMap{}
 			}
@@ -606,7 +609,7 @@ func _getIn(argMapOrVector MalType, posVector Vector) (MalType, error) {
 				branch = List{}
 			}
 		case Vector:
-			branch = argMapOrVector.Val[index.(int)]
+			branch = argMapOrVector.Nth(index.(int))
 			if branch == nil {
 				branch = Vector{}
 			}
@@ -625,13 +628,14 @@ func update(ctx context.Context, hm, pos, f MalType) (MalType, error) {
 func _update(ctx context.Context, argMapOrVector, index, f MalType) (MalType, error) {
 	switch argMapOrVector := argMapOrVector.(type) {
 	case HashMap:
-		res, err := Apply(ctx, f, []MalType{argMapOrVector.Val[index.(string)]})
+		value, _ := argMapOrVector.Get(index)
+		res, err := Apply(ctx, f, []MalType{value})
 		if err != nil {
 			return nil, err
 		}
 		return assoc(argMapOrVector, index, res)
 	case Vector:
-		res, err := Apply(ctx, f, []MalType{argMapOrVector.Val[index.(int)]})
+		res, err := Apply(ctx, f, []MalType{argMapOrVector.Nth(index.(int))})
 		if err != nil {
 			return nil, err
 		}
@@ -649,19 +653,19 @@ func update_in(ctx context.Context, seq MalType, posVector Vector, f MalType) (M
 }
 
 func _updateIn(ctx context.Context, seq MalType, posVector Vector, f MalType) (MalType, error) {
-	switch len(posVector.Val) {
+	switch posVector.Len() {
 	case 0:
 		return seq, nil
 	case 1:
-		index := posVector.Val[0]
+		index := posVector.Nth(0)
 		return _update(ctx, seq, index, f)
 	default:
-		index := posVector.Val[0]
-		rest := Vector{Val: posVector.Val[1:]}
+		index := posVector.Nth(0)
+		rest := NewVector(posVector.Slice()[1:]...)
 		var branch MalType
 		switch seq := seq.(type) {
 		case HashMap:
-			branch = seq.Val[index.(string)]
+			branch, _ = seq.Get(index)
 			if branch == nil {
 				branch = HashMap{}
 			}
@@ -671,7 +675,7 @@ func _updateIn(ctx context.Context, seq MalType, posVector Vector, f MalType) (M
 			}
 			return assoc(seq, index, inner)
 		case Vector:
-			branch = seq.Val[index.(int)]
+			branch = seq.Nth(index.(int))
 			if branch == nil {
 				branch = Vector{}
 			}
@@ -691,24 +695,24 @@ func assoc_in(hm MalType, posVector Vector, data MalType) (MalType, error) {
 }
 
 func _assocIn(argMapOrVector MalType, posVector Vector, newValue MalType) (MalType, error) {
-	switch len(posVector.Val) {
+	switch posVector.Len() {
 	case 0:
 		return argMapOrVector, nil
 	case 1:
-		index := posVector.Val[0]
+		index := posVector.Nth(0)
 		return assoc(argMapOrVector, index, newValue)
 	default:
-		index := posVector.Val[0]
-		rest := Vector{Val: posVector.Val[1:]}
+		index := posVector.Nth(0)
+		rest := NewVector(posVector.Slice()[1:]...)
 		var branch MalType
 		switch argMapOrVector := argMapOrVector.(type) {
 		case HashMap:
-			branch = argMapOrVector.Val[index.(string)]
+			branch, _ = argMapOrVector.Get(index)
 			if branch == nil {
 				branch = HashMap{}
 			}
 		case Vector:
-			branch = argMapOrVector.Val[index.(int)]
+			branch = argMapOrVector.Nth(index.(int))
 			if branch == nil {
 				branch = Vector{}
 			}
@@ -721,41 +725,38 @@ func _assocIn(argMapOrVector MalType, posVector Vector, newValue MalType) (MalTy
 	}
 }
 
-func contains_Q(hm MalType, key string) (bool, error) {
+func contains_Q(hm, key MalType) (bool, error) {
 	if Nil_Q(hm) {
 		return false, nil
 	}
 	switch hm := hm.(type) {
 	case HashMap:
-		_, ok := hm.Val[key]
+		_, ok := hm.Get(key)
 		return ok, nil
 	case Set:
-		_, ok := hm.Val[key]
-		return ok, nil
+		return hm.Contains(key), nil
 	default:
 		return false, errors.New("get called on non-hash map and a non-set")
 	}
 }
 
-func keys(hm MalType) (List, error) {
+func keys(ctx context.Context, hm MalType) (List, error) {
 	switch hm := hm.(type) {
 	case HashMap:
-		slc := []MalType{}
-		for k := range hm.Val {
-			slc = append(slc, k)
-		}
-		return List{Val: slc}, nil
+		return List{Val: hm.OrderedKeys(KeyOrderFromContext(ctx))}, nil
 	default:
 		return List{}, errors.New("keys called on non-hash map")
 	}
 }
 
-func vals(hm MalType) (List, error) {
+func vals(ctx context.Context, hm MalType) (List, error) {
 	if !Q[HashMap](hm) {
 		return List{}, errors.New("vals called on non-hash map")
 	}
 	slc := []MalType{}
-	for _, v := range hm.(HashMap).Val {
+	// in the same order as keys
+	for _, k := range hm.(HashMap).OrderedKeys(KeyOrderFromContext(ctx)) {
+		v, _ := hm.(HashMap).Get(k)
 		slc = append(slc, v)
 	}
 	return List{Val: slc}, nil
@@ -789,18 +790,28 @@ func concat(a ...MalType) (MalType, error) {
 	return List{Val: slc1}, nil
 }
 
-func vec(seq MalType) (MalType, error) {
+func vec(ctx context.Context, seq MalType) (MalType, error) {
+	if s, ok := seq.(Set); ok {
+		v := NewVector(s.OrderedItems(KeyOrderFromContext(ctx))...)
+		v.Meta = s.Meta
+		return v, nil
+	}
 	array, meta, err := ConvertFrom(seq)
 	if err != nil {
 		return nil, err
 	}
-	return Vector{
-		Val:  array,
-		Meta: meta,
-	}, nil
+	v := NewVector(array...)
+	v.Meta = meta
+	return v, nil
 }
 
 func nth(seq MalType, idx int) (MalType, error) {
+	if v, ok := seq.(Vector); ok {
+		if idx < 0 || idx >= v.Len() {
+			return nil, errors.New("nth: index out of range")
+		}
+		return v.Nth(idx), nil
+	}
 	slc, e := GetSlice(seq)
 	if e != nil {
 		return nil, e
@@ -816,6 +827,12 @@ func first(seq MalType) (MalType, error) {
 	if seq == nil {
 		return nil, nil
 	}
+	if v, ok := seq.(Vector); ok {
+		if v.Len() == 0 {
+			return nil, nil
+		}
+		return v.Nth(0), nil
+	}
 	slc, e := GetSlice(seq)
 	if e != nil {
 		return nil, e
@@ -845,11 +862,11 @@ func empty_Q(seq MalType) (bool, error) {
 	case List:
 		return len(seq.Val) == 0, nil
 	case Vector:
-		return len(seq.Val) == 0, nil
+		return seq.Len() == 0, nil
 	case HashMap:
-		return len(seq.Val) == 0, nil
+		return seq.Len() == 0, nil
 	case Set:
-		return len(seq.Val) == 0, nil
+		return seq.Len() == 0, nil
 	case nil:
 		return true, nil
 	default:
@@ -862,11 +879,11 @@ func count(seq MalType) (int, error) {
 	case List:
 		return len(seq.Val), nil
 	case Vector:
-		return len(seq.Val), nil
+		return seq.Len(), nil
 	case HashMap:
-		return len(seq.Val), nil
+		return seq.Len(), nil
 	case Set:
-		return len(seq.Val), nil
+		return seq.Len(), nil
 	case nil:
 		return 0, nil
 	default:
@@ -917,28 +934,20 @@ func conj(a ...MalType) (MalType, error) {
 		}
 		return List{Val: append(new_slc, seq.Val...)}, nil
 	case Vector:
-		new_slc := append(seq.Val, a[1:]...)
-		return Vector{Val: new_slc}, nil
+		return seq.Conj(a[1:]...), nil
 	case HashMap:
 		if len(a)%2 != 1 {
 			return nil, errors.New("conj called with on a hash map requires an odd number of arguments")
 		}
-		new_hm := copy_hash_map(seq)
+		new_hm := seq
 		for i := 1; i < len(a); i += 2 {
-			key := a[i]
-			if !Q[string](key) {
-				return nil, errors.New("conj called with non-string key")
-			}
-			new_hm.Val[key.(string)] = a[i+1]
+			new_hm = new_hm.Assoc(a[i], a[i+1])
 		}
 		return new_hm, nil
 	case Set:
-		new_s := copy_set(seq)
+		new_s := seq
 		for _, key := range a[1:] {
-			if !Q[string](key) {
-				return nil, errors.New("conj called with non-string key")
-			}
-			new_s.Val[key.(string)] = struct{}{}
+			new_s = new_s.Conj(key)
 		}
 		return new_s, nil
 	default:
@@ -946,7 +955,7 @@ func conj(a ...MalType) (MalType, error) {
 	}
 }
 
-func seq(seq MalType) (MalType, error) {
+func seq(ctx context.Context, seq MalType) (MalType, error) {
 	switch arg := seq.(type) {
 	case List:
 		if len(arg.Val) == 0 {
@@ -954,16 +963,12 @@ func seq(seq MalType) (MalType, error) {
 		}
 		return arg, nil
 	case Vector:
-		if len(arg.Val) == 0 {
+		if arg.Len() == 0 {
 			return nil, nil
 		}
-		return List{Val: arg.Val}, nil
+		return List{Val: arg.Slice()}, nil
 	case Set:
-		slc := []MalType{}
-		for k := range arg.Val {
-			slc = append(slc, k)
-		}
-		return List{Val: slc}, nil
+		return List{Val: arg.OrderedItems(KeyOrderFromContext(ctx))}, nil
 	case string:
 		if len(arg) == 0 {
 			return nil, nil
@@ -983,11 +988,14 @@ func with_meta(obj, meta MalType) (MalType, error) {
 	case List:
 		return List{Val: tobj.Val, Meta: meta}, nil
 	case Vector:
-		return Vector{Val: tobj.Val, Meta: meta}, nil
+		tobj.Meta = meta
+		return tobj, nil
 	case HashMap:
-		return HashMap{Val: tobj.Val, Meta: meta}, nil
+		tobj.Meta = meta
+		return tobj, nil
 	case Set:
-		return Set{Val: tobj.Val, Meta: meta}, nil
+		tobj.Meta = meta
+		return tobj, nil
 	case Func:
 		return Func{Fn: tobj.Fn, Meta: meta}, nil
 	case MalFunc:
@@ -1035,24 +1043,20 @@ func split(str, sep string) (Vector, error) {
 		slc[i] = v
 	}
 
-	return Vector{Val: slc}, nil
+	return NewVector(slc...), nil
 }
 
 func rename_keys(data, alternative HashMap) (HashMap, error) {
-	output := map[string]MalType{}
-	for k, v := range data.Val {
-		newKey, ok := alternative.Val[k]
-		if ok {
-			output[newKey.(string)] = v
+	output := HashMap{Meta: data.Meta, Cursor: data.Cursor}
+	for _, k := range data.OrderedKeys(Insertion) {
+		v, _ := data.Get(k)
+		if newKey, ok := alternative.Get(k); ok {
+			output = output.Assoc(newKey, v)
 		} else {
-			output[k] = v
+			output = output.Assoc(k, v)
 		}
 	}
-	return HashMap{
-		Val:    output,
-		Meta:   data.Meta,
-		Cursor: data.Cursor,
-	}, nil
+	return output, nil
 }
 
 func assert(a ...MalType) (MalType, error) {
@@ -1116,23 +1120,17 @@ func mErge(_hm0, _hm1 MalType) (MalType, error) {
 			return nil, errors.New("expected hash map")
 		}
 	}
-	if hm0.Val == nil && hm1.Val == nil {
-		return nil, nil
-	}
-	merged := HashMap{
-		Val: make(map[string]MalType),
-	}
-	for k, v := range hm0.Val {
-		merged.Val[k] = v
-	}
-	for k, v := range hm1.Val {
-		merged.Val[k] = v
+	merged := hm0
+	merged.Meta, merged.Cursor = nil, nil
+	for _, k := range hm1.OrderedKeys(Insertion) {
+		v, _ := hm1.Get(k)
+		merged = merged.Assoc(k, v)
 	}
 	return merged, nil
 }
 
-func json_encode(obj MalType) (MalType, error) {
-	b, err := json.Marshal(obj)
+func json_encode(ctx context.Context, obj MalType) (MalType, error) {
+	b, err := MarshalJSONOrdered(obj, KeyOrderFromContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -1171,14 +1169,18 @@ func JSON_Decode(obj, bytesIn MalType) (MalType, error) {
 		return value.FromJSON(b)
 	case List:
 		v := []interface{}{}
-		err := json.Unmarshal(b, &v)
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err := d.Decode(&v)
 		if err != nil {
 			return nil, err
 		}
 		return array2list(v), nil
 	case Vector:
 		v := []interface{}{}
-		err := json.Unmarshal(b, &v)
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err := d.Decode(&v)
 		if err != nil {
 			return nil, err
 		}
@@ -1194,7 +1196,9 @@ func JSON_Decode(obj, bytesIn MalType) (MalType, error) {
 		return map2hashmap(v), nil
 	case Set:
 		v := []interface{}{}
-		err := json.Unmarshal(b, &v)
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err := d.Decode(&v)
 		if err != nil {
 			return nil, err
 		}
@@ -1205,39 +1209,37 @@ func JSON_Decode(obj, bytesIn MalType) (MalType, error) {
 }
 
 func map2hashmap(m map[string]interface{}) HashMap {
-	hm := HashMap{
-		Val:  map[string]MalType{},
-		Meta: nil,
-	}
+	hm := map[string]MalType{}
 	for k, v := range m {
 		switch v := v.(type) {
 		case map[string]interface{}:
-			hm.Val[k] = map2hashmap(v)
+			hm[k] = map2hashmap(v)
 		case []interface{}:
-			hm.Val[k] = array2vector(v)
+			hm[k] = array2vector(v)
+		case json.Number:
+			hm[k] = jsonNumber(v)
 		default:
-			hm.Val[k] = v
+			hm[k] = v
 		}
 	}
-	return hm
+	return NewHashMapFromMap(hm)
 }
 
 func array2vector(a []interface{}) Vector {
-	l := Vector{
-		Val:  []MalType{},
-		Meta: nil,
-	}
+	l := []MalType{}
 	for _, v := range a {
 		switch v := v.(type) {
 		case map[string]interface{}:
-			l.Val = append(l.Val, map2hashmap(v))
+			l = append(l, map2hashmap(v))
 		case []interface{}:
-			l.Val = append(l.Val, array2vector(v))
+			l = append(l, array2vector(v))
+		case json.Number:
+			l = append(l, jsonNumber(v))
 		default:
-			l.Val = append(l.Val, v)
+			l = append(l, v)
 		}
 	}
-	return l
+	return NewVector(l...)
 }
 
 func array2list(a []interface{}) List {
@@ -1251,6 +1253,8 @@ func array2list(a []interface{}) List {
 			l.Val = append(l.Val, map2hashmap(v))
 		case []interface{}:
 			l.Val = append(l.Val, array2vector(v))
+		case json.Number:
+			l.Val = append(l.Val, jsonNumber(v))
 		default:
 			l.Val = append(l.Val, v)
 		}
@@ -1258,11 +1262,13 @@ func array2list(a []interface{}) List {
 	return l
 }
 
-func readLine(prompt string) (string, error) {
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Print(prompt)
-	scanner.Scan()
-	return scanner.Text(), nil
+// jsonNumber converts JSON numbers to int when integral, to float64 otherwise
+func jsonNumber(n json.Number) MalType {
+	if i, err := strconv.ParseInt(string(n), 10, 0); err == nil {
+		return int(i)
+	}
+	f, _ := n.Float64()
+	return f
 }
 
 func sleep(ctx context.Context, ms int) error {
@@ -1299,5 +1305,5 @@ func rAnge(from, to int) (Vector, error) {
 	for i := from; i < to; i++ {
 		value = append(value, i)
 	}
-	return Vector{Val: value}, nil
+	return NewVector(value...), nil
 }
@@ -13,4 +13,38 @@
                                     (if (> (count xs) 1)
                                         (nth xs 1)
                                         (throw "odd number of forms to cond"))
-                                    (cons 'cond (rest (rest xs))))))))
\ No newline at end of file
+                                    (cons 'cond (rest (rest xs)))))))
+
+    (defmacro defn (fn [name & decl]
+                        (let [doc   (if (string? (first decl)) (first decl))
+                              decl  (if doc (rest decl) decl)
+                              attrs (if (map? (first decl)) (first decl) {})
+                              decl  (if (map? (first decl)) (rest decl) decl)
+                              meta  (if doc (assoc attrs :doc doc) attrs)
+                              var   (if (get meta :private) (list 'with-meta name :private) name)]
+                            (if (empty? meta)
+                                `(def ~var (fn ~name ~@decl))
+                                `(def ~var (with-meta (fn ~name ~@decl) ~meta))))))
+
+    (defmacro defn- (fn [name & decl]
+                        (let [doc   (if (string? (first decl)) (list (first decl)) ())
+                              decl  (if (string? (first decl)) (rest decl) decl)
+                              attrs (if (map? (first decl)) (first decl) {})
+                              decl  (if (map? (first decl)) (rest decl) decl)]
+                            `(defn ~name ~@doc ~(assoc attrs :private true) ~@decl))))
+
+    (defmacro with-out-str (fn [& body]
+                        `(with-out-str* (fn [] ~@body))))
+
+    (defmacro require (fn [& specs]
+                        `(require* ~@(map (fn [spec] (list 'quote spec)) specs))))
+
+    (defmacro ns (fn [name & clauses]
+                        `(do
+                            (in-ns '~name)
+                            ~@(map (fn [clause]
+                                        (if (= :require (first clause))
+                                            `(require ~@(rest clause))
+                                            (throw (str "unsupported ns clause " (first clause)))))
+                                    clauses)
+                            nil))))
\ No newline at end of file
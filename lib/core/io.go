@@ -0,0 +1,209 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	spew "github.com/davecgh/go-spew/spew"
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/call"
+	"github.com/jig/lisp/printer"
+	. "github.com/jig/lisp/types"
+)
+
+// Writer is an output stream, the value of the *out* and *err* dynamic vars
+type Writer struct {
+	io.Writer
+}
+
+func (w Writer) Type() string { return "writer" }
+
+func (w Writer) LispPrint(func(MalType, bool) string) string { return "«writer»" }
+
+// Reader is an input stream, the value of the *in* dynamic var
+type Reader struct {
+	*bufio.Reader
+}
+
+func (r Reader) Type() string { return "reader" }
+
+func (r Reader) LispPrint(func(MalType, bool) string) string { return "«reader»" }
+
+// stdStream is a standard stream resolved on each use, as Go programs (and tests) might reassign os.Stdout
+type stdStream func() *os.File
+
+func (s stdStream) Write(p []byte) (int, error) { return s().Write(p) }
+
+func (s stdStream) Read(p []byte) (int, error) { return s().Read(p) }
+
+// loadIO defines the dynamic vars *out*, *err* and *in* on the standard streams, and the
+// printing functions that write to them. (binding [*out* ...] ...) redirects them.
+func loadIO(e EnvType) {
+	for name, stream := range map[string]MalType{
+		"*out*": Writer{stdStream(func() *os.File { return os.Stdout })},
+		"*err*": Writer{stdStream(func() *os.File { return os.Stderr })},
+		"*in*":  Reader{bufio.NewReader(stdStream(func() *os.File { return os.Stdin }))},
+	} {
+		e.Set(Symbol{Val: name}, stream)
+		env.SetDynamic(e, name)
+	}
+
+	call.CallOverrideFN(e, "prn", func(ctx context.Context, a ...MalType) (MalType, error) {
+		return nil, printLine(ctx, e, printer.PrintList(a, true, KeyOrderFromContext(ctx), " "))
+	})
+	call.CallOverrideFN(e, "println", func(ctx context.Context, a ...MalType) (MalType, error) {
+		return nil, printLine(ctx, e, printer.PrintList(a, false, KeyOrderFromContext(ctx), " "))
+	})
+	// with-out-str (on header-basic.lisp) calls it with its body as a function
+	call.CallOverrideFN(e, "with-out-str*", func(ctx context.Context, f MalType) (string, error) {
+		var out strings.Builder
+		ctx, err := WithIO(ctx, e, IO{Out: &out})
+		if err != nil {
+			return "", err
+		}
+		if _, err := Apply(ctx, f, []MalType{}); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	})
+	call.CallOverrideFN(e, "spew", func(ctx context.Context, a MalType) (MalType, error) {
+		out, err := stream[Writer](ctx, e, "*out*")
+		if err != nil {
+			return nil, err
+		}
+		spew.Fdump(out, a)
+		return nil, nil
+	})
+}
+
+// loadInput defines read-line, that reads from *in*, and slurp, that reads from the file
+// system of the context (see [WithIO])
+func loadInput(e EnvType) {
+	call.CallOverrideFN(e, "slurp", func(ctx context.Context, fileName string) (string, error) {
+		f, err := Open(ctx, fileName)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	})
+	call.CallOverrideFN(e, "read-line", func(ctx context.Context, prompt string) (string, error) {
+		out, err := stream[Writer](ctx, e, "*out*")
+		if err != nil {
+			return "", err
+		}
+		in, err := stream[Reader](ctx, e, "*in*")
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.WriteString(out, prompt); err != nil {
+			return "", err
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+	})
+}
+
+// Open opens fileName on the file system of ctx (see [WithIO]), or on the host file system if
+// it has none
+func Open(ctx context.Context, fileName string) (io.ReadCloser, error) {
+	if fsys, ok := ctx.Value(fsKey{}).(fs.FS); ok {
+		return fsys.Open(fileName)
+	}
+	return os.Open(fileName)
+}
+
+// IO is the I/O configuration of an evaluation. Nil members keep the configuration of the context.
+type IO struct {
+	// Out and Err are the writers of *out* and *err* (prn, println and spew write to *out*)
+	Out, Err io.Writer
+	// In is the reader of *in* (read by read-line)
+	In io.Reader
+	// FS is the file system slurp reads from, instead of the host file system. Its file
+	// names are unrooted, slash separated paths (see [fs.ValidPath])
+	FS fs.FS
+}
+
+type fsKey struct{}
+
+// WithIO returns a context where the printing and reading functions of env (loaded by
+// [Load] and [LoadInput]) use cfg, e.g. to capture the output of each request of an
+// embedded interpreter:
+//
+//	var out bytes.Buffer
+//	ctx, err := core.WithIO(ctx, env, core.IO{Out: &out})
+//	...
+//	res, err := lisp.REPL(ctx, env, `(println "hello")`, nil)
+func WithIO(ctx context.Context, e EnvType, cfg IO) (context.Context, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	bindings := map[env.Var]MalType{}
+	for name, stream := range map[string]MalType{
+		"*out*": writerOf(cfg.Out),
+		"*err*": writerOf(cfg.Err),
+		"*in*":  readerOf(cfg.In),
+	} {
+		if stream == nil {
+			continue
+		}
+		v, err := env.LookupVar(e, Symbol{Val: name})
+		if err != nil {
+			return nil, err
+		}
+		bindings[v] = stream
+	}
+	if cfg.FS != nil {
+		ctx = context.WithValue(ctx, fsKey{}, cfg.FS)
+	}
+	return env.WithBindings(ctx, bindings), nil
+}
+
+func writerOf(w io.Writer) MalType {
+	if w == nil {
+		return nil
+	}
+	return Writer{w}
+}
+
+func readerOf(r io.Reader) MalType {
+	if r == nil {
+		return nil
+	}
+	return Reader{bufio.NewReader(r)}
+}
+
+// stream returns the value of the stream dynamic var name as seen by ctx
+func stream[T Writer | Reader](ctx context.Context, e EnvType, name string) (T, error) {
+	var zero T
+	value, err := env.Lookup(ctx, e, Symbol{Val: name})
+	if err != nil {
+		return zero, err
+	}
+	s, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("%s must be a %s (was of type %s)", name, TypeName(zero), TypeName(value))
+	}
+	return s, nil
+}
+
+func printLine(ctx context.Context, e EnvType, line string) error {
+	out, err := stream[Writer](ctx, e, "*out*")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, line+"\n")
+	return err
+}
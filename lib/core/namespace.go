@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/call"
+	. "github.com/jig/lisp/types"
+)
+
+// loadNamespaces loads the namespace functions. The ns and require macros
+// are defined on header-basic.lisp on top of them.
+func loadNamespaces(e EnvType) {
+	call.CallOverrideFN(e, "in-ns", func(ctx context.Context, name MalType) (MalType, error) {
+		ns, err := namespaceName(name)
+		if err != nil {
+			return nil, err
+		}
+		return nil, env.InNamespace(ctx, e, ns)
+	})
+	call.CallOverrideFN(e, "ns-name", func(ctx context.Context) (string, error) {
+		return env.CurrentNamespace(ctx, e), nil
+	})
+	call.CallOverrideFN(e, "ns-publics", func(name MalType) (MalType, error) {
+		ns, err := namespaceName(name)
+		if err != nil {
+			return nil, err
+		}
+		return env.Publics(e, ns)
+	})
+	call.CallOverrideFN(e, "require*", func(ctx context.Context, specs ...MalType) (MalType, error) {
+		for _, spec := range specs {
+			name, alias, err := requireSpec(spec)
+			if err != nil {
+				return nil, err
+			}
+			if err := env.Require(ctx, e, name, alias); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+}
+
+// namespaceName returns the namespace name given as a symbol or a string
+func namespaceName(name MalType) (string, error) {
+	switch name := name.(type) {
+	case Symbol:
+		return name.Val, nil
+	case string:
+		return name, nil
+	default:
+		return "", fmt.Errorf("namespace name must be a symbol (was of type %s)", TypeName(name))
+	}
+}
+
+// requireSpec parses a require spec, either lib.x or [lib.x :as x]
+func requireSpec(spec MalType) (name, alias string, err error) {
+	switch spec := spec.(type) {
+	case Symbol:
+		return spec.Val, "", nil
+	case Vector:
+		if spec.Len() != 3 || spec.Nth(1) != "ʞas" {
+			return "", "", errors.New("require spec must be [lib :as alias]")
+		}
+		lib, ok := spec.Nth(0).(Symbol)
+		as, ok2 := spec.Nth(2).(Symbol)
+		if !ok || !ok2 {
+			return "", "", errors.New("require spec must be [lib :as alias]")
+		}
+		return lib.Val, as.Val, nil
+	default:
+		return "", "", fmt.Errorf("invalid require spec (was of type %s)", TypeName(spec))
+	}
+}
@@ -2,11 +2,14 @@ package nscore
 
 import (
 	"context"
+	"io"
 	"os"
 	"reflect"
 
 	"github.com/jig/lisp"
+	"github.com/jig/lisp/lib/call"
 	"github.com/jig/lisp/lib/core"
+	"github.com/jig/lisp/lisperror"
 	. "github.com/jig/lisp/types"
 )
 
@@ -32,12 +35,40 @@ func LoadInput(env EnvType) error {
 		return lisp.EVAL(ctx, a[0], env)
 	}})
 
-	if _, err := lisp.REPL(context.Background(), env, core.HeaderLoadFile(), NewCursorFile(_package_)); err != nil {
-		return err
-	}
+	call.CallOverrideFN(env, "load-file", func(ctx context.Context, fileName string) (MalType, error) {
+		return nil, LoadFile(ctx, env, fileName)
+	})
 	return nil
 }
 
+// LoadFile evaluates the forms of the file fileName in env one by one, reading it from the
+// file system of ctx (see [core.WithIO]). It implements load-file.
+func LoadFile(ctx context.Context, env EnvType, fileName string) error {
+	_, err := EvalFile(ctx, env, fileName)
+	return err
+}
+
+// EvalFile is [LoadFile] returning the value of the last form of the file
+func EvalFile(ctx context.Context, env EnvType, fileName string) (MalType, error) {
+	f, err := core.Open(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	result, err := lisp.ReadEvalAll(ctx, env, f, NewCursorFile(fileName))
+	if err != nil {
+		// the file is streamed, so its source is only kept to render the excerpt of the error
+		if f, openErr := core.Open(ctx, fileName); openErr == nil {
+			defer f.Close()
+			if source, readErr := io.ReadAll(f); readErr == nil {
+				lisperror.RegisterSource(fileName, string(source))
+			}
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
 func LoadCmdLineArgs(env EnvType) error {
 	if len(os.Args) > 2 {
 		args := make([]MalType, 0, len(os.Args)-2)
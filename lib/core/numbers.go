@@ -0,0 +1,323 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/jig/lisp/printer"
+	. "github.com/jig/lisp/types"
+)
+
+// Numeric tower: arguments of different numeric types are promoted to the
+// highest ranked type before operating (int → BigInt → Decimal → float64).
+const (
+	rankInt = iota
+	rankBigInt
+	rankDecimal
+	rankFloat
+)
+
+var errIntegerOverflow = errors.New("integer overflow")
+
+func numericRank(x MalType) (int, error) {
+	switch x.(type) {
+	case int:
+		return rankInt, nil
+	case BigInt:
+		return rankBigInt, nil
+	case Decimal:
+		return rankDecimal, nil
+	case float64, float32:
+		return rankFloat, nil
+	default:
+		return 0, fmt.Errorf("%s is not a number (%T)", printer.Pr_str(x, true), x)
+	}
+}
+
+func commonRank(a, b MalType) (int, error) {
+	ra, err := numericRank(a)
+	if err != nil {
+		return 0, err
+	}
+	rb, err := numericRank(b)
+	if err != nil {
+		return 0, err
+	}
+	if ra > rb {
+		return ra, nil
+	}
+	return rb, nil
+}
+
+func toBigInt(x MalType) *big.Int {
+	switch x := x.(type) {
+	case int:
+		return big.NewInt(int64(x))
+	default:
+		return x.(BigInt).Val
+	}
+}
+
+func toRat(x MalType) *big.Rat {
+	switch x := x.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(x))
+	case BigInt:
+		return new(big.Rat).SetInt(x.Val)
+	default:
+		return x.(Decimal).Val
+	}
+}
+
+func toFloat(x MalType) float64 {
+	switch x := x.(type) {
+	case int:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case BigInt:
+		f, _ := new(big.Float).SetInt(x.Val).Float64()
+		return f
+	case Decimal:
+		f, _ := x.Val.Float64()
+		return f
+	default:
+		return x.(float64)
+	}
+}
+
+type arithmeticOp struct {
+	ints     func(a, b int) (MalType, error)
+	bigInts  func(a, b *big.Int) (MalType, error)
+	decimals func(a, b *big.Rat) (MalType, error)
+	floats   func(a, b float64) (MalType, error)
+}
+
+func (op arithmeticOp) apply(a, b MalType) (MalType, error) {
+	rank, err := commonRank(a, b)
+	if err != nil {
+		return nil, err
+	}
+	switch rank {
+	case rankInt:
+		return op.ints(a.(int), b.(int))
+	case rankBigInt:
+		return op.bigInts(toBigInt(a), toBigInt(b))
+	case rankDecimal:
+		return op.decimals(toRat(a), toRat(b))
+	default:
+		return op.floats(toFloat(a), toFloat(b))
+	}
+}
+
+// fold applies op from left to right: (op (op a0 a1) a2)...
+func (op arithmeticOp) fold(acc MalType, args []MalType) (MalType, error) {
+	for _, arg := range args {
+		var err error
+		acc, err = op.apply(acc, arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+var (
+	addOp = arithmeticOp{
+		ints: func(a, b int) (MalType, error) {
+			if (b > 0 && a > math.MaxInt-b) || (b < 0 && a < math.MinInt-b) {
+				return nil, errIntegerOverflow
+			}
+			return a + b, nil
+		},
+		bigInts:  func(a, b *big.Int) (MalType, error) { return BigInt{Val: new(big.Int).Add(a, b)}, nil },
+		decimals: func(a, b *big.Rat) (MalType, error) { return NewDecimal(new(big.Rat).Add(a, b)) },
+		floats:   func(a, b float64) (MalType, error) { return a + b, nil },
+	}
+	subOp = arithmeticOp{
+		ints: func(a, b int) (MalType, error) {
+			if (b < 0 && a > math.MaxInt+b) || (b > 0 && a < math.MinInt+b) {
+				return nil, errIntegerOverflow
+			}
+			return a - b, nil
+		},
+		bigInts:  func(a, b *big.Int) (MalType, error) { return BigInt{Val: new(big.Int).Sub(a, b)}, nil },
+		decimals: func(a, b *big.Rat) (MalType, error) { return NewDecimal(new(big.Rat).Sub(a, b)) },
+		floats:   func(a, b float64) (MalType, error) { return a - b, nil },
+	}
+	mulOp = arithmeticOp{
+		ints: func(a, b int) (MalType, error) {
+			c := a * b
+			if a != 0 && (c/a != b || (a == -1 && b == math.MinInt)) {
+				return nil, errIntegerOverflow
+			}
+			return c, nil
+		},
+		bigInts:  func(a, b *big.Int) (MalType, error) { return BigInt{Val: new(big.Int).Mul(a, b)}, nil },
+		decimals: func(a, b *big.Rat) (MalType, error) { return NewDecimal(new(big.Rat).Mul(a, b)) },
+		floats:   func(a, b float64) (MalType, error) { return a * b, nil },
+	}
+	// integer division by zero panics on purpose: error is reported as a go-error
+	divOp = arithmeticOp{
+		ints: func(a, b int) (MalType, error) {
+			if a == math.MinInt && b == -1 {
+				return nil, errIntegerOverflow
+			}
+			return a / b, nil
+		},
+		bigInts:  func(a, b *big.Int) (MalType, error) { return BigInt{Val: new(big.Int).Quo(a, b)}, nil },
+		decimals: func(a, b *big.Rat) (MalType, error) { return NewDecimal(new(big.Rat).Quo(a, b)) },
+		floats:   func(a, b float64) (MalType, error) { return a / b, nil },
+	}
+)
+
+type comparisonOp struct {
+	ints   func(a, b int) bool
+	floats func(a, b float64) bool
+	// cmp is used for arbitrary precision numbers with the result of a.Cmp(b)
+	cmp func(c int) bool
+}
+
+func (op comparisonOp) apply(a, b MalType) (bool, error) {
+	rank, err := commonRank(a, b)
+	if err != nil {
+		return false, err
+	}
+	switch rank {
+	case rankInt:
+		return op.ints(a.(int), b.(int)), nil
+	case rankBigInt:
+		return op.cmp(toBigInt(a).Cmp(toBigInt(b))), nil
+	case rankDecimal:
+		return op.cmp(toRat(a).Cmp(toRat(b))), nil
+	default:
+		return op.floats(toFloat(a), toFloat(b)), nil
+	}
+}
+
+// chain returns true if every consecutive pair of args satisfies op
+func (op comparisonOp) chain(args []MalType) (bool, error) {
+	if len(args) == 1 {
+		if _, err := numericRank(args[0]); err != nil {
+			return false, err
+		}
+	}
+	for i := 1; i < len(args); i++ {
+		ok, err := op.apply(args[i-1], args[i])
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+var (
+	ltOp = comparisonOp{
+		ints:   func(a, b int) bool { return a < b },
+		floats: func(a, b float64) bool { return a < b },
+		cmp:    func(c int) bool { return c < 0 },
+	}
+	leOp = comparisonOp{
+		ints:   func(a, b int) bool { return a <= b },
+		floats: func(a, b float64) bool { return a <= b },
+		cmp:    func(c int) bool { return c <= 0 },
+	}
+	gtOp = comparisonOp{
+		ints:   func(a, b int) bool { return a > b },
+		floats: func(a, b float64) bool { return a > b },
+		cmp:    func(c int) bool { return c > 0 },
+	}
+	geOp = comparisonOp{
+		ints:   func(a, b int) bool { return a >= b },
+		floats: func(a, b float64) bool { return a >= b },
+		cmp:    func(c int) bool { return c >= 0 },
+	}
+)
+
+func add(args ...MalType) (MalType, error) {
+	return addOp.fold(0, args)
+}
+
+func multiply(args ...MalType) (MalType, error) {
+	return mulOp.fold(1, args)
+}
+
+func subtract(args ...MalType) (MalType, error) {
+	if len(args) == 1 {
+		return subOp.apply(0, args[0])
+	}
+	return subOp.fold(args[0], args[1:])
+}
+
+func divide(args ...MalType) (MalType, error) {
+	if len(args) == 1 {
+		return divOp.apply(1, args[0])
+	}
+	return divOp.fold(args[0], args[1:])
+}
+
+func number_Q(a MalType) (bool, error) {
+	_, err := numericRank(a)
+	return err == nil, nil
+}
+
+func integer_Q(a MalType) (bool, error) {
+	switch a.(type) {
+	case int, BigInt:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func bigint(a MalType) (BigInt, error) {
+	switch a := a.(type) {
+	case int:
+		return NewBigInt(a), nil
+	case BigInt:
+		return a, nil
+	case Decimal:
+		return BigInt{Val: new(big.Int).Quo(a.Val.Num(), a.Val.Denom())}, nil
+	case float64:
+		i, _ := big.NewFloat(a).Int(nil)
+		return BigInt{Val: i}, nil
+	case string:
+		i, ok := new(big.Int).SetString(a, 0)
+		if !ok {
+			return BigInt{}, fmt.Errorf("invalid bigint %q", a)
+		}
+		return BigInt{Val: i}, nil
+	default:
+		return BigInt{}, fmt.Errorf("cannot convert %T to bigint", a)
+	}
+}
+
+func bigdec(a MalType) (Decimal, error) {
+	switch a := a.(type) {
+	case int, BigInt:
+		return Decimal{Val: toRat(a)}, nil
+	case Decimal:
+		return a, nil
+	case float64:
+		// uses the shortest decimal representation of the float (0.1 is 0.1M)
+		r, _ := new(big.Rat).SetString(strconv.FormatFloat(a, 'g', -1, 64))
+		if r == nil {
+			return Decimal{}, fmt.Errorf("cannot convert %v to decimal", a)
+		}
+		return Decimal{Val: r}, nil
+	case string:
+		r, ok := new(big.Rat).SetString(a)
+		if !ok {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", a)
+		}
+		return NewDecimal(r)
+	default:
+		return Decimal{}, fmt.Errorf("cannot convert %T to decimal", a)
+	}
+}
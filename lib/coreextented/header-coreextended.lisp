@@ -47,9 +47,12 @@
       ;; init   : Accumulator
       ;; xs     : sequence of Elements x1 x2 .. xn
       ;; return : Accumulator
-      (if (empty? xs)
-        init
-        (reduce f (f init (first xs)) (rest xs)))))
+      (let [n (count xs)]
+        (loop [acc init
+               i   0]
+          (if (< i n)
+            (recur (f acc (nth xs i)) (+ i 1))
+            acc)))))
 
   ;; Left fold for maps (f (.. (f (f init x1) x2) ..) xn)
   (def reduce-kv
@@ -58,28 +61,27 @@
     ;; init   : Accumulator
     ;; xs     : sequence of key-value pairs k1-v1 k2-v2...
     ;; return : Accumulator
-    (if (empty? xs)
-      init
-      (reduce-kv f (f init (nth xs 0) (nth xs 1)) (rest (rest xs))))))
+    (let [n (count xs)]
+      (loop [acc init
+             i   0]
+        (if (< i n)
+          (recur (f acc (nth xs i) (nth xs (+ i 1))) (+ i 2))
+          acc)))))
 
   ;; Right fold (f x1 (f x2 (.. (f xn init)) ..))
-  ;; The natural implementation for 'foldr' is not tail-recursive, and
-  ;; the one based on 'reduce' constructs many intermediate functions, so we
-  ;; rely on efficient 'nth' and 'count'.
+  ;; The natural implementation for 'foldr' is not tail-recursive, so we
+  ;; loop backwards relying on efficient 'nth' and 'count'.
   (def foldr
-    (let [
-      rec (fn [f xs acc index]
+    (fn [f init xs]
+      ;; f      : Element Accumulator -> Accumulator
+      ;; init   : Accumulator
+      ;; xs     : sequence of Elements x1 x2 .. xn
+      ;; return : Accumulator
+      (loop [acc   init
+             index (- (count xs) 1)]
         (if (< index 0)
           acc
-          (rec f xs (f (nth xs index) acc) (- index 1))))
-      ]
-
-      (fn [f init xs]
-        ;; f      : Element Accumulator -> Accumulator
-        ;; init   : Accumulator
-        ;; xs     : sequence of Elements x1 x2 .. xn
-        ;; return : Accumulator
-        (rec f xs init (- (count xs) 1)))))
+          (recur (f (nth xs index) acc) (- index 1))))))
 
 ;;; Threading
   ;; Composition of partially applied functions.
@@ -324,6 +326,7 @@
       (false?   obj) :mal/boolean
       (number?  obj) :mal/number
       (string?  obj) :mal/string
+      (char?    obj) :mal/char
       (macro?   obj) :mal/macro
       true
       (let [metadata (meta obj)
@@ -430,9 +433,11 @@
       ;; pred   : Element -> interpreted as a logical value
       ;; xs     : sequence of Elements x1 x2 .. xn
       ;; return : boolean
-      (cond (empty? xs)       true
-            (pred (first xs)) (every? pred (rest xs))
-            true              false)))
+      (let [n (count xs)]
+        (loop [i 0]
+          (if (< i n)
+            (if (pred (nth xs i)) (recur (+ i 1)) false)
+            true)))))
 
   ;; Disjonction of predicate values (pred x1) or .. (pred xn)
   ;; Evaluate "(pred x)" for each "x" in turn. Return the first result
@@ -443,10 +448,11 @@
       ;; pred   : Element -> interpreted as a logical value
       ;; xs     : sequence of Elements x1 x2 .. xn
       ;; return : boolean
-      (if (empty? xs)
-        nil
-        (or (pred (first xs))
-            (some pred (rest xs))))))
+      (let [n (count xs)]
+        (loop [i 0]
+          (if (< i n)
+            (let [r (pred (nth xs i))]
+              (if r r (recur (+ i 1)))))))))
 
   ;; Search for first evaluation returning "nil" or "false".
   ;; Rewrite "x1 x2 .. xn x" as
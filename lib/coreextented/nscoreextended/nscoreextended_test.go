@@ -0,0 +1,42 @@
+package nscoreextended
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jig/lisp"
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/concurrent/nsconcurrent"
+	"github.com/jig/lisp/lib/core/nscore"
+	"github.com/jig/lisp/types"
+)
+
+func TestReducersOnLargeVectors(t *testing.T) {
+	newEnv := env.NewEnv()
+	for _, load := range []func(types.EnvType) error{nscore.Load, nsconcurrent.Load, Load} {
+		if err := load(newEnv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := lisp.REPL(context.Background(), newEnv, "(def xs (vec (range 0 10000)))", types.NewCursorFile(t.Name())); err != nil {
+		t.Fatal(err)
+	}
+	for code, expected := range map[string]string{
+		"(reduce + 0 xs)":                             "49995000",
+		"(foldr + 0 xs)":                              "49995000",
+		"(foldr cons () [1 2 3])":                     "(1 2 3)",
+		"(reduce-kv (fn [acc k v] (+ acc k v)) 0 xs)": "49995000",
+		"(every? number? xs)":                         "true",
+		"(every? (fn [x] (< x 9999)) xs)":             "false",
+		"(some (fn [x] (if (= x 9999) :found)) xs)":   ":found",
+		"(some nil? xs)":                              "nil",
+	} {
+		res, err := lisp.REPL(context.Background(), newEnv, code, types.NewCursorFile(t.Name()))
+		if err != nil {
+			t.Fatalf("%s: %s", code, err)
+		}
+		if res != expected {
+			t.Fatalf("%s: expected %s got %s", code, expected, res)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package lisperror
+
+import (
+	"fmt"
+
+	"github.com/jig/lisp/marshaler"
+	"github.com/jig/lisp/printer"
+	. "github.com/jig/lisp/types"
+)
+
+// ExInfo is an error carrying a message, a data map and an optional cause,
+// created by ex-info. Go callers get it with errors.As:
+//
+//	var exInfo *lisperror.ExInfo
+//	if errors.As(err, &exInfo) {
+//		tag, _ := exInfo.Data.Get("ʞtype")
+//	}
+type ExInfo struct {
+	Message string
+	Data    HashMap
+	Cause   error
+}
+
+// NewExInfo returns an ExInfo error. cause might be nil
+func NewExInfo(message string, data HashMap, cause error) *ExInfo {
+	return &ExInfo{
+		Message: message,
+		Data:    data,
+		Cause:   cause,
+	}
+}
+
+func (e *ExInfo) Error() string {
+	return e.Message
+}
+
+func (e *ExInfo) Unwrap() error {
+	return e.Cause
+}
+
+func (e *ExInfo) Type() string {
+	return "ex-info"
+}
+
+func (e *ExInfo) MarshalHashMap() (MalType, error) {
+	hm := NewHashMapFromMap(map[string]MalType{
+		"ʞtype":    fmt.Sprintf("%T", e),
+		"ʞmessage": e.Message,
+		"ʞdata":    e.Data,
+	})
+	switch cause := e.Cause.(type) {
+	case nil:
+	case marshaler.HashMap:
+		pHm, err := cause.MarshalHashMap()
+		if err != nil {
+			return nil, err
+		}
+		hm = hm.Assoc("ʞcause", pHm)
+	default:
+		hm = hm.Assoc("ʞcause", printer.Pr_str(cause, true))
+	}
+	return hm, nil
+}
+
+func (e *ExInfo) LispPrint(Pr_str func(MalType, bool) string) string {
+	if e.Cause != nil {
+		return "«ex-info " + Pr_str(e.Message, true) + " " + Pr_str(e.Data, true) + " " + Pr_str(e.Cause, true) + "»"
+	}
+	return "«ex-info " + Pr_str(e.Message, true) + " " + Pr_str(e.Data, true) + "»"
+}
@@ -1,7 +1,9 @@
 package lisperror
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/jig/lisp/marshaler"
 	"github.com/jig/lisp/printer"
@@ -12,6 +14,33 @@ import (
 type LispError struct {
 	err    MalType
 	cursor *Position
+	// stack is the outermost frame recorded so far (see [LispError.Stack])
+	stack *frameNode
+}
+
+// Frame is a Lisp function call on the stack of a LispError
+type Frame struct {
+	// Name is the name the function was defined with (def), empty on anonymous functions
+	Name string
+	// Position is the call site (or the function definition when called from Go, e.g. by map)
+	Position *Position
+}
+
+func (f Frame) String() string {
+	name := f.Name
+	if name == "" {
+		name = "(fn)"
+	}
+	if f.Position == nil {
+		return name
+	}
+	return name + " " + f.Position.String()
+}
+
+// frameNode is an immutable linked list to keep LispError comparable
+type frameNode struct {
+	frame Frame
+	up    *frameNode
 }
 
 func (e LispError) Unwrap() error {
@@ -62,6 +91,46 @@ func (e LispError) Position() *Position {
 	return e.cursor
 }
 
+// Stack returns the Lisp function calls the error propagated through, innermost first
+func (e LispError) Stack() []Frame {
+	var frames []Frame
+	for node := e.stack; node != nil; node = node.up {
+		frames = append(frames, node.frame)
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// WithFrame returns the error with the call to function name at pos added to its stack
+func (e LispError) WithFrame(name string, pos *Position) error {
+	e.stack = &frameNode{frame: Frame{Name: name, Position: pos}, up: e.stack}
+	return e
+}
+
+// AddFrame adds the call to function name at pos to the stack of err if it is a LispError
+// (other errors are returned as they are)
+func AddFrame(err error, name string, pos *Position) error {
+	if lerr, ok := err.(LispError); ok {
+		return lerr.WithFrame(name, pos)
+	}
+	return err
+}
+
+// StackTrace returns the stack of err formatted one frame per line, or "" if there is none
+func StackTrace(err error) string {
+	var lerr LispError
+	if !errors.As(err, &lerr) {
+		return ""
+	}
+	var sb strings.Builder
+	for _, frame := range lerr.Stack() {
+		sb.WriteString("\tat " + frame.String() + "\n")
+	}
+	return sb.String()
+}
+
 // func (e LispError) LispPrint(_Pr_str func(obj MalType, print_readably bool) string) string {
 // 	return "(error " + _Pr_str(e.err, true) + ")"
 // }
@@ -111,7 +180,10 @@ func GetPosition(ast MalType) *Position {
 func NewLispError(err MalType, ast MalType) LispError {
 	switch err := err.(type) {
 	case LispError:
-		err.cursor = GetPosition(ast)
+		// keep the innermost position
+		if err.cursor == nil {
+			err.cursor = GetPosition(ast)
+		}
 		return err
 	default:
 		return LispError{
@@ -122,11 +194,7 @@ func NewLispError(err MalType, ast MalType) LispError {
 }
 
 func (e LispError) MarshalHashMap() (MalType, error) {
-	hm := HashMap{
-		Val: map[string]MalType{
-			"ʞtype": fmt.Sprintf("%T", e),
-		},
-	}
+	hm := HashMap{}.Assoc("ʞtype", fmt.Sprintf("%T", e))
 
 	switch ee := e.ErrorValue().(type) {
 	case marshaler.HashMap:
@@ -134,13 +202,25 @@ func (e LispError) MarshalHashMap() (MalType, error) {
 		if err != nil {
 			return nil, err
 		}
-		hm.Val["ʞerr"] = pHm
+		hm = hm.Assoc("ʞerr", pHm)
 	default:
-		hm.Val["ʞerr"] = printer.Pr_str(ee, true)
+		hm = hm.Assoc("ʞerr", printer.Pr_str(ee, true))
 	}
 
 	if e.cursor != nil {
-		hm.Val["ʞpos"] = e.cursor.String()
+		hm = hm.Assoc("ʞpos", e.cursor.String())
+	}
+
+	if e.stack != nil {
+		stack := Vector{}
+		for _, frame := range e.Stack() {
+			f := HashMap{}.Assoc("ʞname", frame.Name)
+			if frame.Position != nil {
+				f = f.Assoc("ʞpos", frame.Position.String())
+			}
+			stack = stack.Conj(f)
+		}
+		hm = hm.Assoc("ʞstack", stack)
 	}
 
 	return hm, nil
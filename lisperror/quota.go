@@ -0,0 +1,19 @@
+package lisperror
+
+import "fmt"
+
+// QuotaError is the error of an evaluation that exceeds one of its limits (see lisp.WithLimits).
+// It is returned wrapped by a LispError, and try can't catch it.
+type QuotaError struct {
+	// Quota is the exceeded limit: "steps", "depth" or "size"
+	Quota string
+	Limit int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the %s quota (%d)", e.Quota, e.Limit)
+}
+
+func (e *QuotaError) Type() string {
+	return "quota-error"
+}
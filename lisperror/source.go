@@ -0,0 +1,159 @@
+package lisperror
+
+import (
+	"container/list"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/jig/lisp/types"
+)
+
+// maxExcerptLines is the maximum number of lines rendered by Excerpt (the lines in between are elided)
+const maxExcerptLines = 5
+
+// maxSourceSize is the maximum total size of the sources registered: once exceeded the least
+// recently used ones are dropped, so long running programs reading many modules don't keep
+// all of them in memory
+const maxSourceSize = 16 << 20
+
+// sources contains the source code of the modules read, by module name
+var sources = sourceCache{modules: map[string]*list.Element{}}
+
+type sourceCache struct {
+	mu sync.Mutex
+	// modules are the elements of lru, the most recently used first
+	modules map[string]*list.Element
+	lru     list.List
+	size    int
+}
+
+type source struct {
+	module string
+	lines  []string
+	size   int
+}
+
+// RegisterSource registers the source code of module to render excerpts of its errors.
+// Only the most recently used sources are kept (up to 16 MiB), so the excerpts of modules
+// read long ago might not be rendered.
+func RegisterSource(module, text string) {
+	sources.register(module, text, maxSourceSize)
+}
+
+// UnregisterSource drops the source code of module (e.g. once its errors are reported)
+func UnregisterSource(module string) {
+	sources.mu.Lock()
+	defer sources.mu.Unlock()
+	if e, ok := sources.modules[module]; ok {
+		sources.remove(e)
+	}
+}
+
+// Source returns the source code lines of module
+func Source(module string) ([]string, bool) {
+	sources.mu.Lock()
+	defer sources.mu.Unlock()
+	e, ok := sources.modules[module]
+	if !ok {
+		return nil, false
+	}
+	sources.lru.MoveToFront(e)
+	return e.Value.(*source).lines, true
+}
+
+func (c *sourceCache) register(module, text string, max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.modules[module]; ok {
+		c.remove(e)
+	}
+	c.modules[module] = c.lru.PushFront(&source{module: module, lines: strings.Split(text, "\n"), size: len(text)})
+	c.size += len(text)
+	// the source just registered is kept even if it is larger than max
+	for c.size > max && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *sourceCache) remove(e *list.Element) {
+	src := c.lru.Remove(e).(*source)
+	delete(c.modules, src.module)
+	c.size -= src.size
+}
+
+// Excerpt renders the source lines of pos with a caret underline from BeginCol to Col.
+// It returns "" if pos module source is not registered
+func Excerpt(pos *Position, colorize bool) string {
+	if pos == nil || pos.Module == nil {
+		return ""
+	}
+	lines, ok := Source(*pos.Module)
+	if !ok || pos.BeginRow < 1 || pos.BeginRow > len(lines) {
+		return ""
+	}
+	lastRow, lastCol := pos.Row, pos.Col
+	if lastRow < pos.BeginRow || (lastRow == pos.BeginRow && lastCol < pos.BeginCol) {
+		lastRow, lastCol = pos.BeginRow, pos.BeginCol
+	}
+	if lastRow > len(lines) {
+		lastRow, lastCol = len(lines), len([]rune(lines[len(lines)-1]))
+	}
+
+	width := len(strconv.Itoa(lastRow))
+	gutter := strings.Repeat(" ", width) + " | "
+	var sb strings.Builder
+	sb.WriteString(*pos.Module + ":" + strconv.Itoa(pos.BeginRow) + ":" + strconv.Itoa(pos.BeginCol) + "\n")
+	for row := pos.BeginRow; row <= lastRow; row++ {
+		if lastRow-pos.BeginRow >= maxExcerptLines && row == pos.BeginRow+maxExcerptLines-2 {
+			sb.WriteString(strings.Repeat(" ", width) + " ⋮\n")
+			row = lastRow
+		}
+		line := []rune(strings.TrimRight(lines[row-1], "\r"))
+		from, to := 1, len(line)
+		if row == pos.BeginRow {
+			from = pos.BeginCol
+		} else {
+			// underline from the first non blank character
+			for from <= len(line) && (line[from-1] == ' ' || line[from-1] == '\t') {
+				from++
+			}
+		}
+		if row == lastRow {
+			to = lastCol
+		}
+		if to > len(line) {
+			to = len(line)
+		}
+
+		sb.WriteString(strings.Repeat(" ", width-len(strconv.Itoa(row))) + strconv.Itoa(row) + " | " + string(line) + "\n")
+		if from > to {
+			continue
+		}
+		sb.WriteString(gutter)
+		// keep tabs to align the underline with the line above
+		for _, r := range line[:from-1] {
+			if r == '\t' {
+				sb.WriteRune('\t')
+			} else {
+				sb.WriteRune(' ')
+			}
+		}
+		underline := "^" + strings.Repeat("~", to-from)
+		if colorize {
+			underline = "\033[31m" + underline + "\033[0m"
+		}
+		sb.WriteString(underline + "\n")
+	}
+	return sb.String()
+}
+
+// Details returns the source excerpt where err happened followed by its stack trace
+func Details(err error, colorize bool) string {
+	var lerr LispError
+	if !errors.As(err, &lerr) {
+		return ""
+	}
+	return Excerpt(lerr.Position(), colorize) + StackTrace(err)
+}
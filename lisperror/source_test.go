@@ -0,0 +1,88 @@
+package lisperror
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jig/lisp/types"
+)
+
+func position(module string, beginRow, beginCol, row, col int) *types.Position {
+	return &types.Position{Module: &module, BeginRow: beginRow, BeginCol: beginCol, Row: row, Col: col}
+}
+
+func TestExcerpt(t *testing.T) {
+	RegisterSource("excerpt.lisp", "(def a 1)\n(+ a\n\t(undefined-fn 2))\n(def b\n  [1\n   2\n   3\n   4\n   5])")
+	for _, tc := range []struct {
+		pos      *types.Position
+		expected string
+	}{
+		{position("excerpt.lisp", 3, 3, 3, 14), "excerpt.lisp:3:3\n" +
+			"3 | \t(undefined-fn 2))\n" +
+			"  | \t ^~~~~~~~~~~~\n"},
+		{position("excerpt.lisp", 2, 1, 3, 17), "excerpt.lisp:2:1\n" +
+			"2 | (+ a\n" +
+			"  | ^~~~\n" +
+			"3 | \t(undefined-fn 2))\n" +
+			"  | \t^~~~~~~~~~~~~~~~\n"},
+		// long forms are elided
+		{position("excerpt.lisp", 4, 1, 9, 6), "excerpt.lisp:4:1\n" +
+			"4 | (def b\n" +
+			"  | ^~~~~~\n" +
+			"5 |   [1\n" +
+			"  |   ^~\n" +
+			"6 |    2\n" +
+			"  |    ^\n" +
+			"  ⋮\n" +
+			"9 |    5])\n" +
+			"  |    ^~~\n"},
+		{position("unknown.lisp", 1, 1, 1, 1), ""},
+		{types.NewAnonymousCursorHere(1, 1), ""},
+		{nil, ""},
+	} {
+		if excerpt := Excerpt(tc.pos, false); excerpt != tc.expected {
+			t.Fatalf("%s: expected\n%s\ngot\n%s", tc.pos, tc.expected, excerpt)
+		}
+	}
+	if excerpt := Excerpt(position("excerpt.lisp", 1, 6, 1, 6), true); !strings.Contains(excerpt, "\033[31m^\033[0m") {
+		t.Fatalf("expected a colorized caret got %q", excerpt)
+	}
+}
+
+func TestSourceEviction(t *testing.T) {
+	c := sourceCache{modules: map[string]*list.Element{}}
+	c.register("a", "1234", 10)
+	c.register("b", "1234", 10)
+	c.register("a", "12", 10)
+	// "b" is the least recently used
+	c.register("c", "12345", 10)
+	if _, ok := c.modules["b"]; ok || c.lru.Len() != 2 || c.size != 7 {
+		t.Fatalf("unexpected sources %v (%d bytes)", c.modules, c.size)
+	}
+	// the source just registered is kept, even if it is too large
+	c.register("d", "12345678901", 10)
+	if _, ok := c.modules["d"]; !ok || c.lru.Len() != 1 || c.size != 11 {
+		t.Fatalf("unexpected sources %v (%d bytes)", c.modules, c.size)
+	}
+
+	RegisterSource("unregistered.lisp", "(f 1)")
+	UnregisterSource("unregistered.lisp")
+	if _, ok := Source("unregistered.lisp"); ok {
+		t.Fatal("source not unregistered")
+	}
+	UnregisterSource("unregistered.lisp")
+}
+
+func TestDetails(t *testing.T) {
+	RegisterSource("details.lisp", "(f 1)")
+	err := NewLispError(errors.New("boom"), position("details.lisp", 1, 1, 1, 5)).WithFrame("f", position("details.lisp", 1, 1, 1, 5))
+	expected := "details.lisp:1:1\n1 | (f 1)\n  | ^~~~~\n\tat f details.lisp§1…1,1…5\n"
+	if details := Details(err, false); details != expected {
+		t.Fatalf("expected %q got %q", expected, details)
+	}
+	if details := Details(errors.New("not a lisp error"), false); details != "" {
+		t.Fatalf("unexpected details %q", details)
+	}
+}
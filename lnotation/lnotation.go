@@ -32,7 +32,7 @@ func V[T any](args []T) Vector {
 	for _, k := range args {
 		result = append(result, k)
 	}
-	return Vector{Val: result}
+	return NewVector(result...)
 }
 
 // M converts Go map to lisp HashMap
@@ -46,13 +46,13 @@ func HM(arg map[string]interface{}) HashMap {
 			result[k] = v
 		}
 	}
-	return HashMap{Val: result}
+	return NewHashMapFromMap(result)
 }
 
 func SET(args []string) Set {
-	result := map[string]struct{}{}
+	result := Set{}
 	for _, k := range args {
-		result[k] = struct{}{}
+		result = result.Conj(k)
 	}
-	return Set{Val: result}
+	return result
 }
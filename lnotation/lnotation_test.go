@@ -27,7 +27,7 @@ func TestLNotationMinimalExample(t *testing.T) {
 		t.Fatal("not a vector")
 	}
 	for i := 0; i < 4; i++ {
-		if vec.Val[i] != i {
+		if vec.Nth(i) != i {
 			t.Fatalf("not %d", i)
 		}
 	}
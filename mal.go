@@ -31,13 +31,15 @@ package lisp
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"io"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/jig/lisp/debuggertypes"
 	. "github.com/jig/lisp/env"
 	"github.com/jig/lisp/lisperror"
 	"github.com/jig/lisp/printer"
@@ -95,8 +97,23 @@ func READ(sourceCode string, cursor *Position, ns EnvType) (MalType, error) {
 //
 // READWithPreamble is used to read code (actually decode) on transmission. Use [AddPreamble]
 // when calling from Go code.
-func READWithPreamble(str string, cursor *Position, ns EnvType) (MalType, error) {
-	placeholderMap := &HashMap{Val: map[string]MalType{}}
+//
+// If keys are given, the code must be signed (see [Sign]) with the private key of one of them,
+// otherwise [ErrInvalidSignature] is returned without returning the code.
+func READWithPreamble(str string, cursor *Position, ns EnvType, keys ...ed25519.PublicKey) (MalType, error) {
+	signature, str := cutSignature(str)
+	ast, err := readWithPreamble(str, cursor, ns)
+	if err != nil || len(keys) == 0 {
+		return ast, err
+	}
+	if err := verify(ast, signature, keys); err != nil {
+		return nil, err
+	}
+	return ast, nil
+}
+
+func readWithPreamble(str string, cursor *Position, ns EnvType) (MalType, error) {
+	placeholderMap := &HashMap{}
 	i := 0
 	for ; ; i++ {
 		var line string
@@ -122,7 +139,7 @@ func READWithPreamble(str string, cursor *Position, ns EnvType) (MalType, error)
 			Col: 1,
 		}, nil, ns)
 		placeholderKey := lineItems[0][1][3:]
-		placeholderMap.Val[placeholderKey] = item
+		*placeholderMap = placeholderMap.Assoc(placeholderKey, item)
 	}
 }
 
@@ -133,9 +150,15 @@ func READWithPreamble(str string, cursor *Position, ns EnvType) (MalType, error)
 // values the AST assigned to each placeholder. Value ASTs might be generated with [READ] or [EVAL] or with the
 // [lnotation] package (most likely). Key names must contain the '$' prefix.
 func AddPreamble(str string, placeholderMap map[string]MalType) (string, error) {
+	placeholderKeys := make([]string, 0, len(placeholderMap))
+	for placeholderKey := range placeholderMap {
+		placeholderKeys = append(placeholderKeys, placeholderKey)
+	}
+	// sorted, so the same placeholders always produce the same source
+	sort.Strings(placeholderKeys)
 	preamble := ""
-	for placeholderKey, placeholderValue := range placeholderMap {
-		preamble = preamble + ";; " + placeholderKey + " " + PRINT(placeholderValue) + "\n"
+	for _, placeholderKey := range placeholderKeys {
+		preamble = preamble + ";; " + placeholderKey + " " + PRINT(placeholderMap[placeholderKey]) + "\n"
 	}
 	return preamble + "\n" + str, nil
 }
@@ -151,37 +174,51 @@ func starts_with(xs []MalType, sym string) bool {
 	return false
 }
 
-func qq_loop(xs []MalType) MalType {
+func qq_loop(xs []MalType) (MalType, error) {
 	acc := NewList()
 	for i := len(xs) - 1; 0 <= i; i -= 1 {
 		elt := xs[i]
 		switch e := elt.(type) {
 		case List:
 			if starts_with(e.Val, "splice-unquote") {
+				if len(e.Val) != 2 {
+					return nil, lisperror.NewLispError(errors.New("splice-unquote expects exactly one argument"), e)
+				}
 				acc = NewList(Symbol{Val: "concat"}, e.Val[1], acc)
 				continue
 			}
 		default:
 		}
-		acc = NewList(Symbol{Val: "cons"}, quasiquote(elt), acc)
+		q, err := quasiquote(elt)
+		if err != nil {
+			return nil, err
+		}
+		acc = NewList(Symbol{Val: "cons"}, q, acc)
 	}
-	return acc
+	return acc, nil
 }
 
-func quasiquote(ast MalType) MalType {
+func quasiquote(ast MalType) (MalType, error) {
 	switch a := ast.(type) {
 	case Vector:
-		return NewList(Symbol{Val: "vec"}, qq_loop(a.Val))
+		elems, err := qq_loop(a.Slice())
+		if err != nil {
+			return nil, err
+		}
+		return NewList(Symbol{Val: "vec"}, elems), nil
 	case HashMap, Symbol:
-		return NewList(Symbol{Val: "quote"}, ast)
+		return NewList(Symbol{Val: "quote"}, ast), nil
 	case List:
 		if starts_with(a.Val, "unquote") {
-			return a.Val[1]
+			if len(a.Val) != 2 {
+				return nil, lisperror.NewLispError(errors.New("unquote expects exactly one argument"), a)
+			}
+			return a.Val[1], nil
 		} else {
 			return qq_loop(a.Val)
 		}
 	default:
-		return ast
+		return ast, nil
 	}
 }
 
@@ -226,7 +263,7 @@ func macroexpand(ctx context.Context, ast MalType, env EnvType) (MalType, error)
 
 func eval_ast(ctx context.Context, ast MalType, env EnvType) (MalType, error) {
 	if Q[Symbol](ast) {
-		value, err := env.Get(ast.(Symbol))
+		value, err := Lookup(ctx, env, ast.(Symbol))
 		if err != nil {
 			return nil, lisperror.NewLispError(err, ast)
 		}
@@ -243,23 +280,28 @@ func eval_ast(ctx context.Context, ast MalType, env EnvType) (MalType, error) {
 		return List{Val: lst}, nil
 	} else if Q[Vector](ast) {
 		lst := []MalType{}
-		for _, a := range ast.(Vector).Val {
+		for _, a := range ast.(Vector).Slice() {
 			exp, e := EVAL(ctx, a, env)
 			if e != nil {
 				return nil, e
 			}
 			lst = append(lst, exp)
 		}
-		return Vector{Val: lst}, nil
+		return NewVector(lst...), nil
 	} else if Q[HashMap](ast) {
 		m := ast.(HashMap)
-		new_hm := HashMap{Val: map[string]MalType{}}
-		for k, v := range m.Val {
-			kv, e2 := EVAL(ctx, v, env)
-			if e2 != nil {
-				return nil, e2
+		new_hm := HashMap{}
+		for _, k := range m.OrderedKeys(Insertion) {
+			v, _ := m.Get(k)
+			kk, e := EVAL(ctx, k, env)
+			if e != nil {
+				return nil, e
+			}
+			kv, e := EVAL(ctx, v, env)
+			if e != nil {
+				return nil, e
 			}
-			new_hm.Val[k] = kv
+			new_hm = new_hm.Assoc(kk, kv)
 		}
 		return new_hm, nil
 	} else {
@@ -267,20 +309,9 @@ func eval_ast(ctx context.Context, ast MalType, env EnvType) (MalType, error) {
 	}
 }
 
-// Stepper is called (if not null) to stop at each step of the Lisp interpreter.
-//
-// It might be used as a debugger. Look at [lisp/debugger] package for a simple implementation.
-var Stepper func(ast MalType, ns EnvType) debuggertypes.Command
-var skip bool
-var outing1, outing2 bool
-
 func do(ctx context.Context, ast MalType, from, to int, env EnvType) (MalType, error) {
-	if outing1 {
-		defer func() {
-			skip = true
-			outing1 = false
-			outing2 = true
-		}()
+	if in := InterpreterFromContext(ctx); in != nil && in.stepOut() {
+		defer in.steppedOut()
 	}
 	if ast == nil {
 		return nil, nil
@@ -300,58 +331,235 @@ func do(ctx context.Context, ast MalType, from, to int, env EnvType) (MalType, e
 	return lst[len(lst)-1], nil
 }
 
+// evalOn returns EVAL on ctx, to evaluate the :or defaults of destructured parameters
+func evalOn(ctx context.Context) func(MalType, EnvType) (MalType, error) {
+	return func(ast MalType, env EnvType) (MalType, error) {
+		return EVAL(ctx, ast, env)
+	}
+}
+
+// orDefaultOn evaluates the :or defaults of the patterns of let and loop bindings on env
+func orDefaultOn(ctx context.Context, env EnvType) func(Symbol, MalType) (MalType, error) {
+	return func(_ Symbol, expr MalType) (MalType, error) {
+		return EVAL(ctx, expr, env)
+	}
+}
+
 // EVAL evaluates an Abstract Syntaxt Tree (AST) and returns a result (a reduced AST).
 // It requires a context that might cancel execution, and requires an environment that might
 // be modified.
 // AST usually is generated by [READ] or [READWithPreamble].
 func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error) {
-	// debugger section
-	if Stepper != nil {
-		if !skip {
-			cmd := Stepper(ast, env)
-
-			switch cmd {
-			case debuggertypes.Next:
-				skip = true
-				defer func() {
-					skip = false
-					if e != nil {
-						fmt.Println("ERROR: ", PRINT(e))
-					} else {
-						fmt.Println("ANSWER: ", PRINT(res))
-					}
-				}()
-			case debuggertypes.In:
-				skip = false
-				outing1 = false
-			case debuggertypes.Out:
-				skip = true
-				outing1 = true
-			case debuggertypes.NoOp:
-			default:
-				panic(fmt.Errorf("debugger command not handled %d", cmd))
+	if !HasNamespace(ctx) {
+		// in-ns only changes the current namespace of this evaluation
+		ctx = WithNamespace(ctx)
+	}
+	return eval(ctx, ast, env, nil)
+}
+
+// loopTarget is the loop a recur in tail position of its body jumps to
+type loopTarget struct {
+	form     List
+	patterns []MalType
+	// env is the environment enclosing the loop
+	env EnvType
+}
+
+// checkRecur returns an error if a recur of the loop or fn form ast is not in tail position of
+// a loop or passes it a wrong number of values, so a misplaced recur is rejected when the form
+// is evaluated even if it is never run. Only forms mentioning recur are analysed: a recur
+// introduced by a macro of a form that doesn't mention it is checked when it is run.
+func checkRecur(ctx context.Context, ast MalType, env EnvType) error {
+	if !mentionsRecur(ast) {
+		return nil
+	}
+	return recurTargets{ctx: ctx, env: env}.check(ast, -1, false)
+}
+
+func mentionsRecur(ast MalType) bool {
+	switch ast := ast.(type) {
+	case Symbol:
+		return ast.Val == "recur"
+	case List:
+		for _, form := range ast.Val {
+			if mentionsRecur(form) {
+				return true
 			}
 		}
-		if outing2 {
-			defer func() {
-				skip = false
-				outing2 = false
-			}()
+	case Vector:
+		for _, form := range ast.Slice() {
+			if mentionsRecur(form) {
+				return true
+			}
 		}
-		// else if outing1 {
-		// 	outing1 = false
-		// 	outing2 = true
-		// 	defer func() { // actually no need to defer
-		// 		skip = true
-		// 	}()
-		// } else if outing2 {
-		// 	outing2 = false
-		// 	defer func() {
-		// 		skip = false
-		// 	}()
-		// }
+	case HashMap:
+		found := false
+		ast.Range(func(k, v MalType) bool {
+			found = mentionsRecur(k) || mentionsRecur(v)
+			return !found
+		})
+		return found
 	}
+	return false
+}
+
+// recurTargets checks the recurs of a form, expanding its macros on env as [compiler] does
+type recurTargets struct {
+	ctx context.Context
+	env EnvType
+}
 
+// check checks ast, where arity is the number of bindings of the loop a recur in tail position
+// jumps to, or -1 if none
+func (r recurTargets) check(ast MalType, arity int, tail bool) error {
+	switch ast := ast.(type) {
+	case Vector:
+		return r.checkAll(ast.Slice(), arity, false)
+	case HashMap:
+		var err error
+		ast.Range(func(k, v MalType) bool {
+			if err = r.check(k, arity, false); err == nil {
+				err = r.check(v, arity, false)
+			}
+			return err == nil
+		})
+		return err
+	case List:
+		if len(ast.Val) == 0 {
+			return nil
+		}
+		if is_macro_call(ast, r.env) {
+			expanded, err := macroexpand(r.ctx, ast, r.env)
+			if err != nil {
+				// reported when it is evaluated
+				return nil
+			}
+			return r.check(expanded, arity, tail)
+		}
+		var a1 MalType
+		if len(ast.Val) > 1 {
+			a1 = ast.Val[1]
+		}
+		switch first(ast) {
+		case "quote", "quasiquoteexpand", "defmacro", "macroexpand":
+			return nil
+		case "quasiquote":
+			expanded, err := quasiquote(a1)
+			if err != nil {
+				return nil
+			}
+			return r.check(expanded, arity, tail)
+		case "def":
+			return r.checkAll(ast.Val[1:], arity, false)
+		case "let", "loop", "binding":
+			bindings, err := GetSlice(a1)
+			if err != nil {
+				return nil
+			}
+			for i := 1; i < len(bindings); i += 2 {
+				if err := r.check(bindings[i], arity, false); err != nil {
+					return err
+				}
+			}
+			switch first(ast) {
+			case "loop":
+				arity, tail = len(bindings)/2, true
+			case "binding":
+				// the body is not in tail position: bindings end when it returns
+				tail = false
+			}
+			return r.checkBody(ast.Val[2:], arity, tail)
+		case "recur":
+			if !tail || arity < 0 {
+				return lisperror.NewLispError(errors.New("recur can only be used in tail position of a loop"), ast)
+			}
+			if len(ast.Val)-1 != arity {
+				return lisperror.NewLispError(fmt.Errorf("wrong number of arguments (%d) passed to recur, expected %d", len(ast.Val)-1, arity), ast)
+			}
+			return r.checkAll(ast.Val[1:], arity, false)
+		case "try":
+			// recur can't cross a try
+			return r.checkAll(ast.Val[1:], -1, false)
+		case "if":
+			if err := r.check(a1, arity, false); err != nil {
+				return err
+			}
+			return r.checkAll(ast.Val[2:], arity, tail)
+		case "do":
+			return r.checkBody(ast.Val[1:], arity, tail)
+		case "fn":
+			_, clauses, err := parseFn(ast)
+			if err != nil {
+				return nil
+			}
+			for _, clause := range clauses {
+				// recur can't jump out of a fn
+				if err := r.checkBody(clause.body, -1, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		default:
+			return r.checkAll(ast.Val, arity, false)
+		}
+	default:
+		return nil
+	}
+}
+
+// checkAll checks each of asts on the same position
+func (r recurTargets) checkAll(asts []MalType, arity int, tail bool) error {
+	for _, ast := range asts {
+		if err := r.check(ast, arity, tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBody checks the forms of a body, where only the last one might be on tail position
+func (r recurTargets) checkBody(asts []MalType, arity int, tail bool) error {
+	for i, ast := range asts {
+		if err := r.check(ast, arity, tail && i == len(asts)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eval is [EVAL] with the innermost loop whose tail position is being evaluated, if any.
+// Tail positions are evaluated on the same TCO loop, every other form is evaluated by a
+// new eval with no loop, so recur is only accepted on tail positions.
+func eval(ctx context.Context, ast MalType, env EnvType, loop *loopTarget) (res MalType, e error) {
+	// debugger section
+	in := InterpreterFromContext(ctx)
+	if in != nil {
+		if in.opts.Trace != nil {
+			stepAST := ast
+			defer func() { in.opts.Trace(stepAST, env, res, e) }()
+		}
+		if in.opts.Stepper != nil {
+			stepped := in.step(ast, env)
+			defer func() { stepped(res, e) }()
+		}
+	}
+
+	ctx, e = enter(ctx, ast)
+	if e != nil {
+		return nil, e
+	}
+
+	// the function whose body is being evaluated (tail calls replace it), recorded on error stacks
+	var (
+		inFunc   bool
+		funcName string
+		callSite *Position
+	)
+	defer func() {
+		if e != nil && inFunc {
+			e = lisperror.AddFrame(e, funcName, callSite)
+		}
+	}()
 	for {
 		if ctx != nil {
 			select {
@@ -360,6 +568,12 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 			default:
 			}
 		}
+		if e := step(ctx, ast); e != nil {
+			return nil, e
+		}
+
+		// top level forms are evaluated on the current namespace
+		env = NamespaceEnv(ctx, env)
 
 		switch ast := ast.(type) {
 		case List: // continue
@@ -410,12 +624,43 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 			if e != nil {
 				return nil, e
 			}
-			switch a1 := a1.(type) {
-			case Symbol:
-				return env.Set(a1, res), nil
-			default:
-				return nil, lisperror.NewLispError(fmt.Errorf("cannot use '%T' as identifier", a1), ast)
+			sym, meta, e := defSymbol(a1)
+			if e != nil {
+				return nil, lisperror.NewLispError(e, ast)
+			}
+			if flag(meta, "ʞprivate") {
+				SetPrivate(env, sym.Val)
 			}
+			if flag(meta, "ʞdynamic") {
+				SetDynamic(env, sym.Val)
+			}
+			return env.Set(sym, named(res, sym.Val)), nil
+		case "binding":
+			arr1, e := GetSlice(a1)
+			if e != nil {
+				return nil, e
+			}
+			if len(arr1)%2 != 0 {
+				return nil, lisperror.NewLispError(errors.New("binding: odd elements on binding vector"), a1)
+			}
+			bindings := make(map[Var]MalType, len(arr1)/2)
+			for i := 0; i < len(arr1); i += 2 {
+				sym, ok := arr1[i].(Symbol)
+				if !ok {
+					return nil, lisperror.NewLispError(errors.New("non-symbol bind value"), a1)
+				}
+				v, e := LookupVar(env, sym)
+				if e != nil {
+					return nil, lisperror.NewLispError(e, arr1[i])
+				}
+				exp, e := EVAL(ctx, arr1[i+1], env)
+				if e != nil {
+					return nil, e
+				}
+				bindings[v] = exp
+			}
+			// the body is not in tail position: bindings end when it returns
+			return do(WithBindings(ctx, bindings), ast, 2, 0, env)
 		case "let":
 			let_env := NewSubordinateEnv(env)
 			arr1, e := GetSlice(a1)
@@ -426,14 +671,16 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 				return nil, lisperror.NewLispError(errors.New("let: odd elements on binding vector"), a1)
 			}
 			for i := 0; i < len(arr1); i += 2 {
-				if !Q[Symbol](arr1[i]) {
+				if _, ok := arr1[i].(Symbol); !ok && !Q[Vector](arr1[i]) && !Q[HashMap](arr1[i]) {
 					return nil, lisperror.NewLispError(errors.New("non-symbol bind value"), a1)
 				}
 				exp, e := EVAL(ctx, arr1[i+1], let_env)
 				if e != nil {
 					return nil, e
 				}
-				let_env.Set(arr1[i].(Symbol), exp)
+				if e := Destructure(arr1[i], exp, func(sym Symbol, v MalType) { let_env.Set(sym, v) }, orDefaultOn(ctx, let_env)); e != nil {
+					return nil, e
+				}
 			}
 			astRef := ast.(List)
 			ast, e = do(ctx, astRef, 2, -1, let_env)
@@ -441,67 +688,88 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 				return nil, e
 			}
 			env = let_env
+		case "loop":
+			bindings, e := GetSlice(a1)
+			if e != nil {
+				return nil, e
+			}
+			if len(bindings)%2 != 0 {
+				return nil, lisperror.NewLispError(errors.New("loop: odd elements on binding vector"), a1)
+			}
+			if e := checkRecur(ctx, ast, env); e != nil {
+				return nil, e
+			}
+			loop = &loopTarget{form: ast.(List), env: env}
+			loop_env := NewSubordinateEnv(env)
+			for i := 0; i < len(bindings); i += 2 {
+				if _, ok := bindings[i].(Symbol); !ok && !Q[Vector](bindings[i]) && !Q[HashMap](bindings[i]) {
+					return nil, lisperror.NewLispError(errors.New("non-symbol bind value"), a1)
+				}
+				exp, e := EVAL(ctx, bindings[i+1], loop_env)
+				if e != nil {
+					return nil, e
+				}
+				if e := Destructure(bindings[i], exp, func(sym Symbol, v MalType) { loop_env.Set(sym, v) }, orDefaultOn(ctx, loop_env)); e != nil {
+					return nil, e
+				}
+				loop.patterns = append(loop.patterns, bindings[i])
+			}
+			ast, e = do(ctx, loop.form, 2, -1, loop_env)
+			if e != nil {
+				return nil, e
+			}
+			env = loop_env
+		case "recur":
+			if loop == nil {
+				return nil, lisperror.NewLispError(errors.New("recur can only be used in tail position of a loop"), ast)
+			}
+			args, e := eval_ast(ctx, List{Val: ast.(List).Val[1:]}, env)
+			if e != nil {
+				return nil, e
+			}
+			if len(args.(List).Val) != len(loop.patterns) {
+				return nil, lisperror.NewLispError(fmt.Errorf("wrong number of arguments (%d) passed to recur, expected %d", len(args.(List).Val), len(loop.patterns)), ast)
+			}
+			recur_env := NewSubordinateEnv(loop.env)
+			for i, pattern := range loop.patterns {
+				if e := Destructure(pattern, args.(List).Val[i], func(sym Symbol, v MalType) { recur_env.Set(sym, v) }, orDefaultOn(ctx, recur_env)); e != nil {
+					return nil, e
+				}
+			}
+			ast, e = do(ctx, loop.form, 2, -1, recur_env)
+			if e != nil {
+				return nil, e
+			}
+			env = recur_env
 		case "quote": // '
 			return a1, nil
 		case "quasiquoteexpand":
-			return quasiquote(a1), nil
+			return quasiquote(a1)
 		case "quasiquote": // `
-			ast = quasiquote(a1)
+			ast, e = quasiquote(a1)
+			if e != nil {
+				return nil, e
+			}
 		case "defmacro":
-			fn, e := EVAL(ctx, a2, env)
-			fn = fn.(MalFunc).SetMacro()
+			sym, ok := a1.(Symbol)
+			if !ok {
+				return nil, lisperror.NewLispError(fmt.Errorf("cannot use '%T' as identifier", a1), ast)
+			}
+			res, e := EVAL(ctx, a2, env)
 			if e != nil {
 				return nil, e
 			}
-			return env.Set(a1.(Symbol), fn), nil
+			fn, ok := res.(MalFunc)
+			if !ok {
+				return nil, lisperror.NewLispError(fmt.Errorf("defmacro expects a function (was of type %s)", TypeName(res)), ast)
+			}
+			return env.Set(sym, fn.SetMacro()), nil
 		case "macroexpand":
 			return macroexpand(ctx, a1, env)
 		case "try":
-			lst := ast.(List).Val
-			var last MalType
-			var prelast MalType
-			switch len(lst) {
-			case 1:
-				return nil, nil
-			case 2:
-				last = lst[1]
-				prelast = nil
-			case 3:
-				last = lst[2]
-				prelast = lst[1]
-			default:
-				last = lst[len(lst)-1]
-				prelast = lst[len(lst)-2]
-			}
-			var tryDo, catchDo, finallyDo MalType // Lists
-			var catchBind MalType                 // Symbol
-
-			switch first(last) {
-			case "catch":
-				finallyDo = nil
-				catchBind = last.(List).Val[1]
-				catchDo = List{Val: last.(List).Val[2:]}
-				tryDo = List{Val: lst[1 : len(lst)-1]}
-				if len(catchDo.(List).Val) == 0 {
-					return nil, lisperror.NewLispError(errors.New("catch must have 2 arguments at least"), ast)
-				}
-			case "finally":
-				finallyDo = List{Val: last.(List).Val[1:]}
-				switch first(prelast) {
-				case "catch":
-					catchBind = prelast.(List).Val[1]
-					catchDo = List{Val: prelast.(List).Val[2:]}
-					tryDo = List{Val: lst[1 : len(lst)-2]}
-				default:
-					catchBind = nil
-					catchDo = nil
-					tryDo = List{Val: lst[1 : len(lst)-1]}
-				}
-			default:
-				finallyDo = nil
-				catchBind = nil
-				catchDo = nil
-				tryDo = List{Val: lst[1:]}
+			body, catches, finally, err := parseTry(ast.(List))
+			if err != nil {
+				return nil, err
 			}
 			exp, e := func() (res MalType, err error) {
 				defer malRecover(&err)
@@ -510,37 +778,55 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 					timeout := (time.Until(dl) / 10) * 8
 					ctx, cancel := context.WithTimeout(ctx, timeout)
 					defer cancel()
-					return do(ctx, tryDo, 0, 0, env)
+					return do(ctx, List{Val: body}, 0, 0, env)
 				}
-				return do(ctx, tryDo, 0, 0, env)
+				return do(ctx, List{Val: body}, 0, 0, env)
 			}()
 
-			defer func() { _, _ = do(ctx, finallyDo, 0, 0, env) }()
+			if finally != nil {
+				defer func() { _, _ = do(ctx, List{Val: finally}, 0, 0, env) }()
+			}
 
 			if e == nil {
 				return exp, nil
-			} else {
-				if catchDo != nil {
-					var caughtError MalType
-					if er, ok := e.(interface{ ErrorValue() MalType }); ok {
-						caughtError = er.ErrorValue()
-					} else {
-						caughtError = e.Error()
-					}
-					binds := NewList(catchBind)
-					new_env, err := NewSubordinateEnvWithBinds(env, binds, NewList(caughtError))
-					if err != nil {
-						return nil, err
-					}
-					ast, err = do(ctx, catchDo, 0, 0, new_env)
-					if err != nil {
-						return nil, err
-					}
-					env = new_env
-					continue
+			}
+			if uncatchable(e) {
+				return nil, e
+			}
+			caught := caughtValue(e)
+			var clause *catchClause
+			for i := range catches {
+				if catches[i].selector == nil {
+					clause = &catches[i]
+					break
+				}
+				selector, err := EVAL(ctx, catches[i].selector, env)
+				if err != nil {
+					return nil, err
 				}
+				selected, err := selects(ctx, selector, caught, catches[i].form)
+				if err != nil {
+					return nil, err
+				}
+				if selected {
+					clause = &catches[i]
+					break
+				}
+			}
+			if clause == nil {
 				return nil, e
 			}
+			new_env, err := NewSubordinateEnvWithBinds(env, NewList(clause.bind), NewList(caught), evalOn(ctx))
+			if err != nil {
+				return nil, err
+			}
+			ast, err = do(ctx, List{Val: clause.body}, 0, -1, new_env)
+			if err != nil {
+				return nil, err
+			}
+			env = new_env
+			// recur can't cross a try
+			loop = nil
 		case "do":
 			var err error
 			ast, err = do(ctx, ast, 1, -1, env)
@@ -562,15 +848,44 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 				ast = a2
 			}
 		case "fn":
-			fn := MalFunc{
-				Eval:    EVAL,
-				Exp:     List{Val: append([]MalType{Symbol{Val: "do"}}, ast.(List).Val[2:]...)},
-				Env:     env,
-				Params:  a1,
-				IsMacro: false,
-				GenEnv:  NewSubordinateEnvWithBinds,
-				Meta:    nil,
-				Cursor:  ast.(List).Cursor,
+			name, clauses, err := parseFn(ast.(List))
+			if err != nil {
+				return nil, err
+			}
+			if err := checkRecur(ctx, ast, env); err != nil {
+				return nil, err
+			}
+			fnEnv := env
+			if name != nil {
+				// the fn name is bound to itself on its body
+				fnEnv = NewSubordinateEnv(env)
+			}
+			arities := make([]MalFunc, 0, len(clauses))
+			for _, clause := range clauses {
+				arities = append(arities, MalFunc{
+					Eval:    EVAL,
+					Exp:     List{Val: append([]MalType{Symbol{Val: "do"}}, clause.body...)},
+					Env:     fnEnv,
+					Params:  clause.params,
+					IsMacro: false,
+					GenEnv:  NewSubordinateEnvWithBinds,
+					Meta:    nil,
+					Cursor:  ast.(List).Cursor,
+				})
+			}
+			fn := arities[0]
+			if len(arities) > 1 {
+				fn = MalFunc{
+					Eval:    EVAL,
+					Env:     fnEnv,
+					GenEnv:  NewSubordinateEnvWithBinds,
+					Cursor:  ast.(List).Cursor,
+					Arities: arities,
+				}
+			}
+			if name != nil {
+				fn.Name = name.Val
+				fnEnv.Set(*name, fn)
 			}
 			return fn, nil
 		default:
@@ -580,9 +895,14 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 			}
 			f := el.(List).Val[0]
 			if Q[MalFunc](f) {
-				fn := f.(MalFunc)
+				fn, e := f.(MalFunc).Arity(len(el.(List).Val) - 1)
+				if e != nil {
+					return nil, lisperror.NewLispError(e, ast)
+				}
+				inFunc, funcName, callSite = true, fn.Name, ast.(List).Cursor
+				loop = nil
 				ast = fn.Exp
-				env, e = NewSubordinateEnvWithBinds(fn.Env, fn.Params, List{Val: el.(List).Val[1:]})
+				env, e = NewSubordinateEnvWithBinds(fn.Env, fn.Params, List{Val: el.(List).Val[1:]}, evalOn(ctx))
 				if e != nil {
 					if ast == nil {
 						return nil, lisperror.NewLispError(e, nil)
@@ -594,6 +914,15 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 						return nil, lisperror.NewLispError(e, ast)
 					}
 				}
+			} else if fn, ok := f.(Callable); ok {
+				result, err := fn.Call(ctx, el.(List).Val[1:])
+				if err != nil {
+					return nil, lisperror.NewLispError(err, ast)
+				}
+				if err := checkSize(ctx, result, ast); err != nil {
+					return nil, err
+				}
+				return result, nil
 			} else {
 				fn, ok := f.(Func)
 				if !ok {
@@ -603,26 +932,155 @@ func EVAL(ctx context.Context, ast MalType, env EnvType) (res MalType, e error)
 				if err != nil {
 					return nil, lisperror.NewLispError(err, ast)
 				}
+				if err := checkSize(ctx, result, ast); err != nil {
+					return nil, err
+				}
 				return result, nil
 			}
 		}
-		if Stepper != nil {
-			return EVAL(ctx, ast, env)
+		if in.debugging() {
+			return eval(ctx, ast, env, loop)
 		}
 	} // TCO loop
 }
 
+// fnClause is a parameters list (or vector) and its body
+type fnClause struct {
+	params MalType
+	body   []MalType
+}
+
+// parseFn returns the optional name and the clauses of a fn form,
+// either (fn name? params body...) or (fn name? (params body...) ...)
+func parseFn(ast List) (*Symbol, []fnClause, error) {
+	forms := ast.Val[1:]
+	var name *Symbol
+	if len(forms) > 0 {
+		if sym, ok := forms[0].(Symbol); ok {
+			name = &sym
+			forms = forms[1:]
+		}
+	}
+	if len(forms) == 0 {
+		return name, []fnClause{{}}, nil
+	}
+	if !isArity(forms[0]) {
+		return name, []fnClause{{params: forms[0], body: forms[1:]}}, nil
+	}
+	clauses := make([]fnClause, 0, len(forms))
+	variadic := false
+	fixed := map[int]bool{}
+	for _, form := range forms {
+		if !isArity(form) {
+			return nil, nil, lisperror.NewLispError(errors.New("fn arities must be lists of parameters and body"), ast)
+		}
+		clause := form.(List).Val
+		n, rest := ParamsArity(clause[0])
+		switch {
+		case rest && variadic:
+			return nil, nil, lisperror.NewLispError(errors.New("fn can't have more than one variadic arity"), ast)
+		case rest:
+			variadic = true
+		case fixed[n]:
+			// the later clause would be unreachable
+			return nil, nil, lisperror.NewLispError(fmt.Errorf("fn can't have 2 overloads with the same arity (%d)", n), ast)
+		default:
+			fixed[n] = true
+		}
+		clauses = append(clauses, fnClause{params: clause[0], body: clause[1:]})
+	}
+	return name, clauses, nil
+}
+
+// isArity returns true if form is a (params body...) clause of a multi-arity fn
+func isArity(form MalType) bool {
+	clause, ok := form.(List)
+	if !ok || len(clause.Val) == 0 {
+		return false
+	}
+	switch clause.Val[0].(type) {
+	case Vector, List:
+		return true
+	default:
+		return false
+	}
+}
+
+// defSymbol returns the symbol defined by a def and its metadata.
+// (def ^:private name value) is read as (def (with-meta name :private) value), and
+// keyword metadata is read as {keyword true}
+func defSymbol(a1 MalType) (Symbol, HashMap, error) {
+	if first(a1) == "with-meta" && len(a1.(List).Val) == 3 {
+		sym, meta, err := defSymbol(a1.(List).Val[1])
+		if err != nil {
+			return Symbol{}, HashMap{}, err
+		}
+		merged := meta
+		switch m := a1.(List).Val[2].(type) {
+		case HashMap:
+			m.Range(func(k, v MalType) bool {
+				merged = merged.Assoc(k, v)
+				return true
+			})
+		case string:
+			if !strings.HasPrefix(m, "ʞ") {
+				return Symbol{}, HashMap{}, errors.New("metadata must be a keyword or a hash-map")
+			}
+			merged = merged.Assoc(m, true)
+		default:
+			return Symbol{}, HashMap{}, errors.New("metadata must be a keyword or a hash-map")
+		}
+		return sym, merged, nil
+	}
+	sym, ok := a1.(Symbol)
+	if !ok {
+		return Symbol{}, HashMap{}, fmt.Errorf("cannot use '%T' as identifier", a1)
+	}
+	return sym, HashMap{}, nil
+}
+
+// flag returns true if key is set to a truthy value on meta
+func flag(meta HashMap, key string) bool {
+	v, ok := meta.Get(key)
+	return ok && v != nil && v != false
+}
+
+// named returns fn with its name set, if it is an anonymous function
+func named(fn MalType, name string) MalType {
+	switch fn := fn.(type) {
+	case MalFunc:
+		if fn.Name == "" {
+			fn.Name = name
+		}
+		return fn
+	case *compiledFn:
+		if fn.name == "" {
+			fn := *fn
+			fn.name = name
+			return &fn
+		}
+		return fn
+	default:
+		return fn
+	}
+}
+
 func first(list MalType) string {
-	if list != nil && Q[List](list) && Q[Symbol](list.(List).Val[0]) {
-		return list.(List).Val[0].(Symbol).Val
+	if l, ok := list.(List); ok && len(l.Val) > 0 {
+		if sym, ok := l.Val[0].(Symbol); ok {
+			return sym.Val
+		}
 	}
 	return ""
 }
 
 func malRecover(err *error) {
-	rerr := recover()
-	if rerr != nil {
-		*err = rerr.(error)
+	switch rerr := recover().(type) {
+	case nil:
+	case error:
+		*err = rerr
+	default:
+		*err = fmt.Errorf("panic: %v", rerr)
 	}
 }
 
@@ -634,6 +1092,10 @@ func PRINT(ast MalType) string {
 
 // REPL or [READ], [EVAL] and [PRINT] loop execute those three functions in sequence.
 // (but the loop "L" actually must be executed by the caller)
+//
+// The current namespace set by in-ns is kept across the REPL calls of a loop only if they
+// share a context of [env.WithNamespace]. Hash maps and sets are printed in the order of
+// ctx (see [WithKeyOrder]).
 func REPL(ctx context.Context, env EnvType, sourceCode string, cursor *Position) (MalType, error) {
 	ast, err := READ(sourceCode, cursor, env)
 	if err != nil {
@@ -643,13 +1105,14 @@ func REPL(ctx context.Context, env EnvType, sourceCode string, cursor *Position)
 	if err != nil {
 		return nil, err
 	}
-	return PRINT(exp), nil
+	return printer.Print(exp, true, KeyOrderFromContext(ctx)), nil
 }
 
 // REPLWithPreamble or [READ], [EVAL] and [PRINT] loop with preamble execute those three functions in sequence.
 // (but the loop "L" actually must be executed by the caller)
 //
 // Source code might include a preamble with the values for the placeholders. See [READWithPreamble]
+// Hash maps and sets are printed in the order of ctx (see [WithKeyOrder]).
 func REPLWithPreamble(ctx context.Context, env EnvType, sourceCode string, cursor *Position) (MalType, error) {
 	ast, err := READWithPreamble(sourceCode, cursor, env)
 	if err != nil {
@@ -659,7 +1122,7 @@ func REPLWithPreamble(ctx context.Context, env EnvType, sourceCode string, curso
 	if err != nil {
 		return nil, err
 	}
-	return PRINT(exp), nil
+	return printer.Print(exp, true, KeyOrderFromContext(ctx)), nil
 }
 
 // ReadEvalWithPreamble or [READ] and [EVAL] with preamble execute those three functions in sequence.
@@ -674,3 +1137,25 @@ func ReadEvalWithPreamble(ctx context.Context, env EnvType, sourceCode string, c
 	}
 	return EVAL(ctx, ast, env)
 }
+
+// ReadEvalAll reads the forms of src one by one (see [reader.NewDecoder]), evaluating each of
+// them before reading the next one, and returns the result of the last form (nil if there
+// are none). Evaluation stops on the first form that fails to read or evaluate.
+func ReadEvalAll(ctx context.Context, env EnvType, src io.Reader, cursor *Position) (MalType, error) {
+	// the forms share a current namespace, that is restored on return
+	ctx = WithNamespace(ctx)
+	dec := reader.NewDecoder(src, cursor, env)
+	var result MalType
+	for {
+		ast, err := dec.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if result, err = EVAL(ctx, ast, env); err != nil {
+			return nil, err
+		}
+	}
+}
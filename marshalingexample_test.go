@@ -21,12 +21,10 @@ type LispMarshalExample struct {
 }
 
 func (lec LispMarshalExample) MarshalHashMap() (types.MalType, error) {
-	return types.HashMap{
-		Val: map[string]types.MalType{
-			"ʞa": lec.Val.A,
-			"ʞb": lec.Val.B,
-		},
-	}, nil
+	return types.NewHashMapFromMap(map[string]types.MalType{
+		"ʞa": lec.Val.A,
+		"ʞb": lec.Val.B,
+	}), nil
 }
 
 type LispMarshalExampleFactory struct {
@@ -38,10 +36,10 @@ func new_marshalexample() (types.MalType, error) {
 }
 
 func (lec LispMarshalExampleFactory) FromHashMap(_hm types.MalType) (types.MalType, error) {
-	hm := _hm.(types.HashMap)
+	hm := _hm.(types.HashMap).Map()
 	ex := MarshalExample{
-		A: hm.Val["ʞa"].(int),
-		B: hm.Val["ʞb"].(string),
+		A: hm["ʞa"].(int),
+		B: hm["ʞb"].(string),
 	}
 	return LispMarshalExample{ex}, nil
 }
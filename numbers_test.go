@@ -2,10 +2,12 @@ package lisp_test
 
 import (
 	"context"
+	"math/big"
 	"testing"
 
 	"github.com/jig/lisp"
 	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/types"
 )
 
 func TestInt(t *testing.T) {
@@ -33,15 +35,28 @@ func TestFloat(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if ast.(float32) != 3.1416 {
-		t.Fatal(`ast.(float32) != 3.1416`)
+	if ast.(float64) != 3.1416 {
+		t.Fatal(`ast.(float64) != 3.1416`)
 	}
 	res, err := lisp.EVAL(context.Background(), ast, env.NewEnv())
 	if err != nil {
 		t.Fatal(err)
 	}
-	if res.(float32) != 3.1416 {
-		t.Fatal(`ast.(float32) != 3.1416`)
+	if res.(float64) != 3.1416 {
+		t.Fatal(`ast.(float64) != 3.1416`)
+	}
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+	for _, f := range []float64{0, 1, -1, 0.1, 2.5e-12, 1e21, 1.0 / 3} {
+		printed := lisp.PRINT(f)
+		ast, err := lisp.READ(printed, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ast.(float64) != f {
+			t.Fatalf("%s read back as %v instead of %v", printed, ast, f)
+		}
 	}
 }
 
@@ -95,3 +110,29 @@ func TestBinary(t *testing.T) {
 		t.Fatal(`ast.(int) != 0b1100`)
 	}
 }
+
+func TestBigIntLiteral(t *testing.T) {
+	ast, err := lisp.READ("123456789012345678901234567890N", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.(types.BigInt).Val.String() != "123456789012345678901234567890" {
+		t.Fatal(`ast.(types.BigInt) != 123456789012345678901234567890`)
+	}
+	if lisp.PRINT(ast) != "123456789012345678901234567890N" {
+		t.Fatal(lisp.PRINT(ast))
+	}
+}
+
+func TestDecimalLiteral(t *testing.T) {
+	ast, err := lisp.READ("1234.50M", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.(types.Decimal).Val.Cmp(big.NewRat(123450, 100)) != 0 {
+		t.Fatal(`ast.(types.Decimal) != 1234.50`)
+	}
+	if lisp.PRINT(ast) != "1234.5M" {
+		t.Fatal(lisp.PRINT(ast))
+	}
+}
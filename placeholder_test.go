@@ -31,19 +31,18 @@ func TestPlaceholders(t *testing.T) {
 				(def v4 $4)
 				true)`
 
+	placeholders := NewHashMapFromMap(map[string]MalType{
+		"$0":      "hello",
+		"$1":      "{\"key\": \"value\"}",
+		"$NUMBER": 44,
+		"$3":      LS("+", 1, 1),
+		"$4": LS("json-encode",
+			Example{A: 3, B: "blurp"}),
+	})
 	exp, err := reader.Read_str(
 		str,
 		nil,
-		&HashMap{
-			Val: map[string]MalType{
-				"$0":      "hello",
-				"$1":      "{\"key\": \"value\"}",
-				"$NUMBER": 44,
-				"$3":      LS("+", 1, 1),
-				"$4": LS("json-encode",
-					Example{A: 3, B: "blurp"}),
-			},
-		},
+		&placeholders,
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -152,10 +151,10 @@ func TestREADWithPreamble(t *testing.T) {
 		if !ok {
 			t.Fatal("no {\"key\": \"value\"}")
 		}
-		if len(h.Val) != 1 {
+		if h.Len() != 1 {
 			t.Fatal("pum")
 		}
-		if h.Val["key"].(string) != "value" {
+		if value, _ := h.Get("key"); value.(string) != "value" {
 			t.Fatal("pum2")
 		}
 
@@ -597,10 +596,10 @@ func TestHashMapMarshalers(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if goStruct.(HashMap).Val["ʞa"] != 1984 {
+		if a, _ := goStruct.(HashMap).Get("ʞa"); a != 1984 {
 			t.Fatal("no 1984")
 		}
-		if goStruct.(HashMap).Val["ʞb"] != "I am B" {
+		if b, _ := goStruct.(HashMap).Get("ʞb"); b != "I am B" {
 			t.Fatal("no B")
 		}
 	}
@@ -624,7 +623,8 @@ func TestPassingLispDataFromGo(t *testing.T) {
 					(def l $L)
 					(def v $V)
 					(def s $S)
-					(def vs $VS)
+					;; Go structs print as {0 hello}, a hash map with symbols
+					(def vs (quote $VS))
 					(assert (= 2 l))
 					(assert (contains? s "bob"))
 					(assert (= "hello" (get v 0)))
@@ -0,0 +1,81 @@
+package printer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jig/lisp/types"
+)
+
+// Canonical converts a readable AST to its canonical form: the same AST always produces the
+// same string, whatever the source it was read from. Elements are separated by a single space,
+// hash map entries and set items are sorted (see [types.Compare]), strings always use double
+// quotes with escapes (never ¬ quotes), and metadata and source positions are not printed.
+// Values that can't be read back (functions, atoms, Go values...) return an error.
+func Canonical(obj types.MalType) (string, error) {
+	var sb strings.Builder
+	if err := canonical(&sb, obj); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func canonical(sb *strings.Builder, obj types.MalType) error {
+	switch obj := obj.(type) {
+	case nil:
+		sb.WriteString("nil")
+	case float64:
+		if math.IsInf(obj, 0) || math.IsNaN(obj) {
+			return fmt.Errorf("canonical: %s can't be read back", Pr_str(obj, true))
+		}
+		sb.WriteString(Pr_str(obj, true))
+	case bool, int, types.BigInt, types.Decimal, types.Symbol, types.Char:
+		sb.WriteString(Pr_str(obj, true))
+	case string:
+		if strings.HasPrefix(obj, "ʞ") {
+			sb.WriteString(Pr_str(obj, true))
+			return nil
+		}
+		sb.WriteString(quote(obj))
+	case types.List:
+		return canonicalSeq(sb, "(", obj.Val, ")")
+	case types.Vector:
+		return canonicalSeq(sb, "[", obj.Slice(), "]")
+	case types.Set:
+		return canonicalSeq(sb, "#{", obj.OrderedItems(types.Sorted), "}")
+	case types.HashMap:
+		sb.WriteString("{")
+		for i, k := range obj.OrderedKeys(types.Sorted) {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			if err := canonical(sb, k); err != nil {
+				return err
+			}
+			sb.WriteString(" ")
+			v, _ := obj.Get(k)
+			if err := canonical(sb, v); err != nil {
+				return err
+			}
+		}
+		sb.WriteString("}")
+	default:
+		return fmt.Errorf("canonical: values of type %s can't be read back", types.TypeName(obj))
+	}
+	return nil
+}
+
+func canonicalSeq(sb *strings.Builder, start string, elems []types.MalType, end string) error {
+	sb.WriteString(start)
+	for i, e := range elems {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		if err := canonical(sb, e); err != nil {
+			return err
+		}
+	}
+	sb.WriteString(end)
+	return nil
+}
@@ -0,0 +1,63 @@
+package printer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jig/lisp/types"
+)
+
+// escapes are the short escape sequences of the characters of strings
+var escapes = map[rune]string{
+	'\\': `\\`,
+	'"':  `\"`,
+	'\n': `\n`,
+	'\t': `\t`,
+	'\r': `\r`,
+	'\b': `\b`,
+	'\f': `\f`,
+	'\a': `\a`,
+	'\v': `\v`,
+}
+
+// quote returns s as a string literal that the reader reads back as s: between double quotes,
+// with escapes for backslashes, double quotes and control characters, and \x escapes for
+// the bytes that are not UTF-8
+func quote(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch escape, ok := escapes[r]; {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&sb, `\x%02x`, s[i])
+		case ok:
+			sb.WriteString(escape)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		default:
+			sb.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// charToString prints c as a character literal (\a, \newline, \u0000), or as the character
+// itself if not readably
+func charToString(c types.Char, print_readably bool) string {
+	if !print_readably {
+		return string(c)
+	}
+	if name, ok := types.CharName(c); ok {
+		return `\` + name
+	}
+	if !unicode.IsPrint(rune(c)) {
+		return fmt.Sprintf(`\u%04x`, rune(c))
+	}
+	return `\` + string(c)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/jig/lisp/marshaler"
@@ -14,38 +15,64 @@ import (
 //
 // Deprecated: it must not be public
 func Pr_list(lst []types.MalType, pr bool,
+	start string, end string, join string) string {
+	return printer{types.Sorted}.pr_list(lst, pr, start, end, join)
+}
+
+// PrintList prints the elements of lst separated by join, with hash maps and sets in order
+// (see [Print])
+func PrintList(lst []types.MalType, print_readably bool, order types.Order, join string) string {
+	return printer{order}.pr_list(lst, print_readably, "", "", join)
+}
+
+// Pr_str converts an AST to a string, suitable for printing
+// AST might be generated by lisp.EVAL(...) or by lisp.READ(...) or lisp.READWithPreamble(...).
+// Hash maps and sets are printed sorted (see [Print]).
+func Pr_str(obj types.MalType, print_readably bool) string {
+	return printer{types.Sorted}.pr_str(obj, print_readably)
+}
+
+// Print is [Pr_str] printing the entries of hash maps and sets in order
+func Print(obj types.MalType, print_readably bool, order types.Order) string {
+	return printer{order}.pr_str(obj, print_readably)
+}
+
+// printer prints hash maps and sets in its order
+type printer struct {
+	order types.Order
+}
+
+func (p printer) pr_list(lst []types.MalType, pr bool,
 	start string, end string, join string) string {
 	str_list := make([]string, 0, len(lst))
 	for _, e := range lst {
-		str_list = append(str_list, Pr_str(e, pr))
+		str_list = append(str_list, p.pr_str(e, pr))
 	}
 	return start + strings.Join(str_list, join) + end
 }
 
-// Pr_str converts an AST to a string, suitable for printing
-// AST might be generated by lisp.EVAL(...) or by lisp.READ(...) or lisp.READWithPreamble(...).
-func Pr_str(obj types.MalType, print_readably bool) string {
+func (p printer) pr_str(obj types.MalType, print_readably bool) string {
 	switch tobj := obj.(type) {
 	case types.LispPrintable:
-		return tobj.LispPrint(Pr_str)
+		return tobj.LispPrint(p.pr_str)
 	// case lisperror.LispError:
 	// 	return tobj.LispPrint(Pr_str)
 	case types.List:
-		return Pr_list(tobj.Val, print_readably, "(", ")", " ")
+		return p.pr_list(tobj.Val, print_readably, "(", ")", " ")
 	case types.Vector:
-		return Pr_list(tobj.Val, print_readably, "[", "]", " ")
+		return p.pr_list(tobj.Slice(), print_readably, "[", "]", " ")
 	case marshaler.HashMap:
 		value, err := tobj.MarshalHashMap()
 		if err != nil {
 			return "{}"
 		}
-		return hashMapToString(value.(types.HashMap), print_readably)
+		return p.hashMapToString(value.(types.HashMap), print_readably)
 	case types.HashMap:
-		return hashMapToString(tobj, print_readably)
+		return p.hashMapToString(tobj, print_readably)
 	case types.Set:
-		str_list := make([]string, 0, len(tobj.Val))
-		for k := range tobj.Val {
-			str_list = append(str_list, Pr_str(k, print_readably))
+		str_list := make([]string, 0, tobj.Len())
+		for _, k := range tobj.OrderedItems(p.order) {
+			str_list = append(str_list, p.pr_str(k, print_readably))
 		}
 		return "#{" + strings.Join(str_list, " ") + "}"
 	case string:
@@ -55,29 +82,48 @@ func Pr_str(obj types.MalType, print_readably bool) string {
 			if strings.HasPrefix(tobj, `{"`) && strings.HasSuffix(tobj, `}`) {
 				return `¬` + strings.Replace(tobj, `¬`, `¬¬`, -1) + `¬`
 			} else {
-				return `"` + strings.Replace(
-					strings.Replace(
-						strings.Replace(tobj, `\`, `\\`, -1),
-						`"`, `\"`, -1),
-					"\n", `\n`, -1) + `"`
+				return quote(tobj)
 			}
 		} else {
 			return tobj
 		}
+	case types.Char:
+		return charToString(tobj, print_readably)
+	case types.BigInt:
+		if print_readably {
+			return tobj.String() + "N"
+		}
+		return tobj.String()
+	case types.Decimal:
+		if print_readably {
+			return tobj.String() + "M"
+		}
+		return tobj.String()
+	case float64:
+		return floatToString(tobj)
+	case float32:
+		return floatToString(float64(tobj))
 	case types.Symbol:
 		return tobj.Val
 	case nil:
 		return "nil"
 	case types.MalFunc:
+		if len(tobj.Arities) > 0 {
+			str := "(fn"
+			for _, arity := range tobj.Arities {
+				str += " (" + p.pr_str(arity.Params, true) + " " + p.pr_str(arity.Exp, true) + ")"
+			}
+			return str + ")"
+		}
 		return "(fn " +
-			Pr_str(tobj.Params, true) + " " +
-			Pr_str(tobj.Exp, true) + ")"
+			p.pr_str(tobj.Params, true) + " " +
+			p.pr_str(tobj.Exp, true) + ")"
 	case types.Func:
 		return fmt.Sprintf("«function %v»", strings.ToLower(runtime.FuncForPC(reflect.ValueOf(tobj.Fn).Pointer()).Name()))
 	case func([]types.MalType) (types.MalType, error):
 		return fmt.Sprintf("«function %v»", obj)
 	case error:
-		return "«go-error " + Pr_str(tobj.Error(), true) + "»"
+		return "«go-error " + p.pr_str(tobj.Error(), true) + "»"
 	// case *types.Atom:
 	// 	return "(atom " +
 	// 		Pr_str(tobj.Val, true) + ")"
@@ -86,11 +132,21 @@ func Pr_str(obj types.MalType, print_readably bool) string {
 	}
 }
 
-func hashMapToString(tobj types.HashMap, print_readably bool) string {
-	str_list := make([]string, 0, len(tobj.Val)*2)
-	for k, v := range tobj.Val {
-		str_list = append(str_list, Pr_str(k, print_readably))
-		str_list = append(str_list, Pr_str(v, print_readably))
+func (p printer) hashMapToString(tobj types.HashMap, print_readably bool) string {
+	str_list := make([]string, 0, tobj.Len()*2)
+	for _, k := range tobj.OrderedKeys(p.order) {
+		v, _ := tobj.Get(k)
+		str_list = append(str_list, p.pr_str(k, print_readably), p.pr_str(v, print_readably))
 	}
 	return "{" + strings.Join(str_list, " ") + "}"
 }
+
+// floatToString prints floats in their shortest form, always readable back as a float
+// (1.0 instead of 1)
+func floatToString(f float64) string {
+	str := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.ContainsAny(str, ".eEIN") {
+		return str
+	}
+	return str + ".0"
+}
@@ -0,0 +1,81 @@
+package lisp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jig/lisp/types"
+)
+
+func TestInsertionKeyOrder(t *testing.T) {
+	ctx := types.WithKeyOrder(context.Background(), types.Insertion)
+	for code, expected := range map[string]string{
+		`{:c 1 :a 2 :b 3}`:                     `{:c 1 :a 2 :b 3}`,
+		`(assoc {:c 1 :a 2} :c 10 :b 3)`:       `{:c 10 :a 2 :b 3}`,
+		`(assoc (dissoc {:c 1 :a 2} :c) :c 3)`: `{:a 2 :c 3}`,
+		`(merge {:z 1} {:y 2 :x 3})`:           `{:z 1 :y 2 :x 3}`,
+		`(keys {:c 1 :a 2 :b 3})`:              `(:c :a :b)`,
+		`#{3 1 2}`:                             `#{3 1 2}`,
+		`(json-encode {:b 1 :a 2})`:            `¬{"ʞb":1,"ʞa":2}¬`,
+	} {
+		res, err := REPL(ctx, newEnv(t.Name()), code, types.NewCursorFile(t.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != expected {
+			t.Fatalf("%s: expected %s got %s", code, expected, res)
+		}
+	}
+}
+
+func TestKeyOrderPerContext(t *testing.T) {
+	e := newEnv(t.Name())
+	if _, err := REPL(context.Background(), e, `(def m {:c 1 :a 2 :b 3})`, types.NewCursorFile(t.Name())); err != nil {
+		t.Fatal(err)
+	}
+	insertion := types.WithKeyOrder(context.Background(), types.Insertion)
+	for _, tc := range []struct {
+		ctx      context.Context
+		code     string
+		expected string
+	}{
+		{context.Background(), `m`, `{:a 2 :b 3 :c 1}`},
+		{insertion, `m`, `{:c 1 :a 2 :b 3}`},
+		{context.Background(), `(pr-str m)`, `"{:a 2 :b 3 :c 1}"`},
+		{insertion, `(pr-str m)`, `"{:c 1 :a 2 :b 3}"`},
+		{context.Background(), `(vals m)`, `(2 3 1)`},
+		{insertion, `(vals m)`, `(1 2 3)`},
+		{context.Background(), `(vec #{3 1 2})`, `[1 2 3]`},
+		{insertion, `(seq #{3 1 2})`, `(3 1 2)`},
+		{insertion, `(json-encode [{:b 1 :a 2}])`, `"[{\"ʞb\":1,\"ʞa\":2}]"`},
+	} {
+		res, err := REPL(tc.ctx, e, tc.code, types.NewCursorFile(t.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != tc.expected {
+			t.Fatalf("%s: expected %s got %s", tc.code, tc.expected, res)
+		}
+	}
+}
+
+func TestAddPreambleIsReproducible(t *testing.T) {
+	placeholders := map[string]types.MalType{
+		"$C": types.NewHashMapFromMap(map[string]types.MalType{"ʞz": 1, "ʞy": 2, "ʞx": 3}),
+		"$A": 1,
+		"$B": "b",
+	}
+	first, err := AddPreamble("(list $A $B $C)", placeholders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ";; $A 1\n;; $B \"b\"\n;; $C {:x 3 :y 2 :z 1}\n\n(list $A $B $C)"
+	if first != expected {
+		t.Fatalf("unexpected preamble %q", first)
+	}
+	for i := 0; i < 10; i++ {
+		if code, _ := AddPreamble("(list $A $B $C)", placeholders); code != first {
+			t.Fatalf("preamble changed from %q to %q", first, code)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jig/lisp/lisperror"
+	. "github.com/jig/lisp/types"
+)
+
+// Limits are the resource quotas of an evaluation, that fails with a [lisperror.QuotaError]
+// (wrapped by a LispError) when one is exceeded. Zero limits are unlimited.
+type Limits struct {
+	// MaxSteps is the maximum number of evaluation steps: forms evaluated by EVAL (counting
+	// each tail call), and calls and loop iterations run by a compiled [Program]
+	MaxSteps int64
+	// MaxDepth is the maximum depth of nested evaluations, that bounds the Go stack used by
+	// non tail recursion. Each non tail call is (at least) one level deeper.
+	MaxDepth int
+	// MaxSize is the approximate maximum size of the values produced: elements of the
+	// lists, vectors, hash maps and sets, and bytes of the strings returned by functions
+	MaxSize int
+}
+
+type quotaKey struct{}
+
+// quota is the state of the limits of an evaluation: steps are shared by every
+// evaluation on the context (including futures), and depth is the nesting of ctx
+type quota struct {
+	limits Limits
+	steps  *int64
+	depth  int
+}
+
+// WithLimits returns a context whose evaluations (with [EVAL], [REPL] or [Program.Run]) are
+// limited by limits. Steps are counted from the returned context on, so each evaluation
+// (e.g. each rule run for a customer) usually gets its own context:
+//
+//	ctx := lisp.WithLimits(ctx, lisp.Limits{MaxSteps: 100_000, MaxDepth: 1_000, MaxSize: 10_000})
+//	res, err := lisp.EVAL(ctx, ast, env)
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, quotaKey{}, quota{limits: limits, steps: new(int64)})
+}
+
+func quotaFromContext(ctx context.Context) (quota, bool) {
+	if ctx == nil {
+		return quota{}, false
+	}
+	q, ok := ctx.Value(quotaKey{}).(quota)
+	return q, ok
+}
+
+func quotaError(quota string, limit int64, ast MalType) error {
+	return lisperror.NewLispError(&lisperror.QuotaError{Quota: quota, Limit: limit}, ast)
+}
+
+// enter returns the context of an evaluation nested on ctx, or an error if it exceeds the depth quota
+func enter(ctx context.Context, ast MalType) (context.Context, error) {
+	q, ok := quotaFromContext(ctx)
+	if !ok || q.limits.MaxDepth <= 0 {
+		return ctx, nil
+	}
+	q.depth++
+	if q.depth > q.limits.MaxDepth {
+		return nil, quotaError("depth", int64(q.limits.MaxDepth), ast)
+	}
+	return context.WithValue(ctx, quotaKey{}, q), nil
+}
+
+// step counts an evaluation step of ast, returning an error if it exceeds the steps quota
+func step(ctx context.Context, ast MalType) error {
+	q, ok := quotaFromContext(ctx)
+	if !ok || q.limits.MaxSteps <= 0 {
+		return nil
+	}
+	if atomic.AddInt64(q.steps, 1) > q.limits.MaxSteps {
+		return quotaError("steps", q.limits.MaxSteps, ast)
+	}
+	return nil
+}
+
+// checkSize returns an error if value, produced by ast, exceeds the size quota
+func checkSize(ctx context.Context, value, ast MalType) error {
+	q, ok := quotaFromContext(ctx)
+	if !ok || q.limits.MaxSize <= 0 {
+		return nil
+	}
+	var size int
+	switch value := value.(type) {
+	case string:
+		size = len(value)
+	case List:
+		size = len(value.Val)
+	case Vector:
+		size = value.Len()
+	case HashMap:
+		size = value.Len()
+	case Set:
+		size = value.Len()
+	}
+	if size > q.limits.MaxSize {
+		return quotaError("size", int64(q.limits.MaxSize), ast)
+	}
+	return nil
+}
+
+// uncatchable returns true if e can't be caught by try, as quotas must hold
+func uncatchable(e error) bool {
+	var quotaErr *lisperror.QuotaError
+	return errors.As(e, &quotaErr)
+}
@@ -0,0 +1,73 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/types"
+)
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxSteps: 100_000, MaxDepth: 500, MaxSize: 1_000}
+	for _, tc := range []struct {
+		code  string
+		quota string
+	}{
+		{`(loop [] (recur))`, "steps"},
+		{`(do (defn spin [] (spin)) (spin))`, "steps"},
+		{`(try (loop [] (recur)) (catch e :caught))`, "steps"},
+		{`(do (defn deep [n] (+ 1 (deep (+ n 1)))) (deep 0))`, "depth"},
+		{`(do (defn deep-map [x] (map deep-map [x])) (deep-map 0))`, "depth"},
+		{`(try (do (defn deep [n] (+ 1 (deep n))) (deep 0)) (catch e :caught))`, "depth"},
+		{`(loop [s "x"] (recur (str s s)))`, "size"},
+		{`(loop [v []] (recur (conj v 1)))`, "size"},
+	} {
+		t.Run(tc.code, func(t *testing.T) {
+			ctx := WithLimits(context.Background(), limits)
+			_, interpretedErr := REPL(ctx, newEnv(t.Name()), tc.code, types.NewCursorFile(t.Name()))
+
+			env := newEnv(t.Name())
+			ctx = WithLimits(context.Background(), limits)
+			_, compiledErr := compileString(t, env, tc.code).Run(ctx, nil)
+
+			for _, err := range []error{interpretedErr, compiledErr} {
+				var quotaErr *lisperror.QuotaError
+				if !errors.As(err, &quotaErr) {
+					t.Fatalf("expected a quota error got %v", err)
+				}
+				if quotaErr.Quota != tc.quota {
+					t.Fatalf("expected the %s quota got %s", tc.quota, quotaErr)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitsSharedByFutures(t *testing.T) {
+	env := newEnv(t.Name())
+	if _, err := REPL(context.Background(), env, `(def count-to (fn [n] (loop [i 0] (if (< i n) (recur (+ i 1)) i))))`, types.NewCursorFile(t.Name())); err != nil {
+		t.Fatal(err)
+	}
+	limits := Limits{MaxSteps: 15_000}
+	if _, err := REPL(WithLimits(context.Background(), limits), env, `@(future (count-to 1000))`, types.NewCursorFile(t.Name())); err != nil {
+		t.Fatal(err)
+	}
+	_, err := REPL(WithLimits(context.Background(), limits), env, `(+ @(future (count-to 1000)) @(future (count-to 1000)))`, types.NewCursorFile(t.Name()))
+	var quotaErr *lisperror.QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("expected a quota error got %v", err)
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	ctx := WithLimits(context.Background(), Limits{MaxSteps: 100_000, MaxDepth: 100, MaxSize: 100})
+	res, err := REPL(ctx, newEnv(t.Name()), `(do (defn fact [n] (if (< n 2) 1 (* n (fact (- n 1))))) (fact 20))`, types.NewCursorFile(t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "2432902008176640000" {
+		t.Fatalf("expected 2432902008176640000 got %s", res)
+	}
+}
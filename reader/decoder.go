@@ -0,0 +1,111 @@
+package reader
+
+import (
+	"io"
+
+	"github.com/jig/scanner"
+
+	. "github.com/jig/lisp/types"
+)
+
+// Decoder reads the successive top level forms of a source, scanning it as they are read,
+// so the whole source is never held in memory:
+//
+//	dec := reader.NewDecoder(file, types.NewCursorFile(fileName))
+//	for {
+//		ast, err := dec.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+type Decoder struct {
+	src    *sourceReader
+	tokens tokenStream
+	ns     EnvType
+}
+
+// NewDecoder returns a decoder of the forms of src. Positions start at the row of cursor (they
+// are not reset on each form), that might be nil as in [Read_str].
+//
+// EnvType is required in case you expect to parse Go constructors
+func NewDecoder(src io.Reader, cursor *Position, ns ...EnvType) *Decoder {
+	if cursor == nil {
+		cursor = NewAnonymousCursorHere(1, 1)
+	}
+	d := &Decoder{
+		src: &sourceReader{r: src},
+	}
+	s := newScanner(d.src, cursor)
+	// errors are returned by Next instead of printed
+	s.Error = func(*scanner.Scanner, string) {}
+	d.tokens = tokenStream{
+		s:         s,
+		module:    cursor.Module,
+		rowOffset: cursor.BeginRow - 1,
+	}
+	if len(ns) != 0 {
+		d.ns = ns[0]
+	}
+	return d
+}
+
+// Next returns the next form of the source, or io.EOF if there are no more forms
+func (d *Decoder) Next() (MalType, error) {
+	if d.tokens.peek() == nil {
+		return nil, d.err(io.EOF)
+	}
+	ast, err := read_form(&d.tokens, nil, d.ns)
+	if err != nil {
+		// a form ending abruptly is not the cause of a scanning or I/O error
+		return nil, d.err(err)
+	}
+	return ast, nil
+}
+
+// err returns the I/O or scanning error found, if any, instead of err
+func (d *Decoder) err(err error) error {
+	if d.src.err != nil {
+		return d.src.err
+	}
+	if d.tokens.err != nil {
+		return d.tokens.err
+	}
+	return err
+}
+
+// tokenStream is the Reader of the tokens of a Decoder: they are scanned when peeked
+type tokenStream struct {
+	s         *scanner.Scanner
+	module    *string
+	rowOffset int
+	peeked    *Token
+	err       error
+}
+
+func (ts *tokenStream) next() *Token {
+	token := ts.peek()
+	ts.peeked = nil
+	return token
+}
+
+func (ts *tokenStream) peek() *Token {
+	if ts.peeked == nil && ts.err == nil {
+		ts.peeked, ts.err = scanToken(ts.s, ts.module, ts.rowOffset)
+	}
+	return ts.peeked
+}
+
+// sourceReader keeps the read error of r, as the scanner handles it as the end of the source
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (sr *sourceReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	if err != nil && err != io.EOF {
+		sr.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,124 @@
+package reader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/jig/lisp/types"
+)
+
+// unescapes are the characters of the short escape sequences of strings
+var unescapes = map[byte]byte{
+	'\\': '\\',
+	'"':  '"',
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'b':  '\b',
+	'f':  '\f',
+	'a':  '\a',
+	'v':  '\v',
+}
+
+// unescape decodes the escape sequences of str, the contents of a string literal:
+// \\, \", \n, \t, \r, \b, \f, \a and \v, \ooo and \xhh bytes, and \uhhhh and \Uhhhhhhhh
+// code points. On an invalid escape sequence it returns the byte offset where it starts.
+func unescape(str string) (string, int, error) {
+	if strings.IndexByte(str, '\\') < 0 {
+		return str, 0, nil
+	}
+	var sb strings.Builder
+	sb.Grow(len(str))
+	for i := 0; i < len(str); {
+		if str[i] != '\\' {
+			sb.WriteByte(str[i])
+			i++
+			continue
+		}
+		n, err := unescapeOne(&sb, str[i:])
+		if err != nil {
+			return "", i, err
+		}
+		i += n
+	}
+	return sb.String(), 0, nil
+}
+
+// unescapeOne writes the character of the escape sequence at the start of str, and returns
+// the length of the sequence
+func unescapeOne(sb *strings.Builder, str string) (int, error) {
+	if len(str) < 2 {
+		return 0, fmt.Errorf("invalid escape %s", str)
+	}
+	if c, ok := unescapes[str[1]]; ok {
+		sb.WriteByte(c)
+		return 2, nil
+	}
+	var digits, base int
+	switch c := str[1]; {
+	case c >= '0' && c <= '7':
+		digits, base = 3, 8
+	case c == 'x':
+		digits, base = 2, 16
+	case c == 'u':
+		digits, base = 4, 16
+	case c == 'U':
+		digits, base = 8, 16
+	default:
+		_, size := utf8.DecodeRuneInString(str[1:])
+		return 0, fmt.Errorf("invalid escape %s", str[:1+size])
+	}
+	start := 2
+	if base == 8 {
+		start = 1
+	}
+	if len(str) < start+digits {
+		return 0, fmt.Errorf("invalid escape %s", str)
+	}
+	code, err := strconv.ParseUint(str[start:start+digits], base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid escape %s", str[:start+digits])
+	}
+	switch {
+	case base == 8 && code > 255:
+		return 0, fmt.Errorf("invalid escape %s", str[:start+digits])
+	case str[1] == 'u' || str[1] == 'U':
+		if !utf8.ValidRune(rune(code)) {
+			return 0, fmt.Errorf("invalid escape %s", str[:start+digits])
+		}
+		sb.WriteRune(rune(code))
+	default:
+		// \ooo and \xhh are bytes
+		sb.WriteByte(byte(code))
+	}
+	return start + digits, nil
+}
+
+// readChar converts the text of a character literal (\a, \newline, é) to its character
+func readChar(literal string) (Char, error) {
+	name := strings.TrimPrefix(literal, `\`)
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) && r != utf8.RuneError {
+		return Char(r), nil
+	}
+	if c, ok := CharNamed(name); ok {
+		return c, nil
+	}
+	if hex := strings.TrimPrefix(name, "u"); len(hex) != len(name) && len(hex) >= 4 && len(hex) <= 6 {
+		if code, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(code)) {
+			return Char(code), nil
+		}
+	}
+	if name == "" {
+		return 0, fmt.Errorf("invalid character literal %s: a character is expected after the backslash", literal)
+	}
+	return 0, fmt.Errorf("invalid character literal %s", literal)
+}
+
+// isCharNameRune returns whether ch continues the name of a character literal started with a
+// letter (\newline, é)
+func isCharNameRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
@@ -5,9 +5,13 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/jig/scanner"
 
@@ -41,63 +45,168 @@ func (tr *tokenReader) peek() *Token {
 	return &tr.tokens[tr.position]
 }
 
-func tokenize(sourceCode string, cursor *Position) ([]Token, error) {
+// tokenize splits sourceCode in tokens. rowOffset is added to the row of each token.
+func tokenize(sourceCode string, cursor *Position, rowOffset int) ([]Token, error) {
 	result := make([]Token, 0, 1)
 
+	s := newScanner(strings.NewReader(sourceCode), cursor)
+	for {
+		token, err := scanToken(s, cursor.Module, rowOffset)
+		if err != nil {
+			return nil, err
+		}
+		if token == nil {
+			return result, nil
+		}
+		result = append(result, *token)
+	}
+}
+
+func newScanner(src io.Reader, cursor *Position) *scanner.Scanner {
 	var s scanner.Scanner
-	s.Init(strings.NewReader(sourceCode))
+	s.Init(src)
+	s.IsIdentRune = isIdentRune
 	if cursor.Module != nil {
 		s.Filename = *cursor.Module
 	}
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		// fmt.Printf("%s: (%s) %s\n", s.Position, scanner.TokenString(tok), s.TokenText())
-		if s.ErrorCount != 0 {
-			return nil, lisperror.NewLispError(fmt.Errorf("invalid token %s", s.TokenText()), &Position{
-				Module:   cursor.Module,
-				BeginRow: s.Pos().Line,
-				BeginCol: s.Pos().Column - 1,
-				Row:      s.Pos().Line,
-				Col:      s.Pos().Column - 1,
-			})
+	return &s
+}
+
+// scanToken returns the next token of s, or nil at the end of its source
+func scanToken(s *scanner.Scanner, module *string, rowOffset int) (*Token, error) {
+	tok := s.Scan()
+	if tok == scanner.EOF {
+		return nil, nil
+	}
+	// fmt.Printf("%s: (%s) %s\n", s.Position, scanner.TokenString(tok), s.TokenText())
+	if s.ErrorCount != 0 {
+		if text := s.TokenText(); tok == scanner.String && len(text) >= 2 && strings.HasSuffix(text, `"`) {
+			if _, offset, err := unescape(text[1 : len(text)-1]); err != nil {
+				return nil, escapeError(err, module, s.Position.Line+rowOffset, s.Position.Column, text[1:len(text)-1], offset)
+			}
 		}
-		tokenString := s.TokenText()
-		result = append(result, Token{
-			Value: tokenString,
-			Type:  tok,
-			Cursor: Position{
-				Module:   cursor.Module,
-				BeginRow: s.Pos().Line,
-				BeginCol: s.Pos().Column,
-				Row:      s.Pos().Line,
-				Col:      s.Pos().Column + s.Pos().Offset,
-			},
+		return nil, lisperror.NewLispError(fmt.Errorf("invalid token %s", s.TokenText()), &Position{
+			Module:   module,
+			BeginRow: s.Pos().Line + rowOffset,
+			BeginCol: s.Pos().Column - 1,
+			Row:      s.Pos().Line + rowOffset,
+			Col:      s.Pos().Column - 1,
 		})
 	}
-	return result, nil
+	tokenString := s.TokenText()
+	// s.Next resets s.Position
+	begin := s.Position
+	if tok == scanner.Int || tok == scanner.Float {
+		// arbitrary precision suffixes: N (BigInt) and M (Decimal)
+		if suffix := s.Peek(); suffix == 'N' || suffix == 'M' {
+			s.Next()
+			tokenString += string(suffix)
+		}
+	}
+	if tok == '\\' {
+		// character literal: the backslash, a character, and the rest of its name if it is a
+		// letter (\newline, \u00e9)
+		if ch := s.Peek(); ch != scanner.EOF && !unicode.IsSpace(ch) {
+			s.Next()
+			tokenString += string(ch)
+			if unicode.IsLetter(ch) {
+				for isCharNameRune(s.Peek()) {
+					tokenString += string(s.Next())
+				}
+			}
+		}
+	}
+	return &Token{
+		Value: tokenString,
+		Type:  tok,
+		// from the first to the last character of the token
+		Cursor: Position{
+			Module:   module,
+			BeginRow: begin.Line + rowOffset,
+			BeginCol: begin.Column,
+			Row:      s.Pos().Line + rowOffset,
+			Col:      s.Pos().Column - 1,
+		},
+	}, nil
+}
+
+// isIdentRune accepts the scanner default identifier characters, and dots after the first
+// character as in namespace names (e.g. lib.x/fn)
+func isIdentRune(ch rune, i int) bool {
+	switch {
+	case strings.ContainsRune("_$*+/?!<>=", ch), unicode.IsLetter(ch):
+		return true
+	case ch == '-', ch == '.', unicode.IsDigit(ch):
+		return i > 0
+	default:
+		return false
+	}
 }
 
-func read_atom(rdr *tokenReader) (MalType, error) {
+// escapeError returns err, of the escape sequence at offset of the contents of the string
+// literal starting at row and col, with the position of the escape sequence
+func escapeError(err error, module *string, row, col int, contents string, offset int) error {
+	col += 1 + utf8.RuneCountInString(contents[:offset])
+	return lisperror.NewLispError(err, &Position{
+		Module:   module,
+		BeginRow: row,
+		BeginCol: col,
+		Row:      row,
+		Col:      col,
+	})
+}
+
+func read_atom(rdr Reader) (MalType, error) {
 	tokenStruct := rdr.next()
 	if tokenStruct == nil {
 		return nil, lisperror.NewLispError(errors.New("read_atom underflow"), tokenStruct.GetPosition())
 	}
 	token := &tokenStruct.Value
 	switch tokenStruct.Type {
-	case scanner.Int:
+	case scanner.Int, scanner.Float:
+		switch (*token)[len(*token)-1] {
+		case 'N':
+			i, ok := new(big.Int).SetString((*token)[:len(*token)-1], 0)
+			if !ok {
+				return nil, lisperror.NewLispError(errors.New("bigint parse error"), tokenStruct.GetPosition())
+			}
+			return BigInt{Val: i}, nil
+		case 'M':
+			r, ok := new(big.Rat).SetString(strings.Replace((*token)[:len(*token)-1], "_", "", -1))
+			if !ok {
+				return nil, lisperror.NewLispError(errors.New("decimal parse error"), tokenStruct.GetPosition())
+			}
+			return Decimal{Val: r}, nil
+		}
+		if tokenStruct.Type == scanner.Float {
+			f, err := strconv.ParseFloat(*token, 64)
+			if err != nil {
+				return nil, lisperror.NewLispError(errors.New("float parse error"), tokenStruct.GetPosition())
+			}
+			return f, nil
+		}
 		i, err := strconv.ParseInt(*token, 0, 0)
 		if err != nil {
+			// integer literals out of the int range are read as BigInt
+			if b, ok := new(big.Int).SetString(*token, 0); ok {
+				return BigInt{Val: b}, nil
+			}
 			return nil, lisperror.NewLispError(errors.New("integer parse error"), tokenStruct.GetPosition())
 		}
 		return int(i), nil
 	case scanner.String:
-		str := (*token)[1 : len(*token)-1]
-		return strings.Replace(
-			strings.Replace(
-				strings.Replace(
-					strings.Replace(str, `\\`, "\u029e", -1),
-					`\"`, `"`, -1),
-				`\n`, "\n", -1),
-			"\u029e", "\\", -1), nil
+		contents := (*token)[1 : len(*token)-1]
+		str, offset, err := unescape(contents)
+		if err != nil {
+			return nil, escapeError(err, tokenStruct.Cursor.Module, tokenStruct.Cursor.BeginRow, tokenStruct.Cursor.BeginCol, contents, offset)
+		}
+		return str, nil
+	case '\\':
+		c, err := readChar(*token)
+		if err != nil {
+			return nil, lisperror.NewLispError(err, tokenStruct.GetPosition())
+		}
+		return c, nil
 	case scanner.RawString:
 		if *token == "¬" {
 			return nil, lisperror.NewLispError(errors.New("expected '¬', got EOF"), tokenStruct.GetPosition())
@@ -106,12 +215,6 @@ func read_atom(rdr *tokenReader) (MalType, error) {
 		return strings.Replace(str, `¬¬`, `¬`, -1), nil
 	case scanner.Keyword:
 		return NewKeyword((*token)[1:len(*token)]), nil
-	case scanner.Float:
-		f, err := strconv.ParseFloat(*token, 32)
-		if err != nil {
-			return nil, lisperror.NewLispError(errors.New("float parse error"), tokenStruct.GetPosition())
-		}
-		return float32(f), nil
 	case scanner.Ident:
 		switch *token {
 		case "nil":
@@ -130,15 +233,15 @@ func read_atom(rdr *tokenReader) (MalType, error) {
 	}
 }
 
-func read_list(rdr *tokenReader, start string, end string, placeholderValues *HashMap, ns EnvType) (MalType, error) {
+func read_list(rdr Reader, start string, end string, placeholderValues *HashMap, ns EnvType) (MalType, error) {
 	tokenStruct := rdr.next()
 	if tokenStruct == nil {
-		return nil, lisperror.NewLispError(errors.New("read_list underflow"), &tokenStruct)
+		return nil, lisperror.NewLispError(errors.New("read_list underflow"), nil)
 	}
 	cursor := tokenStruct.Cursor.Copy()
 	token := &tokenStruct.Value
 	if *token != start {
-		return nil, lisperror.NewLispError(errors.New("expected '"+start+"'"), &tokenStruct)
+		return nil, lisperror.NewLispError(errors.New("expected '"+start+"'"), &tokenStruct.Cursor)
 	}
 	lastKnown := tokenStruct
 
@@ -163,7 +266,7 @@ func read_list(rdr *tokenReader, start string, end string, placeholderValues *Ha
 	return List{Val: ast_list, Cursor: cursor.Close(&tokenStruct.Cursor)}, nil
 }
 
-func read_external(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
+func read_external(rdr Reader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
 	lst, e := read_list(rdr, "«", "»", placeholderValues, ns)
 	if e != nil {
 		return nil, e
@@ -187,16 +290,17 @@ func read_external(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (Ma
 	return typedValue, nil
 }
 
-func read_vector(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
+func read_vector(rdr Reader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
 	lst, e := read_list(rdr, "[", "]", placeholderValues, ns)
 	if e != nil {
 		return nil, e
 	}
-	vec := Vector{Val: lst.(List).Val, Cursor: lst.(List).Cursor}
+	vec := NewVector(lst.(List).Val...)
+	vec.Cursor = lst.(List).Cursor
 	return vec, nil
 }
 
-func read_hash_map(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
+func read_hash_map(rdr Reader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
 	mal_lst, e := read_list(rdr, "{", "}", placeholderValues, ns)
 	if e != nil {
 		return nil, e
@@ -204,7 +308,7 @@ func read_hash_map(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (Ma
 	return NewHashMap(mal_lst)
 }
 
-func read_set(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
+func read_set(rdr Reader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
 	mal_lst, e := read_list(rdr, "#{", "}", placeholderValues, ns)
 	if e != nil {
 		return nil, e
@@ -212,18 +316,23 @@ func read_set(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalType
 	return NewSet(mal_lst)
 }
 
-func read_placeholder(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
+func read_placeholder(rdr Reader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
 	tokenStruct := rdr.next()
 	if tokenStruct == nil {
-		return nil, lisperror.NewLispError(errors.New("read_placeholder underflow"), &tokenStruct)
+		return nil, lisperror.NewLispError(errors.New("read_placeholder underflow"), nil)
+	}
+	if placeholderValues == nil {
+		// code read without a preamble
+		return nil, nil
 	}
-	return placeholderValues.Val[tokenStruct.Value], nil
+	value, _ := placeholderValues.Get(tokenStruct.Value)
+	return value, nil
 }
 
-func read_form(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
+func read_form(rdr Reader, placeholderValues *HashMap, ns EnvType) (MalType, error) {
 	tokenStruct := rdr.peek()
 	if tokenStruct == nil {
-		return nil, lisperror.NewLispError(errors.New("read_form underflow"), &tokenStruct)
+		return nil, lisperror.NewLispError(errors.New("read_form underflow"), nil)
 	}
 	cursor := tokenStruct.Cursor.Copy()
 	switch tokenStruct.Value {
@@ -303,8 +412,9 @@ func read_form(rdr *tokenReader, placeholderValues *HashMap, ns EnvType) (MalTyp
 	}
 }
 
-// ";; $MODULE ../../examples/fibonacci.lisp\n(do (do\n    (def fib\n
-var moduleNamePrefixRE = regexp.MustCompile(`^;; [$]MODULE (.+)`)
+// ";; $MODULE ../../examples/fibonacci.lisp\n(do\n(do\n    (def fib\n
+// a module source code might be wrapped on a do form starting on its own line
+var moduleNamePrefixRE = regexp.MustCompile(`^;; [$]MODULE (.+)\n(?:\(do\n)?`)
 
 // Read_str reads Lisp source code and generates
 // cursor and environment might be passed nil and READ will provide correct values for you.
@@ -316,13 +426,20 @@ func Read_str(str string, cursor *Position, placeholderValues *HashMap, ns ...En
 	if cursor == nil {
 		cursor = NewAnonymousCursorHere(1, 1)
 	}
+	rowOffset := 0
 	if cursor.Module == nil {
 		matches := moduleNamePrefixRE.FindStringSubmatch(str)
 		if matches != nil {
 			cursor = NewCursorFile(matches[1])
+			// the module preamble is not part of the module source code
+			rowOffset = -strings.Count(matches[0], "\n")
+			lisperror.RegisterSource(matches[1], str[len(matches[0]):])
 		}
+	} else if cursor.BeginRow == 1 {
+		// module read from its beginning (see NewCursorFile)
+		lisperror.RegisterSource(*cursor.Module, str)
 	}
-	tokens, err := tokenize(str, cursor)
+	tokens, err := tokenize(str, cursor, rowOffset)
 	if err != nil {
 		return nil, err
 	}
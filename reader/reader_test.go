@@ -1,12 +1,17 @@
 package reader_test
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/jig/lisp/env"
 	"github.com/jig/lisp/lib/call"
 	"github.com/jig/lisp/lib/core/nscore"
 	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/printer"
 	"github.com/jig/lisp/reader"
 	"github.com/jig/lisp/types"
 )
@@ -125,3 +130,138 @@ func TestAdHocReaders(t *testing.T) {
 		}
 	})
 }
+
+func TestTokenPositionsAndSources(t *testing.T) {
+	ast, err := reader.Read_str("(+ 1\n   abc)", types.NewCursorFile("positions.lisp"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := ast.(types.List).Val[2].(types.Symbol).Cursor; pos.BeginRow != 2 || pos.BeginCol != 4 || pos.Row != 2 || pos.Col != 6 {
+		t.Fatalf("unexpected symbol position %s", pos)
+	}
+	if pos := ast.(types.List).Cursor; pos.BeginRow != 1 || pos.BeginCol != 1 || pos.Row != 2 || pos.Col != 7 {
+		t.Fatalf("unexpected list position %s", pos)
+	}
+	if lines, ok := lisperror.Source("positions.lisp"); !ok || len(lines) != 2 || lines[1] != "   abc)" {
+		t.Fatalf("unexpected source %q", lines)
+	}
+
+	// module preamble
+	ast, err = reader.Read_str(";; $MODULE module.lisp\n(do\nabc\nnil)", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := ast.(types.List).Val[1].(types.Symbol).Cursor; *pos.Module != "module.lisp" || pos.BeginRow != 1 || pos.BeginCol != 1 {
+		t.Fatalf("unexpected symbol position %s", pos)
+	}
+	if lines, ok := lisperror.Source("module.lisp"); !ok || lines[0] != "abc" {
+		t.Fatalf("unexpected source %q", lines)
+	}
+}
+
+func TestQualifiedSymbols(t *testing.T) {
+	ast, err := reader.Read_str(`(lib.x/join my.app/f / .5 -1.5 a.b)`, types.NewCursorFile(t.Name()), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.MalType{
+		types.Symbol{Val: "lib.x/join"},
+		types.Symbol{Val: "my.app/f"},
+		types.Symbol{Val: "/"},
+		0.5,
+		-1.5,
+		types.Symbol{Val: "a.b"},
+	}
+	if len(ast.(types.List).Val) != len(expected) {
+		t.Fatalf("expected %d forms got %d", len(expected), len(ast.(types.List).Val))
+	}
+	for i, elem := range ast.(types.List).Val {
+		if sym, ok := elem.(types.Symbol); ok {
+			elem = types.Symbol{Val: sym.Val}
+		}
+		if elem != expected[i] {
+			t.Fatalf("%d: expected %v got %v", i, expected[i], elem)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	source := "(def a 1) :k\n\n; comment\n[a\n  b]\n"
+	// a reader returning a byte on each call checks the forms are read lazily
+	dec := reader.NewDecoder(iotest.OneByteReader(strings.NewReader(source)), types.NewCursorFile(t.Name()))
+	forms := []types.MalType{}
+	for {
+		ast, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		forms = append(forms, ast)
+	}
+	if printed := printer.Pr_list(forms, true, "", "", " "); printed != "(def a 1) :k [a b]" {
+		t.Fatalf("unexpected forms %s", printed)
+	}
+	// positions are kept across forms
+	if pos := forms[2].(types.Vector).Nth(1).(types.Symbol).Cursor; *pos.Module != t.Name() || pos.BeginRow != 5 || pos.BeginCol != 3 {
+		t.Fatalf("unexpected symbol position %s", pos)
+	}
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("expected EOF got %v", err)
+	}
+
+	// a failing form doesn't hide the previous ones
+	dec = reader.NewDecoder(strings.NewReader("(+ 1 2)\n  )"), types.NewCursorFile(t.Name()))
+	if ast, err := dec.Next(); err != nil || printer.Pr_str(ast, true) != "(+ 1 2)" {
+		t.Fatalf("unexpected form %v (%v)", ast, err)
+	}
+	var lerr lisperror.LispError
+	if _, err := dec.Next(); !errors.As(err, &lerr) || lerr.Position().BeginRow != 2 {
+		t.Fatalf("expected an error on row 2 got %v", err)
+	}
+
+	// read errors are not hidden by the end of the source
+	dec = reader.NewDecoder(io.MultiReader(strings.NewReader("1 (+ 2"), iotest.ErrReader(iotest.ErrTimeout)), nil)
+	if ast, err := dec.Next(); err != nil || ast != 1 {
+		t.Fatalf("unexpected form %v (%v)", ast, err)
+	}
+	if _, err := dec.Next(); err != iotest.ErrTimeout {
+		t.Fatalf("expected a timeout got %v", err)
+	}
+}
+
+func TestEscapesAndCharacters(t *testing.T) {
+	ast, err := reader.Read_str(`["a\tbé\x41\101\U0001F600" \a \newline \é \( \\]`, types.NewCursorFile(t.Name()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.MalType{"a\tbéAA😀", types.Char('a'), types.Char('\n'), types.Char('é'), types.Char('('), types.Char('\\')}
+	elems := ast.(types.Vector).Slice()
+	if len(elems) != len(expected) {
+		t.Fatalf("expected %d forms got %d", len(expected), len(elems))
+	}
+	for i, elem := range elems {
+		if elem != expected[i] {
+			t.Fatalf("%d: expected %#v got %#v", i, expected[i], elem)
+		}
+	}
+
+	for code, col := range map[string]int{
+		`(str "abc" "d\qe")`: 14,
+		`"é\u12"`:            3,
+		`"\uD800"`:           2,
+		"(do\n  \\ab)":       3,
+		`[\a \unknown]`:      5,
+		`(list \`:            7,
+	} {
+		_, err := reader.Read_str(code, types.NewCursorFile(t.Name()), nil)
+		var lispErr lisperror.LispError
+		if !errors.As(err, &lispErr) {
+			t.Fatalf("%s: expected a lisp error got %v", code, err)
+		}
+		if pos := lispErr.Position(); pos == nil || pos.BeginCol != col {
+			t.Fatalf("%s: expected an error at column %d got %v", code, col, err)
+		}
+	}
+}
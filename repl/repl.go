@@ -11,7 +11,10 @@ import (
 
 	goreadline "github.com/chzyer/readline"
 	"github.com/jig/lisp"
+	"github.com/jig/lisp/env"
 	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/printer"
+	"github.com/jig/lisp/reader"
 	"github.com/jig/lisp/types"
 )
 
@@ -37,6 +40,8 @@ func Execute(ctx context.Context, repl_env types.EnvType) error {
 	defer l.Close()
 
 	log.SetOutput(l.Stderr())
+	// in-ns is kept for the next lines of the session
+	ctx = env.WithNamespace(ctx)
 	var lines []string
 	for {
 		line, err := l.Readline()
@@ -51,30 +56,60 @@ func Execute(ctx context.Context, repl_env types.EnvType) error {
 		lines = append(lines, line)
 		completeLine := strings.Join(lines, "\n")
 
-		out, err := lisp.REPL(ctx, repl_env, completeLine, types.NewCursorFile("REPL"))
+		forms, err := read(completeLine, repl_env)
 		if err != nil {
-			if err.Error() == "<empty line>" {
-				continue
-			}
 			if multiLine(err) {
 				l.SetPrompt("\033[31m›\033[0m ")
 				continue
 			}
 			lines = []string{}
 			l.SetPrompt("\033[32m»\033[0m ")
-			switch err := err.(type) {
-			case interface{ ErrorValue() types.MalType }:
-				fmt.Printf("\033[31mLisp Error:\033[0m %s\n", lisp.PRINT(err.ErrorValue()))
-				continue
-			default:
-				fmt.Printf("Error: %s\n", err)
-				continue
-			}
+			printError(err)
+			continue
+		}
+		if len(forms) == 0 {
+			// empty line
+			continue
 		}
 		lines = []string{}
 		l.SetPrompt("\033[32m»\033[0m ")
-		fmt.Printf("%v\n", out)
+		// each form is evaluated and printed on its own
+		for _, ast := range forms {
+			out, err := lisp.EVAL(ctx, ast, repl_env)
+			if err != nil {
+				printError(err)
+				break
+			}
+			fmt.Printf("%v\n", printer.Print(out, true, types.KeyOrderFromContext(ctx)))
+		}
+	}
+}
+
+// read reads all the forms of source, so an incomplete form is found before evaluating any
+// of them
+func read(source string, repl_env types.EnvType) ([]types.MalType, error) {
+	dec := reader.NewDecoder(strings.NewReader(source), types.NewCursorFile("REPL"), repl_env)
+	forms := []types.MalType{}
+	for {
+		ast, err := dec.Next()
+		if err == io.EOF {
+			return forms, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, ast)
+	}
+}
+
+func printError(err error) {
+	switch err := err.(type) {
+	case interface{ ErrorValue() types.MalType }:
+		fmt.Printf("\033[31mLisp Error:\033[0m %s\n", lisp.PRINT(err.ErrorValue()))
+	default:
+		fmt.Printf("Error: %s\n", err)
 	}
+	fmt.Print(lisperror.Details(err, true))
 }
 
 func multiLine(err error) bool {
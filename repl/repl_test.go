@@ -32,3 +32,20 @@ func TestMultilineFail(t *testing.T) {
 		}
 	}
 }
+
+func TestReadForms(t *testing.T) {
+	forms, err := read("(def a 1) (+ a 1)\n:k", env.NewEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forms) != 3 {
+		t.Fatalf("expected 3 forms got %d", len(forms))
+	}
+	// no form is evaluated until the last one is complete
+	if _, err := read("(def a 1) (+ a", env.NewEnv()); err == nil || !multiLine(err) {
+		t.Fatalf("expected a multiline error got %v", err)
+	}
+	if forms, err := read("  ; comment", env.NewEnv()); err != nil || len(forms) != 0 {
+		t.Fatalf("unexpected forms %v (%v)", forms, err)
+	}
+}
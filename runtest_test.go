@@ -55,6 +55,8 @@ func parseFile(ctx context.Context, fileName string, code string) error {
 	lines := strings.Split(string(code), "\n")
 	currentLine := 0
 
+	// lines are evaluated as a REPL session
+	ctx = env.WithNamespace(ctx)
 	env := newEnv(fileName)
 	var result types.MalType
 	var stdoutResult string
@@ -112,6 +114,10 @@ func newEnv(fileName string) types.EnvType {
 	core.LoadInput(newenv)
 	concurrent.Load(newenv)
 	system.Load(newenv)
+	env.RegisterLibrary(newenv, "system", func(ns types.EnvType) error {
+		system.Load(ns)
+		return nil
+	})
 	newenv.Set(types.Symbol{Val: "eval"}, types.Func{Fn: func(ctx context.Context, a []types.MalType) (types.MalType, error) {
 		return EVAL(ctx, a[0], newenv)
 	}})
@@ -137,6 +143,9 @@ func newEnv(fileName string) types.EnvType {
 	if _, err := REPL(ctx, newenv, "(defmacro cond (fn (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw \"odd number of forms to cond\")) (cons 'cond (rest (rest xs)))))))", types.NewCursorFile(fileName)); err != nil {
 		return nil
 	}
+	if _, err := REPL(ctx, newenv, core.HeaderBasic(), types.NewCursorFile(fileName)); err != nil {
+		return nil
+	}
 	return newenv
 }
 
@@ -0,0 +1,156 @@
+// Package sandbox loads the standard libraries restricted to a capability profile, to
+// evaluate scripts received from untrusted sources:
+//
+//	ns := env.NewEnv()
+//	profile := sandbox.Profile{FS: sandbox.ReadOnly("/etc/app"), MaxSleep: time.Second}
+//	if err := profile.Load(ns); err != nil {
+//		...
+//	}
+//	result, err := sandbox.REPL(ctx, ns, script, types.NewCursorFile("script"))
+//
+// Functions of capabilities the profile forbids either are not registered (e.g. setenv)
+// or fail with a [*PermissionError] (e.g. slurp or panic). The zero Profile forbids every capability.
+// Scripts are evaluated by [EVAL] and [REPL], that return the Go panics of the evaluation as errors.
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/jig/lisp"
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/call"
+	"github.com/jig/lisp/lib/concurrent/nsconcurrent"
+	"github.com/jig/lisp/lib/core"
+	"github.com/jig/lisp/lib/core/nscore"
+	"github.com/jig/lisp/lib/coreextented/nscoreextended"
+	"github.com/jig/lisp/lib/system/nssystem"
+	"github.com/jig/lisp/lisperror"
+	. "github.com/jig/lisp/types"
+)
+
+// Profile is the set of capabilities of the scripts evaluated on an environment
+type Profile struct {
+	// FS is the file system slurp and load-file read from, none if nil (see [ReadOnly])
+	FS fs.FS
+	// Env allows reading and modifying the process environment with the system library
+	Env bool
+	// Panic allows panic, that panics the evaluation instead of throwing an error ([EVAL] and
+	// [REPL] still return it as an error)
+	Panic bool
+	// Stdin allows read-line to read the standard input of the host (or the In reader
+	// of the context, see core.WithIO)
+	Stdin bool
+	// MaxSleep is the longest sleep allowed, no sleep is allowed if zero
+	MaxSleep time.Duration
+}
+
+// PermissionError is the error of the functions whose capability is forbidden by the profile
+type PermissionError struct {
+	Function   string
+	Capability string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s: permission denied (the sandbox profile forbids %s)", e.Function, e.Capability)
+}
+
+// Unwrap returns fs.ErrPermission, so errors.Is(err, fs.ErrPermission) is true
+func (e *PermissionError) Unwrap() error {
+	return fs.ErrPermission
+}
+
+func (e *PermissionError) Type() string {
+	return "permission-error"
+}
+
+// Load loads the core, input, concurrent and extended core libraries on e, and the system
+// library if the profile allows Env, restricted to the capabilities of the profile
+func (p Profile) Load(e EnvType) error {
+	for _, load := range []func(EnvType) error{
+		nscore.Load,
+		nscore.LoadInput,
+		nsconcurrent.Load,
+		nscoreextended.Load,
+	} {
+		if err := load(e); err != nil {
+			return err
+		}
+	}
+	if p.Env {
+		if err := nssystem.Load(e); err != nil {
+			return err
+		}
+		env.RegisterLibrary(e, "system", nssystem.Load)
+	}
+	p.restrict(e)
+	return nil
+}
+
+// EVAL is lisp.EVAL of an untrusted AST: a Go panic of the evaluation (a bug of the interpreter
+// or of a library, or an allowed panic) is returned as an error instead of crashing the host
+func EVAL(ctx context.Context, ast MalType, e EnvType) (res MalType, err error) {
+	defer recoverPanic(&err)
+	return lisp.EVAL(ctx, ast, e)
+}
+
+// REPL is lisp.REPL of untrusted source code, returning Go panics as errors (see [EVAL])
+func REPL(ctx context.Context, e EnvType, sourceCode string, cursor *Position) (res MalType, err error) {
+	defer recoverPanic(&err)
+	return lisp.REPL(ctx, e, sourceCode, cursor)
+}
+
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = lisperror.NewLispError(fmt.Errorf("panic: %v", r), nil)
+	}
+}
+
+// restrict overrides the functions of e that use capabilities forbidden by the profile
+func (p Profile) restrict(e EnvType) {
+	call.CallOverrideFN(e, "slurp", func(fileName string) (string, error) {
+		if p.FS == nil {
+			return "", &PermissionError{Function: "slurp", Capability: "file system access"}
+		}
+		b, err := fs.ReadFile(p.FS, fileName)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	})
+	call.CallOverrideFN(e, "load-file", func(ctx context.Context, fileName string) (MalType, error) {
+		if p.FS == nil {
+			return nil, &PermissionError{Function: "load-file", Capability: "file system access"}
+		}
+		ctx, err := core.WithIO(ctx, e, core.IO{FS: p.FS})
+		if err != nil {
+			return nil, err
+		}
+		return nil, nscore.LoadFile(ctx, e, fileName)
+	})
+	if !p.Panic {
+		call.CallOverrideFN(e, "panic", func(MalType) (MalType, error) {
+			return nil, &PermissionError{Function: "panic", Capability: "panics"}
+		})
+	}
+	if !p.Stdin {
+		call.CallOverrideFN(e, "read-line", func(string) (string, error) {
+			return "", &PermissionError{Function: "read-line", Capability: "reading the standard input"}
+		})
+	}
+	call.CallOverrideFN(e, "sleep", func(ctx context.Context, ms int) error {
+		d := time.Duration(ms) * time.Millisecond
+		if d > p.MaxSleep {
+			return &PermissionError{Function: "sleep", Capability: fmt.Sprintf("sleeping longer than %s", p.MaxSleep)}
+		}
+		select {
+		case <-ctx.Done():
+			return errors.New("timeout while evaluating expression")
+		case <-time.After(d):
+			return nil
+		}
+	})
+}
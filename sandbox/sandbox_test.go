@@ -0,0 +1,202 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jig/lisp"
+	"github.com/jig/lisp/env"
+	"github.com/jig/lisp/lib/core"
+	"github.com/jig/lisp/types"
+)
+
+func load(t *testing.T, p Profile) types.EnvType {
+	t.Helper()
+	ns := env.NewEnv()
+	if err := p.Load(ns); err != nil {
+		t.Fatal(err)
+	}
+	return ns
+}
+
+func eval(ns types.EnvType, code string) (types.MalType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	return REPL(ctx, ns, code, types.NewCursorFile("sandbox"))
+}
+
+// appDir returns a directory with a script, a secret file out of it and a symbolic link to the secret
+func appDir(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	app := filepath.Join(base, "app")
+	if err := os.MkdirAll(filepath.Join(app, "conf"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		filepath.Join(app, "conf", "app.lisp"): "(def answer 42)",
+		filepath.Join(base, "secret"):          "secret",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(base, "secret"), filepath.Join(app, "link")); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+	return app
+}
+
+func TestEscapes(t *testing.T) {
+	app := appDir(t)
+	ns := load(t, Profile{FS: ReadOnly(app), MaxSleep: 10 * time.Millisecond})
+	os.Setenv("SANDBOX_TEST", "host")
+
+	for _, tc := range []struct {
+		code     string
+		expected string // error substring
+	}{
+		{`(slurp "/etc/passwd")`, "invalid argument"},
+		{`(slurp "../secret")`, "invalid argument"},
+		{`(slurp "conf/../../secret")`, "invalid argument"},
+		{`(slurp "link")`, "permission denied"},
+		{`(load-file "../secret")`, "invalid argument"},
+		{`(slurp "missing")`, "file does not exist"},
+		{`(getenv "SANDBOX_TEST")`, "symbol 'getenv' not found"},
+		{`(setenv "SANDBOX_TEST" "script")`, "symbol 'setenv' not found"},
+		{`(unsetenv "SANDBOX_TEST")`, "symbol 'unsetenv' not found"},
+		{`(eval (list 'setenv "SANDBOX_TEST" "script"))`, "symbol 'setenv' not found"},
+		{`(require [system :as sys])`, "library system not found"},
+		{`(panic "boom")`, "panic: permission denied"},
+		{`@(future (panic "boom"))`, "panic: permission denied"},
+		{`(read-line "> ")`, "read-line: permission denied"},
+		{`(sleep 100000)`, "sleep: permission denied"},
+		{`(loop [] (sleep 10) (recur))`, "timeout while evaluating expression"},
+		{`(defmacro m 1)`, "defmacro expects a function (was of type integer)"},
+		{`(defmacro 1 (fn [] 1))`, "cannot use 'int' as identifier"},
+		{"`(unquote)", "unquote expects exactly one argument"},
+		{"`(a (splice-unquote))", "splice-unquote expects exactly one argument"},
+		{`@(future (defmacro m 1))`, "defmacro expects a function"},
+	} {
+		t.Run(tc.code, func(t *testing.T) {
+			res, err := eval(ns, tc.code)
+			if err == nil {
+				t.Fatalf("escaped: %s", res)
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected %q got %q", tc.expected, err)
+			}
+			if strings.Contains(err.Error(), filepath.Dir(app)) {
+				t.Fatalf("host path disclosed: %s", err)
+			}
+		})
+	}
+	if os.Getenv("SANDBOX_TEST") != "host" {
+		t.Fatal("process environment modified")
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	app := appDir(t)
+	ns := load(t, Profile{FS: ReadOnly(app), Env: true, MaxSleep: time.Second})
+	os.Setenv("SANDBOX_TEST", "host")
+	for code, expected := range map[string]string{
+		`(slurp "conf/app.lisp")`:                                     `"(def answer 42)"`,
+		`(do (load-file "conf/app.lisp") answer)`:                     `42`,
+		`(getenv "SANDBOX_TEST")`:                                     `"host"`,
+		`(do (require [system :as sys]) (sys/getenv "SANDBOX_TEST"))`: `"host"`,
+		`(sleep 1)`: `nil`,
+		`(try (panic "boom") (catch "permission-error" e :denied))`: `:denied`,
+	} {
+		res, err := eval(ns, code)
+		if err != nil {
+			t.Fatalf("%s: %s", code, err)
+		}
+		if res != expected {
+			t.Fatalf("%s: expected %s got %s", code, expected, res)
+		}
+	}
+}
+
+func TestPermissionError(t *testing.T) {
+	ns := load(t, Profile{})
+	_, err := eval(ns, `(slurp "conf/app.lisp")`)
+	var perm *PermissionError
+	if !errors.As(err, &perm) || perm.Function != "slurp" {
+		t.Fatalf("expected a slurp permission error got %v", err)
+	}
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Fatal("expected fs.ErrPermission")
+	}
+
+	// the I/O configuration of the context doesn't grant capabilities
+	ctx, err := core.WithIO(context.Background(), ns, core.IO{FS: os.DirFS("/")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lisp.REPL(ctx, ns, `(slurp "etc/passwd")`, nil); !errors.As(err, &perm) {
+		t.Fatalf("expected a permission error got %v", err)
+	}
+}
+
+// TestMalformedSpecialForms evaluates the special forms with missing, extra and mistyped
+// arguments, that must fail with an error instead of panicking
+func TestMalformedSpecialForms(t *testing.T) {
+	ns := load(t, Profile{})
+	args := []string{"", "1", "x", "[]", "[x]", "[x 1 y]", "()", "(1)", "{}", "{:a}", "nil", "(unquote)", "(splice-unquote)", "(catch)", "(catch 1 2)", "(finally)"}
+	for _, form := range []string{"def", "binding", "let", "loop", "recur", "quote", "quasiquoteexpand", "quasiquote", "defmacro", "macroexpand", "try", "do", "if", "fn"} {
+		for _, a1 := range args {
+			for _, a2 := range args {
+				for _, a3 := range []string{"", "1 2 3"} {
+					code := strings.Join(strings.Fields(strings.Join([]string{"(", form, a1, a2, a3, ")"}, " ")), " ")
+					ast, err := lisp.READ(code, types.NewCursorFile(t.Name()), ns)
+					if err != nil {
+						continue
+					}
+					func() {
+						defer func() {
+							if r := recover(); r != nil {
+								t.Fatalf("%s panicked: %v", code, r)
+							}
+						}()
+						ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+						defer cancel()
+						lisp.EVAL(ctx, ast, ns)
+						if program, err := lisp.Compile(ast, ns); err == nil {
+							program.Run(ctx, nil)
+						}
+					}()
+				}
+			}
+		}
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	ns := load(t, Profile{})
+	// a Go function with no recover (unlike the ones registered by lib/call)
+	ns.Set(types.Symbol{Val: "crash"}, types.Func{Fn: func(context.Context, []types.MalType) (types.MalType, error) {
+		var m map[string]int
+		m["host"]++
+		return nil, nil
+	}})
+	if _, err := eval(ns, `(crash)`); err == nil || !strings.Contains(err.Error(), "panic: assignment to entry in nil map") {
+		t.Fatalf("expected a panic error got %v", err)
+	}
+	ast, err := lisp.READ(`(let [x 1] (crash))`, nil, ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EVAL(context.Background(), ast, ns); err == nil || !strings.Contains(err.Error(), "panic:") {
+		t.Fatalf("expected a panic error got %v", err)
+	}
+	if _, err := eval(ns, `@(future (crash))`); err == nil || !strings.Contains(err.Error(), "panic:") {
+		t.Fatalf("expected a panic error got %v", err)
+	}
+}
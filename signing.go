@@ -0,0 +1,80 @@
+package lisp
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/jig/lisp/printer"
+	. "github.com/jig/lisp/types"
+)
+
+// signaturePrefix starts the line with the signature of a signed code, before its preamble
+const signaturePrefix = ";; signature "
+
+// ErrInvalidSignature is returned by [READWithPreamble] when the code is not signed, or it
+// was modified after signing it
+var ErrInvalidSignature = errors.New("missing or invalid code signature")
+
+// Hash returns the SHA-256 hash of the canonical form of ast (see [printer.Canonical]). Equal
+// ASTs have the same hash, however their source was formatted.
+func Hash(ast MalType) ([sha256.Size]byte, error) {
+	canonical, err := printer.Canonical(ast)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256([]byte(canonical)), nil
+}
+
+// Sign returns source (code with an optional preamble, see [AddPreamble]) with a signature line
+// added, so [READWithPreamble] can check it was not modified. The signature covers the hash of
+// the AST read from source, placeholders included, so reformatting the code doesn't break it:
+//
+//	signed, err := lisp.Sign(source, privateKey, nil)
+//	...
+//	ast, err := lisp.READWithPreamble(signed, nil, ns, publicKey)
+func Sign(source string, key ed25519.PrivateKey, ns EnvType) (string, error) {
+	_, source = cutSignature(source)
+	ast, err := readWithPreamble(source, nil, ns)
+	if err != nil {
+		return "", err
+	}
+	hash, err := Hash(ast)
+	if err != nil {
+		return "", err
+	}
+	signature := ed25519.Sign(key, hash[:])
+	return signaturePrefix + base64.StdEncoding.EncodeToString(signature) + "\n" + source, nil
+}
+
+// cutSignature returns the signature of str, if any, and str without the signature line
+func cutSignature(str string) ([]byte, string) {
+	if !strings.HasPrefix(str, signaturePrefix) {
+		return nil, str
+	}
+	line, rest, _ := strings.Cut(str, "\n")
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(line, signaturePrefix)))
+	if err != nil {
+		// an invalid signature is the same as no signature
+		return nil, rest
+	}
+	return signature, rest
+}
+
+func verify(ast MalType, signature []byte, keys []ed25519.PublicKey) error {
+	if signature == nil {
+		return ErrInvalidSignature
+	}
+	hash, err := Hash(ast)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, hash[:], signature) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
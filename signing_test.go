@@ -0,0 +1,134 @@
+package lisp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jig/lisp/printer"
+	"github.com/jig/lisp/types"
+)
+
+func TestCanonical(t *testing.T) {
+	for code, expected := range map[string]string{
+		`{:b   1 :a [1  2]}`:            `{:a [1 2] :b 1}`,
+		`#{"b" "a"}`:                    `#{"a" "b"}`,
+		`(f  'x  "a\"b\nc")`:            `(f (quote x) "a\"b\nc")`,
+		`¬{"raw": "json"}¬`:             `"{\"raw\": \"json\"}"`,
+		`[1N 2.5M 1.0 nil true :k sym]`: `[1N 2.5M 1.0 nil true :k sym]`,
+		`{[2] :b [1 {:y 1 :x 2}] :a}`:   `{[1 {:x 2 :y 1}] :a [2] :b}`,
+		"(do\n\t(prn 1)\n\n   (prn 2))": `(do (prn 1) (prn 2))`,
+		`["a\tb\u0001" \a \newline]`:    `["a\tb\u0001" \a \newline]`,
+	} {
+		ast, err := READ(code, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		canonical, err := printer.Canonical(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if canonical != expected {
+			t.Fatalf("%s: expected %s got %s", code, expected, canonical)
+		}
+		// the canonical form reads back as the same AST
+		back, err := READ(canonical, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := printer.Canonical(back); again != canonical {
+			t.Fatalf("%s: read back as %s", canonical, again)
+		}
+	}
+
+	fnAST, err := READ(`(fn [] 1)`, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, err := EVAL(context.Background(), fnAST, newEnv(t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []types.MalType{fn, errors.New("go error")} {
+		if _, err := printer.Canonical(types.NewVector(value)); err == nil {
+			t.Fatalf("expected an error encoding %s", PRINT(value))
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a, err := READ(`{:b 1 :a (+ 1 2)}`, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := READ("{:a (+ 1\n 2)\n :b 1}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ha, err := Hash(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, err := Hash(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ha != hb {
+		t.Fatal("equal ASTs have different hashes")
+	}
+	c, _ := READ(`{:b 1 :a (+ 1 3)}`, nil, nil)
+	if hc, _ := Hash(c); hc == ha {
+		t.Fatal("different ASTs have the same hash")
+	}
+}
+
+func TestSignedPreamble(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := AddPreamble(`(+ $A $B)`, map[string]types.MalType{"$A": 1, "$B": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Sign(source, private, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ast, err := READWithPreamble(signed, nil, nil, otherPublic, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PRINT(ast) != "(+ 1 2)" {
+		t.Fatalf("unexpected code %s", PRINT(ast))
+	}
+	// reformatting keeps the signature valid
+	if _, err := READWithPreamble(strings.Replace(signed, "(+ $A $B)", "(+\n  $A\n  $B)", 1), nil, nil, public); err != nil {
+		t.Fatal(err)
+	}
+	// signed code can also be read without checking its signature
+	if ast, err := READWithPreamble(signed, nil, nil); err != nil || PRINT(ast) != "(+ 1 2)" {
+		t.Fatalf("unexpected code %s (%v)", PRINT(ast), err)
+	}
+
+	for name, payload := range map[string]string{
+		"tampered preamble": strings.Replace(signed, ";; $B 2", ";; $B 3", 1),
+		"tampered code":     strings.Replace(signed, "(+ $A $B)", "(- $A $B)", 1),
+		"unsigned":          source,
+		"invalid signature": ";; signature !!!\n" + source,
+	} {
+		if _, err := READWithPreamble(payload, nil, nil, public); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("%s: expected an invalid signature error got %v", name, err)
+		}
+	}
+	if _, err := READWithPreamble(signed, nil, nil, otherPublic); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected an invalid signature error with another key got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package lisp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jig/lisp/lisperror"
+	"github.com/jig/lisp/types"
+)
+
+const stackCode = `(do
+(def inner (fn [x] (throw "boom")))
+(def middle (fn [x] (+ 1 (inner x))))
+(def outer (fn [x] (+ 1 (middle x))))
+(def tail (fn [x] (inner x))))`
+
+func stackNames(t *testing.T, err error) []string {
+	t.Helper()
+	var lerr lisperror.LispError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expected a LispError got %T: %s", err, err)
+	}
+	names := []string{}
+	for _, frame := range lerr.Stack() {
+		names = append(names, frame.Name)
+	}
+	return names
+}
+
+func TestErrorStack(t *testing.T) {
+	ns := newEnv(t.Name())
+	if _, err := REPL(context.Background(), ns, stackCode, types.NewCursorFile(t.Name())); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		code  string
+		stack string
+	}{
+		{`(outer 1)`, "inner middle outer"},
+		// tail calls replace the caller frame
+		{`(tail 1)`, "inner"},
+		// called from Go
+		{`(map middle [1])`, "inner middle"},
+		// anonymous functions have no name
+		{`((fn [x] (+ 1 (middle x))) 1)`, "inner middle "},
+	} {
+		_, err := REPL(context.Background(), ns, tc.code, types.NewCursorFile(t.Name()))
+		if stack := strings.Join(stackNames(t, err), " "); stack != tc.stack {
+			t.Fatalf("%s: expected stack %q got %q", tc.code, tc.stack, stack)
+		}
+	}
+
+	_, err := REPL(context.Background(), ns, `(outer 1)`, types.NewCursorFile(t.Name()))
+	lerr := err.(lisperror.LispError)
+	if pos := lerr.Stack()[0].Position; pos == nil || pos.BeginRow != 3 {
+		t.Fatalf("expected inner called at row 3 got %s", pos)
+	}
+	if trace := lisperror.StackTrace(err); strings.Count(trace, "\tat ") != 3 || !strings.HasPrefix(trace, "\tat inner "+t.Name()+"§3") {
+		t.Fatalf("unexpected stack trace %q", trace)
+	}
+	hm, err := lerr.MarshalHashMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack := hm.(types.HashMap).Map()["ʞstack"].(types.Vector)
+	if name, _ := stack.Nth(2).(types.HashMap).Get("ʞname"); stack.Len() != 3 || name != "outer" {
+		t.Fatalf("unexpected marshaled stack %s", PRINT(stack))
+	}
+}
+
+func TestCompiledErrorStack(t *testing.T) {
+	ns := newEnv(t.Name())
+	for _, tc := range []struct {
+		code  string
+		stack string
+	}{
+		{stackCode[:len(stackCode)-1] + ` (outer 1))`, "inner middle outer"},
+		{stackCode[:len(stackCode)-1] + ` (tail 1))`, "inner"},
+	} {
+		_, err := compileString(t, ns, tc.code).Run(context.Background(), nil)
+		if stack := strings.Join(stackNames(t, err), " "); stack != tc.stack {
+			t.Fatalf("%s: expected stack %q got %q", tc.code, tc.stack, stack)
+		}
+	}
+}
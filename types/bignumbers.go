@@ -0,0 +1,83 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+)
+
+// BigInt is an arbitrary precision integer. Literals use the N suffix (e.g. 1N).
+// Val must not be modified once the BigInt has been created.
+type BigInt struct {
+	Val *big.Int
+}
+
+func NewBigInt(i int) BigInt {
+	return BigInt{Val: big.NewInt(int64(i))}
+}
+
+func (b BigInt) String() string {
+	return b.Val.String()
+}
+
+func (b BigInt) MarshalJSON() ([]byte, error) {
+	return []byte(b.Val.String()), nil
+}
+
+// Decimal is an arbitrary precision decimal number. Literals use the M suffix (e.g. 10.25M).
+// Decimals always have a finite decimal expansion.
+// Val must not be modified once the Decimal has been created.
+type Decimal struct {
+	Val *big.Rat
+}
+
+var ErrNonTerminatingDecimal = errors.New("non-terminating decimal expansion; no exact representable decimal result")
+
+// NewDecimal returns a decimal of the rational r, that must have a finite decimal expansion
+func NewDecimal(r *big.Rat) (Decimal, error) {
+	if _, ok := decimalScale(r); !ok {
+		return Decimal{}, ErrNonTerminatingDecimal
+	}
+	return Decimal{Val: r}, nil
+}
+
+// decimalScale returns the number of fractional digits required to print r exactly.
+// ok is false if r has no finite decimal expansion.
+func decimalScale(r *big.Rat) (scale int, ok bool) {
+	d := new(big.Int).Set(r.Denom())
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	twos, fives := 0, 0
+	for {
+		if _, mod = d.QuoRem(d, two, mod); mod.Sign() != 0 {
+			d.Mul(d, two).Add(d, mod)
+			break
+		}
+		twos++
+	}
+	for {
+		if _, mod = d.QuoRem(d, five, mod); mod.Sign() != 0 {
+			d.Mul(d, five).Add(d, mod)
+			break
+		}
+		fives++
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+func (d Decimal) String() string {
+	scale, ok := decimalScale(d.Val)
+	if !ok {
+		return d.Val.RatString()
+	}
+	return d.Val.FloatString(scale)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
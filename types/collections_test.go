@@ -0,0 +1,259 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestVectorConjAssoc(t *testing.T) {
+	for _, n := range []int{0, 1, 31, 32, 33, 1024, 1056, 32*32*32 + 33} {
+		slc := []MalType{}
+		v := Vector{}
+		for i := 0; i < n; i++ {
+			slc = append(slc, i)
+			v = v.Conj(i)
+		}
+		if v.Len() != n {
+			t.Fatalf("%d: unexpected length %d", n, v.Len())
+		}
+		old := v
+		r := rand.New(rand.NewSource(int64(n)))
+		for k := 0; k < 100 && n > 0; k++ {
+			i := r.Intn(n)
+			slc[i] = -i
+			v = v.Assoc(i, -i)
+		}
+		for i := 0; i < n; i++ {
+			if v.Nth(i) != slc[i] {
+				t.Fatalf("%d: element %d is %v, expected %v", n, i, v.Nth(i), slc[i])
+			}
+			if old.Nth(i) != i {
+				t.Fatalf("%d: assoc modified the original vector at %d", n, i)
+			}
+		}
+		if !Equal_Q(NewVector(slc...), v) {
+			t.Fatalf("%d: NewVector differs from conj", n)
+		}
+		if s := v.Slice(); len(s) != n || (n > 0 && s[n-1] != slc[n-1]) {
+			t.Fatalf("%d: unexpected slice", n)
+		}
+	}
+}
+
+func TestVectorSharedTail(t *testing.T) {
+	v := NewVector(1, 2, 3)
+	a := v.Conj("a")
+	b := v.Conj("b")
+	if a.Nth(3) != "a" || b.Nth(3) != "b" || v.Len() != 3 {
+		t.Fatal("conj on a shared vector modified its siblings")
+	}
+}
+
+func TestHashMapAssocDissoc(t *testing.T) {
+	m := map[string]MalType{}
+	hm := HashMap{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprint(r.Intn(5000))
+		if r.Intn(3) == 0 {
+			delete(m, key)
+			hm = hm.Dissoc(key)
+		} else {
+			m[key] = i
+			hm = hm.Assoc(key, i)
+		}
+	}
+	if hm.Len() != len(m) {
+		t.Fatalf("unexpected length %d, expected %d", hm.Len(), len(m))
+	}
+	for k, v := range m {
+		if got, ok := hm.Get(k); !ok || got != v {
+			t.Fatalf("key %s is %v, expected %v", k, got, v)
+		}
+	}
+	count := 0
+	hm.Range(func(k, v MalType) bool {
+		if m[k.(string)] != v {
+			t.Fatalf("range returned %s %v, expected %v", k, v, m[k.(string)])
+		}
+		count++
+		return true
+	})
+	if count != len(m) {
+		t.Fatalf("range returned %d entries, expected %d", count, len(m))
+	}
+	if !Equal_Q(NewHashMapFromMap(m), hm) {
+		t.Fatal("NewHashMapFromMap differs from assoc")
+	}
+}
+
+func TestHamtCollisions(t *testing.T) {
+	// entries whose hashes are equal are stored on a collision node
+	node := &hnode{}
+	for _, key := range []string{"a", "b", "c"} {
+		node, _ = node.assoc(0, hslot{hash: 7, key: key, value: key})
+	}
+	m := hamt{count: 3, root: node}
+	for _, key := range []string{"a", "b", "c"} {
+		if v, ok := m.getHashed(7, key); !ok || v != key {
+			t.Fatalf("collision %s not found", key)
+		}
+	}
+	root, removed := m.root.dissoc(0, 7, "b")
+	if !removed {
+		t.Fatal("collision not removed")
+	}
+	m2 := hamt{count: 2, root: root}
+	if _, ok := m2.getHashed(7, "b"); ok {
+		t.Fatal("removed collision found")
+	}
+	if _, ok := m.getHashed(7, "b"); !ok {
+		t.Fatal("dissoc modified the original map")
+	}
+}
+
+func TestHashConsistentWithEqual(t *testing.T) {
+	for _, equal := range [][2]MalType{
+		{1, NewBigInt(1)},
+		{NewVector(1, "a"), List{Val: []MalType{1, "a"}}},
+		{NewHashMapFromMap(map[string]MalType{"a": 1, "b": 2}), NewHashMapFromMap(map[string]MalType{"b": 2, "a": 1})},
+		{0.0, math.Copysign(0, -1)},
+		{Symbol{Val: "x"}, Symbol{Val: "x"}},
+	} {
+		if !Equal_Q(equal[0], equal[1]) {
+			t.Fatalf("%v and %v are not equal", equal[0], equal[1])
+		}
+		if HashKey(equal[0]) != HashKey(equal[1]) {
+			t.Fatalf("%v and %v have different hashes", equal[0], equal[1])
+		}
+	}
+	hm := HashMap{}.Assoc(NewVector(200, "ʞget"), "ʞok").Assoc(1, "one")
+	if v, ok := hm.Get(List{Val: []MalType{200, "ʞget"}}); !ok || v != "ʞok" {
+		t.Fatal("tuple key not found")
+	}
+	if v, ok := hm.Get(NewBigInt(1)); !ok || v != "one" {
+		t.Fatal("integer key not found")
+	}
+	if _, ok := hm.Get("1"); ok {
+		t.Fatal("string key found as integer key")
+	}
+}
+
+func TestFunctionKeys(t *testing.T) {
+	fn := func(n int) ExternalCall {
+		return func(context.Context, []MalType) (MalType, error) { return n, nil }
+	}
+	f1, f2 := Func{Fn: fn(1)}, Func{Fn: fn(2)}
+	m1 := MalFunc{Exp: List{Val: []MalType{Symbol{Val: "do"}, 1}}}
+	m2 := MalFunc{Exp: List{Val: []MalType{Symbol{Val: "do"}, 1}}}
+	hm := HashMap{}.Assoc(f1, 1).Assoc(f2, 2).Assoc(m1, 3).Assoc(m2, 4)
+	if hm.Len() != 4 {
+		t.Fatalf("expected 4 entries, got %d", hm.Len())
+	}
+	for k, expected := range map[int]MalType{1: f1, 2: f2, 3: m1, 4: m2} {
+		// copies (e.g. made by with-meta) keep the identity of the function
+		copied := expected
+		switch f := copied.(type) {
+		case Func:
+			f.Meta = "meta"
+			copied = f
+		case MalFunc:
+			f.Name = "named"
+			copied = f
+		}
+		if v, ok := hm.Get(copied); !ok || v != k {
+			t.Fatalf("function key %d not found (got %v)", k, v)
+		}
+	}
+	if Equal_Q(f1, f2) || Equal_Q(m1, m2) {
+		t.Fatal("different functions are equal")
+	}
+	if Equal_Q(Vector{}, 1) || Equal_Q(struct{ v MalType }{[]MalType{}}, struct{ v MalType }{[]MalType{}}) {
+		t.Fatal("uncomparable values are equal")
+	}
+}
+
+const collectionSize = 10000
+
+// the benchmarks compare building a collection with persistent updates against copying a Go
+// slice or map on each update (as assoc and conj did before)
+
+func BenchmarkVectorConj(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		v := Vector{}
+		for j := 0; j < collectionSize; j++ {
+			v = v.Conj(j)
+		}
+	}
+}
+
+func BenchmarkSliceCopyConj(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		slc := []MalType{}
+		for j := 0; j < collectionSize; j++ {
+			slc = append(append(make([]MalType, 0, len(slc)+1), slc...), j)
+		}
+	}
+}
+
+func BenchmarkVectorAssoc(b *testing.B) {
+	v := NewVector(make([]MalType, collectionSize)...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v = v.Assoc(i%collectionSize, i)
+	}
+}
+
+func BenchmarkSliceCopyAssoc(b *testing.B) {
+	slc := make([]MalType, collectionSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		slc = append([]MalType{}, slc...)
+		slc[i%collectionSize] = i
+	}
+}
+
+var benchmarkKeys = func() []string {
+	keys := make([]string, collectionSize)
+	for i := range keys {
+		keys[i] = fmt.Sprint("ʞkey-", i)
+	}
+	return keys
+}()
+
+func BenchmarkHashMapAssoc(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		hm := HashMap{}
+		for j, key := range benchmarkKeys {
+			hm = hm.Assoc(key, j)
+		}
+	}
+}
+
+func BenchmarkMapCopyAssoc(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		m := map[string]MalType{}
+		for j, key := range benchmarkKeys {
+			m2 := make(map[string]MalType, len(m)+1)
+			for k, v := range m {
+				m2[k] = v
+			}
+			m2[key] = j
+			m = m2
+		}
+	}
+}
+
+func BenchmarkHashMapGet(b *testing.B) {
+	hm := HashMap{}
+	for j, key := range benchmarkKeys {
+		hm = hm.Assoc(key, j)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hm.Get(benchmarkKeys[i%collectionSize])
+	}
+}
@@ -0,0 +1,224 @@
+package types
+
+import "math/bits"
+
+// hamt is a persistent hash map: a hash array mapped trie of 32 wide nodes indexed by 5 bits
+// of the key hash on each level. Updates copy the path to the modified entry (O(log32 n)),
+// sharing the rest of the trie with the original map. Keys are compared with Equal_Q (see
+// HashKey). The zero value is an empty map.
+type hamt struct {
+	count int
+	root  *hnode
+	// next is the insertion sequence number of the next new key
+	next uint64
+}
+
+// hnode is a bitmap indexed node: slots holds an entry or a sub node for each bit set on bitmap.
+// Keys whose hashes are equal are stored on a collision node (with collisions and no bitmap).
+type hnode struct {
+	bitmap     uint32
+	slots      []hslot
+	collisions []hslot
+}
+
+type hslot struct {
+	node  *hnode // nil on entries
+	hash  uint32
+	seq   uint64 // insertion sequence number, kept when the value is replaced
+	key   MalType
+	value MalType
+}
+
+const (
+	hamtBits     = 5
+	hamtMask     = 1<<hamtBits - 1
+	hamtMaxShift = 30
+)
+
+func (m hamt) len() int {
+	return m.count
+}
+
+func (m hamt) get(key MalType) (MalType, bool) {
+	return m.getHashed(HashKey(key), key)
+}
+
+func (m hamt) getHashed(hash uint32, key MalType) (MalType, bool) {
+	node := m.root
+	for shift := uint(0); node != nil; shift += hamtBits {
+		if node.collisions != nil {
+			for _, e := range node.collisions {
+				if equalKeys(e.key, key) {
+					return e.value, true
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << ((hash >> shift) & hamtMask)
+		if node.bitmap&bit == 0 {
+			return nil, false
+		}
+		slot := node.slots[bits.OnesCount32(node.bitmap&(bit-1))]
+		if slot.node == nil {
+			if slot.hash == hash && equalKeys(slot.key, key) {
+				return slot.value, true
+			}
+			return nil, false
+		}
+		node = slot.node
+	}
+	return nil, false
+}
+
+func (m hamt) assoc(key, value MalType) hamt {
+	root := m.root
+	if root == nil {
+		root = &hnode{}
+	}
+	root, added := root.assoc(0, hslot{hash: HashKey(key), seq: m.next, key: key, value: value})
+	if added {
+		return hamt{count: m.count + 1, root: root, next: m.next + 1}
+	}
+	return hamt{count: m.count, root: root, next: m.next}
+}
+
+func (m hamt) dissoc(key MalType) hamt {
+	if m.root == nil {
+		return m
+	}
+	root, removed := m.root.dissoc(0, HashKey(key), key)
+	if !removed {
+		return m
+	}
+	return hamt{count: m.count - 1, root: root, next: m.next}
+}
+
+// each calls f with every entry (in no particular order) while it returns true
+func (m hamt) each(f func(key, value MalType) bool) {
+	if m.root != nil {
+		m.root.each(func(e *hslot) bool { return f(e.key, e.value) })
+	}
+}
+
+// entries returns the entries of m (in no particular order)
+func (m hamt) entries() []*hslot {
+	entries := make([]*hslot, 0, m.count)
+	if m.root != nil {
+		m.root.each(func(e *hslot) bool {
+			entries = append(entries, e)
+			return true
+		})
+	}
+	return entries
+}
+
+func (n *hnode) assoc(shift uint, e hslot) (*hnode, bool) {
+	if n.collisions != nil {
+		collisions := append([]hslot(nil), n.collisions...)
+		for i := range collisions {
+			if equalKeys(collisions[i].key, e.key) {
+				e.seq = collisions[i].seq
+				collisions[i] = e
+				return &hnode{collisions: collisions}, false
+			}
+		}
+		return &hnode{collisions: append(collisions, e)}, true
+	}
+	bit := uint32(1) << ((e.hash >> shift) & hamtMask)
+	i := bits.OnesCount32(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		slots := make([]hslot, len(n.slots)+1)
+		copy(slots, n.slots[:i])
+		slots[i] = e
+		copy(slots[i+1:], n.slots[i:])
+		return &hnode{bitmap: n.bitmap | bit, slots: slots}, true
+	}
+	slots := append([]hslot(nil), n.slots...)
+	slot := slots[i]
+	added := false
+	switch {
+	case slot.node != nil:
+		slots[i].node, added = slot.node.assoc(shift+hamtBits, e)
+	case slot.hash == e.hash && equalKeys(slot.key, e.key):
+		e.seq = slot.seq
+		slots[i] = e
+	default:
+		slots[i] = hslot{node: merge(shift+hamtBits, slot, e)}
+		added = true
+	}
+	return &hnode{bitmap: n.bitmap, slots: slots}, added
+}
+
+// merge returns a node with the entries a and b, whose hashes are equal up to shift
+func merge(shift uint, a, b hslot) *hnode {
+	if shift > hamtMaxShift {
+		return &hnode{collisions: []hslot{a, b}}
+	}
+	bitA := uint32(1) << ((a.hash >> shift) & hamtMask)
+	bitB := uint32(1) << ((b.hash >> shift) & hamtMask)
+	switch {
+	case bitA == bitB:
+		return &hnode{bitmap: bitA, slots: []hslot{{node: merge(shift+hamtBits, a, b)}}}
+	case bitA < bitB:
+		return &hnode{bitmap: bitA | bitB, slots: []hslot{a, b}}
+	default:
+		return &hnode{bitmap: bitA | bitB, slots: []hslot{b, a}}
+	}
+}
+
+func (n *hnode) dissoc(shift uint, hash uint32, key MalType) (*hnode, bool) {
+	if n.collisions != nil {
+		for i := range n.collisions {
+			if equalKeys(n.collisions[i].key, key) {
+				collisions := make([]hslot, 0, len(n.collisions)-1)
+				collisions = append(collisions, n.collisions[:i]...)
+				return &hnode{collisions: append(collisions, n.collisions[i+1:]...)}, true
+			}
+		}
+		return n, false
+	}
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := bits.OnesCount32(n.bitmap & (bit - 1))
+	slot := n.slots[i]
+	if slot.node != nil {
+		node, removed := slot.node.dissoc(shift+hamtBits, hash, key)
+		if !removed {
+			return n, false
+		}
+		if !node.empty() {
+			slots := append([]hslot(nil), n.slots...)
+			slots[i].node = node
+			return &hnode{bitmap: n.bitmap, slots: slots}, true
+		}
+	} else if slot.hash != hash || !equalKeys(slot.key, key) {
+		return n, false
+	}
+	slots := make([]hslot, 0, len(n.slots)-1)
+	slots = append(slots, n.slots[:i]...)
+	return &hnode{bitmap: n.bitmap &^ bit, slots: append(slots, n.slots[i+1:]...)}, true
+}
+
+func (n *hnode) empty() bool {
+	return len(n.slots) == 0 && len(n.collisions) == 0
+}
+
+func (n *hnode) each(f func(e *hslot) bool) bool {
+	for i := range n.collisions {
+		if !f(&n.collisions[i]) {
+			return false
+		}
+	}
+	for i := range n.slots {
+		if n.slots[i].node != nil {
+			if !n.slots[i].node.each(f) {
+				return false
+			}
+		} else if !f(&n.slots[i]) {
+			return false
+		}
+	}
+	return true
+}
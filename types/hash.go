@@ -0,0 +1,140 @@
+package types
+
+import (
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// HashKey returns the hash of x used by hash maps and sets. It is consistent with Equal_Q:
+// equal values (e.g. 1 and 1N, or a list and a vector with the same elements) have the
+// same hash.
+func HashKey(x MalType) uint32 {
+	switch x := x.(type) {
+	case nil:
+		return 0
+	case string:
+		return hashString(x)
+	case bool:
+		if x {
+			return 1231
+		}
+		return 1237
+	case int:
+		return hashInt(int64(x))
+	case BigInt:
+		if x.Val.IsInt64() {
+			return hashInt(x.Val.Int64())
+		}
+		return mix(hashString(x.Val.String()))
+	case Decimal:
+		// rationals are normalized, so equal decimals have the same RatString
+		return mix(hashString(x.Val.RatString()) + 1)
+	case float64:
+		if x == 0 {
+			// -0.0 == 0.0
+			x = 0
+		}
+		return hashInt(int64(math.Float64bits(x)))
+	case Symbol:
+		return mix(hashString(x.Val) + 2)
+	case []byte:
+		return mix(hashString(string(x)) + 5)
+	case Char:
+		return mix(uint32(x) + 6)
+	case List:
+		return hashSeq(x.Val)
+	case Vector:
+		return hashSeq(x.Slice())
+	case HashMap:
+		// the entries of a hash map have no order
+		h := uint32(3)
+		x.m.each(func(key, value MalType) bool {
+			h += mix(HashKey(key)) ^ HashKey(value)
+			return true
+		})
+		return mix(h)
+	case Set:
+		h := uint32(4)
+		x.m.each(func(item, _ MalType) bool {
+			h += HashKey(item)
+			return true
+		})
+		return mix(h)
+	case MalFunc, Func:
+		return hashInt(int64(funcIdentity(x)))
+	default:
+		// other values are compared with ==: pointers by address, and the rest just by type
+		v := reflect.ValueOf(x)
+		if v.Kind() == reflect.Pointer {
+			return hashInt(int64(v.Pointer()))
+		}
+		return hashString(v.Type().String())
+	}
+}
+
+// funcIdentity returns the address that identifies the function f (a MalFunc or a Func),
+// kept by its copies (e.g. the ones made by def or with-meta): the body (or the clauses)
+// built each time a fn form is evaluated, or the closure of a Go function.
+func funcIdentity(f MalType) uintptr {
+	switch f := f.(type) {
+	case MalFunc:
+		if len(f.Arities) > 0 {
+			return uintptr(unsafe.Pointer(&f.Arities[0]))
+		}
+		if body, ok := f.Exp.(List); ok && len(body.Val) > 0 {
+			return uintptr(unsafe.Pointer(&body.Val[0]))
+		}
+		if v := reflect.ValueOf(f.Env); v.Kind() == reflect.Pointer {
+			return v.Pointer()
+		}
+	case Func:
+		if f.Fn != nil {
+			// a func value is a pointer to its closure (reflect only provides the address of
+			// its code, shared by all the closures of the same function literal)
+			return uintptr(*(*unsafe.Pointer)(unsafe.Pointer(&f.Fn)))
+		}
+	}
+	return 0
+}
+
+// hashString is the 32 bits FNV-1a hash of s
+func hashString(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func hashSeq(values []MalType) uint32 {
+	h := uint32(5)
+	for _, value := range values {
+		h = h*31 + HashKey(value)
+	}
+	return mix(h)
+}
+
+func hashInt(i int64) uint32 {
+	return mix(uint32(i) ^ uint32(i>>32)*0x9e3779b9)
+}
+
+// mix spreads the bits of h (the finalizer of murmur3)
+func mix(h uint32) uint32 {
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// equalKeys is Equal_Q with a fast path for strings (and keywords), the most common keys
+func equalKeys(a, b MalType) bool {
+	if as, ok := a.(string); ok {
+		bs, ok := b.(string)
+		return ok && as == bs
+	}
+	return Equal_Q(a, b)
+}
@@ -0,0 +1,254 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Order is the iteration order of the entries of hash maps and the items of sets
+type Order int
+
+const (
+	// Sorted orders keys by Compare, so equal maps and sets are always printed the same way
+	Sorted Order = iota
+	// Insertion orders keys by the time they were first added
+	Insertion
+)
+
+type keyOrderKey struct{}
+
+// WithKeyOrder returns a copy of ctx where hash maps and sets are printed (pr-str, str, prn...),
+// encoded to JSON and listed by keys, vals and seq in order
+func WithKeyOrder(ctx context.Context, order Order) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, keyOrderKey{}, order)
+}
+
+// KeyOrderFromContext returns the order of hash maps and sets of ctx (see [WithKeyOrder]),
+// Sorted by default
+func KeyOrderFromContext(ctx context.Context) Order {
+	if ctx == nil {
+		return Sorted
+	}
+	order, _ := ctx.Value(keyOrderKey{}).(Order)
+	return order
+}
+
+// OrderedKeys returns the keys of hm in order
+func (hm HashMap) OrderedKeys(order Order) []MalType {
+	return keysOf(hm.m.ordered(order))
+}
+
+// OrderedItems returns the items of s in order
+func (s Set) OrderedItems(order Order) []MalType {
+	return keysOf(s.m.ordered(order))
+}
+
+func keysOf(entries []*hslot) []MalType {
+	keys := make([]MalType, len(entries))
+	for i, e := range entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+func (m hamt) ordered(order Order) []*hslot {
+	entries := m.entries()
+	switch order {
+	case Insertion:
+		sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	default:
+		sort.Slice(entries, func(i, j int) bool { return Compare(entries[i].key, entries[j].key) < 0 })
+	}
+	return entries
+}
+
+// ranks of the types ordered by Compare
+const (
+	rankNil = iota
+	rankBool
+	rankNumber
+	rankChar
+	rankKeyword
+	rankString
+	rankSymbol
+	rankSequential
+	rankSet
+	rankHashMap
+	rankOther
+)
+
+func rank(x MalType) int {
+	switch x := x.(type) {
+	case nil:
+		return rankNil
+	case bool:
+		return rankBool
+	case int, BigInt, Decimal, float64:
+		return rankNumber
+	case Char:
+		return rankChar
+	case string:
+		if strings.HasPrefix(x, "ʞ") {
+			return rankKeyword
+		}
+		return rankString
+	case Symbol:
+		return rankSymbol
+	case List, Vector:
+		return rankSequential
+	case Set:
+		return rankSet
+	case HashMap:
+		return rankHashMap
+	default:
+		return rankOther
+	}
+}
+
+// Compare is a total order of values, consistent with Equal_Q (it returns 0 only if a and b
+// are equal, NaN aside). It returns a negative number if a is before b and a positive one if
+// it is after. Values are ordered by type: nil, booleans, numbers, characters, keywords,
+// strings, symbols, lists and vectors, sets, hash maps and then other values. Numbers are
+// ordered by value, characters by code point, strings, keywords and symbols lexicographically,
+// and collections by their (sorted) elements.
+func Compare(a, b MalType) int {
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case bool:
+		return compareBool(a, b.(bool))
+	case Char:
+		return int(a) - int(b.(Char))
+	case string:
+		return strings.Compare(a, b.(string))
+	case Symbol:
+		return strings.Compare(a.Val, b.(Symbol).Val)
+	case List, Vector:
+		as, _ := GetSlice(a)
+		bs, _ := GetSlice(b)
+		return compareSlices(as, bs)
+	case Set:
+		b := b.(Set)
+		if a.Len() != b.Len() {
+			return a.Len() - b.Len()
+		}
+		return compareSlices(a.OrderedItems(Sorted), b.OrderedItems(Sorted))
+	case HashMap:
+		b := b.(HashMap)
+		if a.Len() != b.Len() {
+			return a.Len() - b.Len()
+		}
+		ak, bk := a.OrderedKeys(Sorted), b.OrderedKeys(Sorted)
+		if c := compareSlices(ak, bk); c != 0 {
+			return c
+		}
+		for _, k := range ak {
+			av, _ := a.Get(k)
+			bv, _ := b.Get(k)
+			if c := Compare(av, bv); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case int, BigInt, Decimal, float64:
+		return compareNumbers(a, b)
+	default:
+		if Equal_Q(a, b) {
+			return 0
+		}
+		// not a meaningful order, but a deterministic one for values of the same type
+		if c := strings.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(fmt.Sprint(a), fmt.Sprint(b)); c != 0 {
+			return c
+		}
+		return 1
+	}
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func compareSlices(a, b []MalType) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// compareNumbers orders numbers by value, and numbers of equal value but different kind
+// (e.g. 1, 1M and 1.0, that are not equal) integers first, then decimals and then floats
+func compareNumbers(a, b MalType) int {
+	af, aFloat := a.(float64)
+	bf, bFloat := b.(float64)
+	if !aFloat && !bFloat {
+		if c := exact(a).Cmp(exact(b)); c != 0 {
+			return c
+		}
+		return numberKind(a) - numberKind(b)
+	}
+	if !aFloat {
+		af, _ = exact(a).Float64()
+	}
+	if !bFloat {
+		bf, _ = exact(b).Float64()
+	}
+	switch {
+	case math.IsNaN(af) || math.IsNaN(bf):
+		// NaN goes first
+		if c := compareBool(!math.IsNaN(af), !math.IsNaN(bf)); c != 0 {
+			return c
+		}
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	}
+	return numberKind(a) - numberKind(b)
+}
+
+func exact(x MalType) *big.Rat {
+	switch x := x.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(x))
+	case BigInt:
+		return new(big.Rat).SetInt(x.Val)
+	case Decimal:
+		return x.Val
+	default:
+		panic(fmt.Sprintf("not an exact number: %T", x))
+	}
+}
+
+func numberKind(x MalType) int {
+	switch x.(type) {
+	case Decimal:
+		return 1
+	case float64:
+		return 2
+	default:
+		// int and BigInt are equal if their values are
+		return 0
+	}
+}
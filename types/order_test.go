@@ -0,0 +1,59 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	// in order
+	values := []MalType{
+		nil,
+		false,
+		true,
+		-1,
+		Decimal{Val: big.NewRat(-1, 2)},
+		0,
+		1,
+		Decimal{Val: big.NewRat(1, 1)},
+		1.0,
+		NewBigInt(2),
+		Char('a'),
+		Char('b'),
+		"ʞa",
+		"ʞb",
+		"",
+		"a",
+		Symbol{Val: "a"},
+		List{Val: []MalType{}},
+		NewVector(1),
+		NewVector(1, 2),
+		List{Val: []MalType{2}},
+		NewHashMapFromMap(map[string]MalType{"ʞa": 2}),
+		NewHashMapFromMap(map[string]MalType{"ʞb": 1}),
+	}
+	for i := range values {
+		for j := range values {
+			c := Compare(values[i], values[j])
+			switch {
+			case i < j && c >= 0, i > j && c <= 0, i == j && c != 0:
+				t.Fatalf("Compare(%v, %v) is %d", values[i], values[j], c)
+			}
+		}
+	}
+	if Compare(1, NewBigInt(1)) != 0 || Compare(NewVector(1), List{Val: []MalType{1}}) != 0 {
+		t.Fatal("equal values are not ordered as equal")
+	}
+}
+
+func TestOrderedKeys(t *testing.T) {
+	hm := HashMap{}.Assoc("ʞc", 1).Assoc("ʞa", 2).Assoc("ʞb", 3).Assoc("ʞc", 4)
+	for order, expected := range map[Order][]MalType{
+		Sorted:    {"ʞa", "ʞb", "ʞc"},
+		Insertion: {"ʞc", "ʞa", "ʞb"},
+	} {
+		if keys := hm.OrderedKeys(order); !Equal_Q(NewVector(keys...), NewVector(expected...)) {
+			t.Fatalf("order %d: unexpected keys %v", order, keys)
+		}
+	}
+}
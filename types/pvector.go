@@ -0,0 +1,166 @@
+package types
+
+import "fmt"
+
+// pvector is a persistent vector: a bit-partitioned trie of 32 elements wide nodes plus a tail
+// with the last elements. Updates copy the path to the modified leaf (O(log32 n)), sharing the
+// rest of the trie with the original vector. The zero value is an empty vector.
+type pvector struct {
+	count int
+	shift uint
+	root  *pvnode
+	tail  []MalType
+}
+
+const (
+	pvBits  = 5
+	pvWidth = 1 << pvBits
+	pvMask  = pvWidth - 1
+)
+
+type pvnode struct {
+	children [pvWidth]*pvnode
+	values   []MalType // leaves only
+}
+
+func newPvector(values []MalType) pvector {
+	v := pvector{shift: pvBits}
+	for len(values) > 0 {
+		// full chunks are pushed as leaves to avoid copying each element into the tail
+		if len(v.tail) == 0 && len(values) > pvWidth {
+			v = v.pushLeaf(append([]MalType(nil), values[:pvWidth]...))
+			values = values[pvWidth:]
+			continue
+		}
+		v = v.conj(values[0])
+		values = values[1:]
+	}
+	return v
+}
+
+func (v pvector) len() int {
+	return v.count
+}
+
+// tailOffset is the index of the first element of the tail
+func (v pvector) tailOffset() int {
+	if v.count < pvWidth {
+		return 0
+	}
+	return ((v.count - 1) >> pvBits) << pvBits
+}
+
+// leaf returns the elements of the leaf (or tail) holding the index i
+func (v pvector) leaf(i int) []MalType {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= pvBits {
+		node = node.children[(i>>level)&pvMask]
+	}
+	return node.values
+}
+
+func (v pvector) nth(i int) MalType {
+	if i < 0 || i >= v.count {
+		panic(fmt.Sprintf("index out of range [%d] with length %d", i, v.count))
+	}
+	return v.leaf(i)[i&pvMask]
+}
+
+func (v pvector) conj(x MalType) pvector {
+	if len(v.tail) < pvWidth {
+		tail := make([]MalType, len(v.tail)+1, pvWidth)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = x
+		return pvector{count: v.count + 1, shift: v.shift, root: v.root, tail: tail}
+	}
+	v = v.pushLeaf(v.tail)
+	v.tail = make([]MalType, 1, pvWidth)
+	v.tail[0] = x
+	v.count++
+	return v
+}
+
+// pushLeaf adds leaf (of pvWidth elements) to the trie of v, that must have an empty or full tail
+func (v pvector) pushLeaf(values []MalType) pvector {
+	// the elements of a full tail are already counted
+	count := v.count
+	if len(v.tail) == 0 {
+		count += len(values)
+	}
+	leaf := &pvnode{values: values}
+	if v.root == nil {
+		return pvector{count: count, shift: pvBits, root: &pvnode{children: [pvWidth]*pvnode{leaf}}}
+	}
+	trieCount := v.tailOffset()
+	if len(v.tail) == 0 {
+		trieCount = v.count
+	}
+	// root overflow
+	if (trieCount >> pvBits) >= (1 << v.shift) {
+		root := &pvnode{}
+		root.children[0] = v.root
+		root.children[1] = newPath(v.shift, leaf)
+		return pvector{count: count, shift: v.shift + pvBits, root: root}
+	}
+	return pvector{count: count, shift: v.shift, root: pushTail(trieCount, v.shift, v.root, leaf)}
+}
+
+func newPath(level uint, leaf *pvnode) *pvnode {
+	if level == 0 {
+		return leaf
+	}
+	return &pvnode{children: [pvWidth]*pvnode{newPath(level-pvBits, leaf)}}
+}
+
+// pushTail returns a copy of the path of parent where leaf is the leaf of index trieCount
+func pushTail(trieCount int, level uint, parent, leaf *pvnode) *pvnode {
+	node := &pvnode{children: parent.children}
+	i := (trieCount >> level) & pvMask
+	switch {
+	case level == pvBits:
+		node.children[i] = leaf
+	case parent.children[i] != nil:
+		node.children[i] = pushTail(trieCount, level-pvBits, parent.children[i], leaf)
+	default:
+		node.children[i] = newPath(level-pvBits, leaf)
+	}
+	return node
+}
+
+// assoc returns a copy of v with x at index i, that must be in range
+func (v pvector) assoc(i int, x MalType) pvector {
+	if i < 0 || i >= v.count {
+		panic(fmt.Sprintf("index out of range [%d] with length %d", i, v.count))
+	}
+	if i >= v.tailOffset() {
+		tail := make([]MalType, len(v.tail), pvWidth)
+		copy(tail, v.tail)
+		tail[i&pvMask] = x
+		return pvector{count: v.count, shift: v.shift, root: v.root, tail: tail}
+	}
+	return pvector{count: v.count, shift: v.shift, root: assocPath(v.shift, v.root, i, x), tail: v.tail}
+}
+
+func assocPath(level uint, parent *pvnode, i int, x MalType) *pvnode {
+	node := &pvnode{children: parent.children}
+	if level == 0 {
+		node.values = append([]MalType(nil), parent.values...)
+		node.values[i&pvMask] = x
+		return node
+	}
+	j := (i >> level) & pvMask
+	node.children[j] = assocPath(level-pvBits, parent.children[j], i, x)
+	return node
+}
+
+// slice returns a new slice with the elements of v
+func (v pvector) slice() []MalType {
+	values := make([]MalType, 0, v.count)
+	for i := 0; i < v.tailOffset(); i += pvWidth {
+		values = append(values, v.leaf(i)...)
+	}
+	return append(values, v.tail...)
+}
@@ -1,11 +1,13 @@
 package types
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -75,6 +77,41 @@ func String_Q(obj MalType) bool {
 	return Q[string](obj) && !strings.HasPrefix(obj.(string), "\u029e")
 }
 
+// Char is a character. Literals are a backslash followed by the character (\a), its name
+// (\newline, \space, \tab, \return, \backspace or \formfeed) or its code point (\u00e9).
+type Char rune
+
+// charNames are the names of the characters of the literals like \newline
+var charNames = map[Char]string{
+	'\n': "newline",
+	' ':  "space",
+	'\t': "tab",
+	'\r': "return",
+	'\b': "backspace",
+	'\f': "formfeed",
+}
+
+// CharName returns the name of c in character literals (newline for \newline), if it has one
+func CharName(c Char) (string, bool) {
+	name, ok := charNames[c]
+	return name, ok
+}
+
+// CharNamed returns the character of a name in character literals (\n for newline)
+func CharNamed(name string) (Char, bool) {
+	for c, n := range charNames {
+		if n == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// MarshalJSON encodes a character as a string of that character
+func (c Char) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(c))
+}
+
 type ExternalCall func(context.Context, []MalType) (MalType, error)
 
 // Functions
@@ -91,9 +128,67 @@ type MalFunc struct {
 	Env     EnvType
 	Params  MalType
 	IsMacro bool
-	GenEnv  func(EnvType, MalType, MalType) (EnvType, error)
-	Meta    MalType
-	Cursor  *Position
+	// GenEnv returns the environment of a call binding Params to the arguments, where the
+	// function passed evaluates the :or defaults of destructured parameters
+	GenEnv func(EnvType, MalType, MalType, func(MalType, EnvType) (MalType, error)) (EnvType, error)
+	Meta   MalType
+	Cursor *Position
+	// Name is set by def (or by a named fn), and used on error stacks
+	Name string
+	// Arities are the clauses of a multi-arity fn (Exp and Params are not used then)
+	Arities []MalFunc
+}
+
+// Arity returns the clause of f to call with n arguments (f itself if it is not multi-arity)
+func (f MalFunc) Arity(n int) (MalFunc, error) {
+	if len(f.Arities) == 0 {
+		return f, nil
+	}
+	variadic := -1
+	for i, clause := range f.Arities {
+		fixed, rest := ParamsArity(clause.Params)
+		if !rest && fixed == n {
+			clause.Name = f.Name
+			return clause, nil
+		}
+		if rest && n >= fixed {
+			variadic = i
+		}
+	}
+	if variadic < 0 {
+		name := f.Name
+		if name == "" {
+			name = "fn"
+		}
+		return MalFunc{}, fmt.Errorf("wrong number of arguments (%d) passed to %s", n, name)
+	}
+	clause := f.Arities[variadic]
+	clause.Name = f.Name
+	return clause, nil
+}
+
+// ParamsArity returns the number of fixed parameters of a parameters list or vector, and
+// if it has a rest parameter (&)
+func ParamsArity(params MalType) (fixed int, variadic bool) {
+	slc, _ := GetSlice(params)
+	for _, param := range slc {
+		if sym, ok := param.(Symbol); ok && sym.Val == "&" {
+			return fixed, true
+		}
+		fixed++
+	}
+	return fixed, false
+}
+
+// StackTracer is implemented by errors that record the Lisp call stack (see lisperror.LispError)
+type StackTracer interface {
+	WithFrame(name string, pos *Position) error
+}
+
+// Callable is implemented by function values that are neither [Func] nor [MalFunc]
+// (e.g. functions created by compiled programs)
+type Callable interface {
+	Call(ctx context.Context, args []MalType) (MalType, error)
 }
 
 func (f MalFunc) SetMacro() MalType {
@@ -110,16 +205,28 @@ func (f MalFunc) GetMacro() bool {
 func Apply(ctx context.Context, f_mt MalType, a []MalType) (MalType, error) {
 	switch f := f_mt.(type) {
 	case MalFunc:
+		f, e := f.Arity(len(a))
+		if e != nil {
+			return nil, e
+		}
 		env, e := f.GenEnv(f.Env, f.Params, List{
 			Val:    a,
 			Cursor: f.Cursor,
+		}, func(ast MalType, env EnvType) (MalType, error) {
+			return f.Eval(ctx, ast, env)
 		})
 		if e != nil {
 			return nil, e
 		}
-		return f.Eval(ctx, f.Exp, env)
+		res, e := f.Eval(ctx, f.Exp, env)
+		if st, ok := e.(StackTracer); ok {
+			return nil, st.WithFrame(f.Name, f.Cursor)
+		}
+		return res, e
 	case Func:
 		return f.Fn(ctx, a)
+	case Callable:
+		return f.Call(ctx, a)
 	case func([]MalType) (MalType, error):
 		return f(a)
 	default:
@@ -138,27 +245,68 @@ func NewList(a ...MalType) MalType {
 	return List{Val: a}
 }
 
-// Vectors
+// Vectors are persistent: updates return a new vector sharing most of its structure with
+// the original one. The zero value is an empty vector.
 type Vector struct {
-	Val    []MalType
+	vec    pvector
 	Meta   MalType
 	Cursor *Position
 }
 
+// NewVector returns a vector with the elements of values
+func NewVector(values ...MalType) Vector {
+	return Vector{vec: newPvector(values)}
+}
+
+// Len returns the number of elements of v
+func (v Vector) Len() int {
+	return v.vec.len()
+}
+
+// Nth returns the element of index i, that must be in range
+func (v Vector) Nth(i int) MalType {
+	return v.vec.nth(i)
+}
+
+// Conj returns a copy of v with values appended
+func (v Vector) Conj(values ...MalType) Vector {
+	vec := v.vec
+	for _, value := range values {
+		vec = vec.conj(value)
+	}
+	return Vector{vec: vec, Meta: v.Meta, Cursor: v.Cursor}
+}
+
+// Assoc returns a copy of v with value at index i, that must be in range (or Len to append it)
+func (v Vector) Assoc(i int, value MalType) Vector {
+	if i == v.vec.len() {
+		return v.Conj(value)
+	}
+	return Vector{vec: v.vec.assoc(i, value), Meta: v.Meta, Cursor: v.Cursor}
+}
+
+// Slice returns a new slice with the elements of v
+func (v Vector) Slice() []MalType {
+	return v.vec.slice()
+}
+
+// GetSlice returns the elements of a list or a vector. The slice of a vector is a copy.
 func GetSlice(seq MalType) ([]MalType, error) {
 	switch seq := seq.(type) {
 	case List:
 		return seq.Val, nil
 	case Vector:
-		return seq.Val, nil
+		return seq.Slice(), nil
 	default:
 		return nil, errors.New("GetSlice called on non-sequence")
 	}
 }
 
-// Hash Maps
+// Hash Maps are persistent: updates return a new hash map sharing most of its structure
+// with the original one. Keys can be any value, compared with Equal_Q (e.g. {1 "a" [1 2] "b"}).
+// The zero value is an empty hash map.
 type HashMap struct {
-	Val    map[string]MalType
+	m      hamt
 	Meta   MalType
 	Cursor *Position
 }
@@ -171,20 +319,73 @@ func NewHashMap(seq MalType) (MalType, error) {
 	if len(lst)%2 == 1 {
 		return nil, errors.New("odd number of arguments to NewHashMap")
 	}
-	m := map[string]MalType{}
+	hm := HashMap{}
 	for i := 0; i < len(lst); i += 2 {
-		str, ok := lst[i].(string)
-		if !ok {
-			return nil, fmt.Errorf("expected hash-map key string (found %T)", lst[i])
-		}
-		m[str] = lst[i+1]
+		hm.m = hm.m.assoc(lst[i], lst[i+1])
 	}
-	return HashMap{Val: m}, nil
+	return hm, nil
+}
+
+// NewHashMapFromMap returns a hash map with the entries of m
+func NewHashMapFromMap(m map[string]MalType) HashMap {
+	hm := HashMap{}
+	for k, v := range m {
+		hm.m = hm.m.assoc(k, v)
+	}
+	return hm
+}
+
+// Len returns the number of entries of hm
+func (hm HashMap) Len() int {
+	return hm.m.len()
+}
+
+// Get returns the value of key, and false if hm doesn't contain key
+func (hm HashMap) Get(key MalType) (MalType, bool) {
+	return hm.m.get(key)
+}
+
+// Assoc returns a copy of hm with key set to value
+func (hm HashMap) Assoc(key, value MalType) HashMap {
+	return HashMap{m: hm.m.assoc(key, value), Meta: hm.Meta, Cursor: hm.Cursor}
+}
+
+// Dissoc returns a copy of hm without key
+func (hm HashMap) Dissoc(key MalType) HashMap {
+	return HashMap{m: hm.m.dissoc(key), Meta: hm.Meta, Cursor: hm.Cursor}
+}
+
+// Range calls f with each entry of hm (in no particular order) while f returns true
+func (hm HashMap) Range(f func(key, value MalType) bool) {
+	hm.m.each(f)
+}
+
+// Keys returns the keys of hm (in no particular order)
+func (hm HashMap) Keys() []MalType {
+	keys := make([]MalType, 0, hm.m.len())
+	hm.m.each(func(key, _ MalType) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Map returns a new Go map with the entries of hm whose keys are strings (or keywords)
+func (hm HashMap) Map() map[string]MalType {
+	m := make(map[string]MalType, hm.m.len())
+	hm.m.each(func(key, value MalType) bool {
+		if key, ok := key.(string); ok {
+			m[key] = value
+		}
+		return true
+	})
+	return m
 }
 
-// Sets
+// Sets are persistent: updates return a new set sharing most of its structure with the
+// original one. Items can be any value, compared with Equal_Q. The zero value is an empty set.
 type Set struct {
-	Val    map[string]struct{}
+	m      hamt
 	Meta   MalType
 	Cursor *Position
 }
@@ -199,15 +400,42 @@ func NewSet(seq MalType) (Set, error) {
 		return Set{}, e
 	}
 
-	m := map[string]struct{}{}
+	s := Set{}
 	for _, item := range lst {
-		sItem, ok := item.(string)
-		if !ok {
-			return Set{}, errors.New("set items must be strings or keywords")
-		}
-		m[sItem] = struct{}{}
+		s.m = s.m.assoc(item, nil)
 	}
-	return Set{Val: m}, nil
+	return s, nil
+}
+
+// Len returns the number of items of s
+func (s Set) Len() int {
+	return s.m.len()
+}
+
+// Contains returns true if item is in s
+func (s Set) Contains(item MalType) bool {
+	_, ok := s.m.get(item)
+	return ok
+}
+
+// Conj returns a copy of s with item added
+func (s Set) Conj(item MalType) Set {
+	return Set{m: s.m.assoc(item, nil), Meta: s.Meta, Cursor: s.Cursor}
+}
+
+// Disj returns a copy of s without item
+func (s Set) Disj(item MalType) Set {
+	return Set{m: s.m.dissoc(item), Meta: s.Meta, Cursor: s.Cursor}
+}
+
+// Items returns the items of s (in no particular order)
+func (s Set) Items() []MalType {
+	items := make([]MalType, 0, s.m.len())
+	s.m.each(func(item, _ MalType) bool {
+		items = append(items, item)
+		return true
+	})
+	return items
 }
 
 // Dereferable type
@@ -229,6 +457,28 @@ func Sequential_Q(seq MalType) bool {
 }
 
 func Equal_Q(a, b MalType) bool {
+	// integers are equal by value regardless of their precision
+	switch a := a.(type) {
+	case int:
+		if b, ok := b.(BigInt); ok {
+			return b.Val.IsInt64() && b.Val.Int64() == int64(a)
+		}
+	case BigInt:
+		switch b := b.(type) {
+		case int:
+			return a.Val.IsInt64() && a.Val.Int64() == int64(b)
+		case BigInt:
+			return a.Val.Cmp(b.Val) == 0
+		}
+	case Decimal:
+		if b, ok := b.(Decimal); ok {
+			return a.Val.Cmp(b.Val) == 0
+		}
+	case []byte:
+		// slices can't be compared with ==
+		b, ok := b.([]byte)
+		return ok && bytes.Equal(a, b)
+	}
 	ota := reflect.TypeOf(a)
 	otb := reflect.TypeOf(b)
 	if !((ota == otb) || (Sequential_Q(a) && Sequential_Q(b))) {
@@ -265,40 +515,164 @@ func Equal_Q(a, b MalType) bool {
 		}
 		return true
 	case HashMap:
-		am := a.(HashMap).Val
-		bm := b.(HashMap).Val
-		if len(am) != len(bm) {
+		am := a.(HashMap)
+		bm := b.(HashMap)
+		if am.Len() != bm.Len() {
 			return false
 		}
-		for k, v := range am {
-			if !Equal_Q(v, bm[k]) {
+		equal := true
+		am.Range(func(k, v MalType) bool {
+			bv, ok := bm.Get(k)
+			equal = ok && Equal_Q(v, bv)
+			return equal
+		})
+		return equal
+	case Set:
+		as := a.(Set)
+		bs := b.(Set)
+		if as.Len() != bs.Len() {
+			return false
+		}
+		for _, item := range as.Items() {
+			if !bs.Contains(item) {
 				return false
 			}
 		}
 		return true
-	case Set:
-		am := a.(Set).Val
-		bm := b.(Set).Val
-		if len(am) != len(bm) {
-			return false
+	case MalFunc, Func:
+		// functions are equal only to themselves
+		return funcIdentity(a) == funcIdentity(b)
+	default:
+		return isComparable(a) && a == b
+	}
+}
+
+// isComparable is false if a can't be compared with == (e.g. it is a struct holding a slice)
+func isComparable(a MalType) bool {
+	return comparableValue(reflect.ValueOf(a))
+}
+
+func comparableValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		// nil
+		return true
+	case reflect.Interface:
+		return v.IsNil() || comparableValue(v.Elem())
+	case reflect.Struct:
+		// the fields of type interface might hold uncomparable values
+		for i := 0; i < v.NumField(); i++ {
+			if !comparableValue(v.Field(i)) {
+				return false
+			}
 		}
-		for key := range am {
-			if _, ok := bm[key]; !ok {
+		return true
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !comparableValue(v.Index(i)) {
 				return false
 			}
 		}
 		return true
 	default:
-		return a == b
+		return v.Type().Comparable()
 	}
 }
 
+// MarshalJSON encodes hm as a JSON object, with its members sorted (see [MarshalJSONOrdered]).
+// Strings and keywords are encoded as its members names, numbers and booleans with their text
+// (e.g. {1 "a"} is {"1":"a"}) and symbols with their name. Other keys (nil, collections...)
+// can't be encoded.
 func (hm HashMap) MarshalJSON() ([]byte, error) {
-	return json.Marshal(hm.Val)
+	return hm.marshalJSON(Sorted)
+}
+
+func (hm HashMap) marshalJSON(order Order) ([]byte, error) {
+	var buf bytes.Buffer
+	names := make(map[string]struct{}, hm.Len())
+	buf.WriteByte('{')
+	for i, k := range hm.OrderedKeys(order) {
+		name, err := jsonKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("json: duplicated hash map key %q", name)
+		}
+		names[name] = struct{}{}
+		v, _ := hm.Get(k)
+		value, err := MarshalJSONOrdered(v, order)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, _ := json.Marshal(name)
+		buf.Write(b)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalJSONOrdered is json.Marshal(v) with the hash maps and sets of v encoded in order
+func MarshalJSONOrdered(v MalType, order Order) ([]byte, error) {
+	switch v := v.(type) {
+	case HashMap:
+		return v.marshalJSON(order)
+	case Set:
+		return marshalJSONArray(v.OrderedItems(order), order)
+	case List:
+		return marshalJSONArray(v.Val, order)
+	case Vector:
+		return marshalJSONArray(v.Slice(), order)
+	default:
+		return json.Marshal(v)
+	}
+}
+
+func marshalJSONArray(items []MalType, order Order) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, item := range items {
+		b, err := MarshalJSONOrdered(item, order)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+func jsonKey(k MalType) (string, error) {
+	switch k := k.(type) {
+	case string:
+		return k, nil
+	case int:
+		return strconv.Itoa(k), nil
+	case BigInt:
+		return k.String(), nil
+	case Decimal:
+		return k.String(), nil
+	case float64:
+		return strconv.FormatFloat(k, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(k), nil
+	case Symbol:
+		return k.Val, nil
+	default:
+		return "", fmt.Errorf("json: unsupported hash map key of type %s", TypeName(k))
+	}
 }
 
 func (v Vector) MarshalJSON() ([]byte, error) {
-	return json.Marshal(v.Val)
+	return json.Marshal(v.Slice())
 }
 
 func (l List) MarshalJSON() ([]byte, error) {
@@ -306,25 +680,17 @@ func (l List) MarshalJSON() ([]byte, error) {
 }
 
 func (s Set) MarshalJSON() ([]byte, error) {
-	keys, _, err := ConvertFrom(s)
-	if err != nil {
-		return nil, err
-	}
-	return json.Marshal(keys)
+	return json.Marshal(s.OrderedItems(Sorted))
 }
 
 func ConvertFrom(from MalType) ([]MalType, MalType, error) {
 	switch from := from.(type) {
 	case Set:
-		keys := make([]MalType, 0, len(from.Val))
-		for k := range from.Val {
-			keys = append(keys, k)
-		}
-		return keys, from.Meta, nil
+		return from.OrderedItems(Sorted), from.Meta, nil
 	case List:
 		return from.Val, from.Meta, nil
 	case Vector:
-		return from.Val, from.Meta, nil
+		return from.Slice(), from.Meta, nil
 	default:
 		return nil, nil, fmt.Errorf("cannot convert from type %T", from)
 	}
@@ -333,9 +699,9 @@ func ConvertFrom(from MalType) ([]MalType, MalType, error) {
 func ConvertTo(from []MalType, _to MalType, meta MalType) (MalType, error) {
 	switch _to.(type) {
 	case Set:
-		to := Set{Val: map[string]struct{}{}}
+		to := Set{}
 		for _, k := range from {
-			to.Val[k.(string)] = struct{}{}
+			to = to.Conj(k)
 		}
 		return to, nil
 	case List:
@@ -345,11 +711,9 @@ func ConvertTo(from []MalType, _to MalType, meta MalType) (MalType, error) {
 			Cursor: &Position{},
 		}, nil
 	case Vector:
-		return Vector{
-			Val:    from,
-			Meta:   meta,
-			Cursor: &Position{},
-		}, nil
+		to := NewVector(from...)
+		to.Meta, to.Cursor = meta, &Position{}
+		return to, nil
 	default:
 		return nil, fmt.Errorf("cannot convert to type %T", _to)
 	}
@@ -368,3 +732,50 @@ type Placeholder struct {
 type Typed interface {
 	Type() string
 }
+
+// TypeName returns the type name of a value (as returned by type?)
+func TypeName(arg MalType) string {
+	switch arg := arg.(type) {
+	case nil:
+		return "nil"
+	case List:
+		return "list"
+	case HashMap:
+		return "hash-map"
+	case Vector:
+		return "vector"
+	case Set:
+		return "set"
+	case int:
+		return "integer"
+	case BigInt:
+		return "bigint"
+	case Decimal:
+		return "decimal"
+	case float64, float32:
+		return "float"
+	case bool:
+		return "boolean"
+	case Symbol:
+		return "symbol"
+	case string:
+		if len(arg) != 0 && strings.HasPrefix(arg, "ʞ") {
+			return "keyword"
+		}
+		return "string"
+	case Char:
+		return "character"
+	case MalFunc:
+		return "function"
+	case interface{ ErrorValue() MalType }:
+		return "error"
+	case Typed:
+		return arg.Type()
+	case error:
+		return "go-error"
+	case Func:
+		return "go-function"
+	default:
+		return fmt.Sprintf("unsupported(%T)", arg)
+	}
+}